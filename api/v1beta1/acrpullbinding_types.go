@@ -73,8 +73,29 @@ type AcrPullBindingStatus struct {
 	// Error message if there was an error updating the token.
 	// +optional
 	Error string `json:"error,omitempty"`
+
+	// Conditions describe the observed state of the binding.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
+const (
+	// ConditionTypeLegacyPullSecretLabelled indicates whether the legacy pull secret for the binding, if any, has been
+	// labelled for the controller to manage. The condition is only reported while legacy token cleanup is running.
+	ConditionTypeLegacyPullSecretLabelled = "LegacyPullSecretLabelled"
+
+	// ConditionReasonLegacyPullSecretPending is used while the legacy pull secret has yet to be labelled.
+	ConditionReasonLegacyPullSecretPending = "LabelPending"
+	// ConditionReasonLegacyPullSecretLabelled is used when the legacy pull secret has been labelled.
+	ConditionReasonLegacyPullSecretLabelled = "Labelled"
+	// ConditionReasonLegacyPullSecretAbsent is used when the binding has no legacy pull secret.
+	ConditionReasonLegacyPullSecretAbsent = "NoLegacyPullSecret"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 
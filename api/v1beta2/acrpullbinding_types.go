@@ -28,6 +28,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// +kubebuilder:validation:XValidation:rule="has(self.acr.connectedRegistry) == has(self.auth.clientToken)", message="connected registries require, and only accept, client token authentication"
+
 // AcrPullBindingSpec defines the desired state of AcrPullBinding
 type AcrPullBindingSpec struct {
 	// +kubebuilder:validation:Required
@@ -44,20 +46,72 @@ type AcrPullBindingSpec struct {
 
 	// The name of the service account to associate the image pull secret with.
 	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// Probe configures the controller to periodically check that the registry still accepts the current pull
+	// credential, so that broken role assignments, network paths or registries are noticed before pulls fail.
+	Probe *ProbeConfiguration `json:"probe,omitempty"`
+}
+
+// ProbeConfiguration determines how and how often the registry is probed with the current pull credential.
+type ProbeConfiguration struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="10m"
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('1m')", message="interval must be at least one minute"
+
+	// Interval is how long to wait between probes.
+	Interval metav1.Duration `json:"interval,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example=my-repository
+
+	// Repository names a repository in the scope of the binding, in which the probed manifest lives.
+	Repository string `json:"repository"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=latest
+	// +kubebuilder:example=latest
+
+	// Reference is the tag or digest of the manifest to fetch the headers of.
+	Reference string `json:"reference,omitempty"`
 }
 
-// +kubebuilder:validation:XValidation:rule="self.environment == 'ArigappedCloud' ? has(self.cloudConfig) : !has(self.cloudConfig)", message="a custom cloud configuration must be present for air-gapped cloud environments"
+// +kubebuilder:validation:XValidation:rule="has(self.registryRef) ? !has(self.server) && !has(self.additionalHosts) && !has(self.environment) : has(self.server) && has(self.scope)", message="a registryRef replaces server, additionalHosts and environment, which are taken from the registry; without one, server and scope are required"
+// +kubebuilder:validation:XValidation:rule="has(self.environment) && self.environment == 'AirgappedCloud' ? has(self.cloudConfig) != has(self.cloudProfileRef) : !has(self.cloudConfig) && !has(self.cloudProfileRef)", message="exactly one of cloudConfig or cloudProfileRef must be set for air-gapped cloud environments, and neither for other environments"
+// +kubebuilder:validation:XValidation:rule="!has(self.authEndpoint) || self.authEndpoint.startsWith('https://') || (has(self.connectedRegistry) && has(self.connectedRegistry.allowInsecureHTTP) && self.connectedRegistry.allowInsecureHTTP)", message="a plain HTTP auth endpoint requires a connected registry that allows insecure HTTP"
 
 // AcrConfiguration identifies the Azure Container Registry we wish to bind to and how we will bind to it.
 type AcrConfiguration struct {
-	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example=shared-registry
+
+	// RegistryRef names an AcrRegistry in the namespace of the binding to take the server, additional hosts, cloud and
+	// default scope from, in place of setting them on the binding.
+	RegistryRef string `json:"registryRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
 	// +kubebuilder:example=example.azurecr.io
 	// +kubebuilder:validation:XValidation:rule="isURL('https://' + self) && url('https://' + self).getHostname() == self", message="server must be a fully-qualified domain name"
 
-	// Server is the FQDN for the Azure Container Registry, e.g. example.azurecr.io
-	Server string `json:"server"`
+	// Server is the FQDN for the Azure Container Registry, e.g. example.azurecr.io. Required unless a registryRef is set.
+	Server string `json:"server,omitempty"`
 
-	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:items:MaxLength=253
+	// +kubebuilder:validation:items:XValidation:rule="isURL('https://' + self) && url('https://' + self).getHostname() == self", message="additional hosts must be fully-qualified domain names"
+	// +kubebuilder:example={"example-eastus.azurecr.io","registry.example.com"}
+
+	// AdditionalHosts lists other host names that front the same registry, such as geo-replica endpoints, private
+	// link aliases or pull-through proxies. The token is still exchanged with the server, but the pull credential is
+	// written for each of these hosts as well, so that images referenced through them can be pulled.
+	AdditionalHosts []string `json:"additionalHosts,omitempty"`
+
+	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:example="repository:my-repository:pull,push"
 
@@ -69,20 +123,73 @@ type AcrConfiguration struct {
 	// Examples:
 	// repository:my-repository:pull,push
 	// repository:my-repository:pull repository:other-repository:push,pull
-	Scope string `json:"scope"`
+	//
+	// Required unless a registryRef is set whose registry has a default scope.
+	Scope string `json:"scope,omitempty"`
 
-	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Enum=PublicCloud;USGovernmentCloud;ChinaCloud;AirgappedCloud
-	// +kubebuilder:default=PublicCloud
 	// +kubebuilder:example=PublicCloud
 
-	// Environment specifies the Azure Cloud environment in which the ACR is deployed.
-	Environment AzureEnvironmentType `json:"environment"`
+	// Environment specifies the Azure Cloud environment in which the ACR is deployed. Defaults to PublicCloud unless a
+	// registryRef is set, in which case the environment of the registry is used.
+	Environment AzureEnvironmentType `json:"environment,omitempty"`
 
 	// +kubebuilder:validation:Optional
 
 	// AirgappedCloudConfiguration configures a custom cloud to interact with when running air-gapped.
 	CloudConfig *AirgappedCloudConfiguration `json:"cloudConfig,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example=airgap
+
+	// CloudProfileRef names the AzureCloudProfile describing the air-gapped cloud to interact with, in place of an
+	// inline cloudConfig.
+	CloudProfileRef string `json:"cloudProfileRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:example="my-repository:latest"
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]+([._/-][a-z0-9]+)*(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}|@[A-Za-z0-9_+.-]+:[A-Fa-f0-9]{32,})$`
+
+	// VerificationManifest names a manifest in one of the repositories in the scope, as <repository>:<tag> or
+	// <repository>@<digest>. When the controller verifies new pull credentials before replacing the current one, it
+	// fetches the headers of this manifest with the new token; when unset, it calls the registry's /v2/ endpoint instead.
+	VerificationManifest string `json:"verificationManifest,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:example="https://auth.example.com"
+	// +kubebuilder:validation:XValidation:rule="isURL(self) && url(self).getScheme() in ['http', 'https'] && url(self).getEscapedPath() in ['', '/']", message="authEndpoint must be an http or https URL without a path"
+
+	// AuthEndpoint is the base URL of the token service (the auth realm) of the registry, when it is served by a
+	// different host than the registry itself, such as a gateway in front of the registry. Tokens are requested from
+	// its /oauth2/exchange and /oauth2/token endpoints. Plain HTTP is only allowed for connected registries that opt in.
+	// Its host is subject to the same allowed suffixes and pull policies as the server.
+	AuthEndpoint string `json:"authEndpoint,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// ConnectedRegistry marks the server as an on-premises ACR connected registry, which issues tokens for its client
+	// tokens rather than for Entra identities. Connected registries require client token authentication.
+	ConnectedRegistry *ConnectedRegistryConfiguration `json:"connectedRegistry,omitempty"`
+}
+
+// ConnectedRegistryConfiguration determines how an ACR connected registry is reached.
+type ConnectedRegistryConfiguration struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:example=8080
+
+	// Port is the port the connected registry listens on, if not the default port for its scheme. Images are pulled
+	// from <server>:<port>, so the pull credential is written for that host.
+	Port int32 `json:"port,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// AllowInsecureHTTP opts in to reaching the connected registry, and its auth endpoint, over plain HTTP. Client
+	// token passwords and registry tokens are then sent unencrypted, so this is only suitable for isolated networks.
+	AllowInsecureHTTP bool `json:"allowInsecureHTTP,omitempty"`
 }
 
 // AzureEnvironmentType represents a set of endpoints for each of Azure's Clouds.
@@ -107,14 +214,43 @@ type AirgappedCloudConfiguration struct {
 
 	// ResourceManagerAudience configures the audience for which tokens will be requested from Entra.
 	ResourceManagerAudience string `json:"resourceManagerAudience"`
+
+	// +kubebuilder:validation:Optional
+
+	// CABundleRef refers to a ConfigMap in the namespace of the binding holding the PEM certificates to trust, along
+	// with the controller's, when connecting to the cloud's Entra and registry endpoints.
+	CABundleRef *ConfigMapKeyReference `json:"caBundleRef,omitempty"`
 }
 
-// +kubebuilder:validation:XValidation:rule="[has(self.managedIdentity), has(self.workloadIdentity)].exists_one(x, x)", message="only one authentication type can be set"
+// ConfigMapKeyReference refers to a key in a ConfigMap.
+type ConfigMapKeyReference struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+
+	// Name is the name of the ConfigMap.
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="ca.crt"
+	// +kubebuilder:validation:MinLength=1
+
+	// Key is the key in the ConfigMap holding the value, defaulting to ca.crt.
+	Key string `json:"key,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="has(self.identityRef) ? !has(self.managedIdentity) && !has(self.clientToken) && (!has(self.workloadIdentity) || (!has(self.workloadIdentity.clientID) && !has(self.workloadIdentity.tenantID))) : [has(self.managedIdentity), has(self.workloadIdentity), has(self.clientToken)].exists_one(x, x)", message="only one authentication type can be set; an identityRef may only be combined with the service account of a workloadIdentity"
 
 // AuthenticationMethod holds a disjoint set of methods for authentication to an ACR.
 type AuthenticationMethod struct {
 	// +kubebuilder:validation:Optional
 
+	// IdentityRef refers to an AzureIdentity or ClusterAzureIdentity to authenticate as. Bindings referring to a
+	// workload identity also name the federated service account in workloadIdentity.serviceAccountRef.
+	IdentityRef *IdentityReference `json:"identityRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
 	// ManagedIdentity uses Azure Managed Identity to authenticate with Azure.
 	ManagedIdentity *ManagedIdentityAuth `json:"managedIdentity,omitempty"`
 
@@ -122,6 +258,37 @@ type AuthenticationMethod struct {
 
 	// WorkloadIdentity uses Azure Workload Identity to authenticate with Azure.
 	WorkloadIdentity *WorkloadIdentityAuth `json:"workloadIdentity,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// ClientToken uses a client token of an ACR connected registry to authenticate with the registry.
+	ClientToken *ClientTokenAuth `json:"clientToken,omitempty"`
+}
+
+// IdentityReference refers to an AzureIdentity in the namespace of the binding, or to a ClusterAzureIdentity.
+type IdentityReference struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=AzureIdentity;ClusterAzureIdentity
+	// +kubebuilder:default=AzureIdentity
+
+	// Kind is the kind of the identity, defaulting to AzureIdentity.
+	Kind string `json:"kind,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+
+	// Name is the name of the identity.
+	Name string `json:"name"`
+}
+
+// ClientTokenAuth configures authentication to use a registry client token.
+type ClientTokenAuth struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+
+	// SecretName names a kubernetes.io/basic-auth Secret in the namespace of the binding, holding the name of the
+	// client token as the username and one of its passwords as the password.
+	SecretName string `json:"secretName"`
 }
 
 // +kubebuilder:validation:XValidation:rule="[has(self.clientID), has(self.resourceID)].exists_one(x, x)", message="only client or resource ID can be set"
@@ -187,8 +354,100 @@ type AcrPullBindingStatus struct {
 
 	// Error message if there was an error updating the token.
 	Error string `json:"error,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// The repository access granted by the current ACR token, formatted like the requested scope. ACR narrows the
+	// access it grants to the actions the identity may take, so this may be narrower than spec.acr.scope.
+	GrantedScope string `json:"grantedScope,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// The last time the registry was probed with the current pull credential.
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// The outcome of the last probe of the registry.
+	LastProbeResult ProbeResult `json:"lastProbeResult,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// Describes why the last probe of the registry failed, and how to remediate it, if it did.
+	LastProbeMessage string `json:"lastProbeMessage,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+
+	// Conditions describe the observed state of the binding.
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
+// ProbeResult is the outcome of probing the registry with the current pull credential.
+type ProbeResult string
+
+const (
+	// ProbeResultSucceeded means the registry accepted the pull credential and served the manifest.
+	ProbeResultSucceeded ProbeResult = "Succeeded"
+	// ProbeResultUnauthorized means the registry no longer accepts the pull credential for the repository.
+	ProbeResultUnauthorized ProbeResult = "Unauthorized"
+	// ProbeResultNotFound means the registry or the manifest does not exist.
+	ProbeResultNotFound ProbeResult = "NotFound"
+	// ProbeResultUnreachable means the registry could not be reached, failed or throttled the probe.
+	ProbeResultUnreachable ProbeResult = "Unreachable"
+	// ProbeResultFailed means the probe failed for any other reason.
+	ProbeResultFailed ProbeResult = "Failed"
+)
+
+const (
+	// ConditionTypePolicyCompliant indicates whether the binding complies with the AcrPullPolicies selecting its
+	// namespace. The condition is only reported when AcrPullPolicy enforcement is enabled.
+	ConditionTypePolicyCompliant = "PolicyCompliant"
+
+	// ConditionReasonPolicyCompliant is used when the binding complies with an AcrPullPolicy, or no policy applies.
+	ConditionReasonPolicyCompliant = "Compliant"
+	// ConditionReasonPolicyViolation is used when the binding does not comply with any applicable AcrPullPolicy.
+	ConditionReasonPolicyViolation = "PolicyViolation"
+
+	// ConditionTypeCredentialIssued indicates whether a pull credential could be issued for the binding. When it could
+	// not, the reason classifies the failure and the message describes how to remediate it, where the user can.
+	ConditionTypeCredentialIssued = "CredentialIssued"
+
+	// ConditionReasonCredentialIssued is used when a pull credential was issued.
+	ConditionReasonCredentialIssued = "Issued"
+	// ConditionReasonIdentityNotFound is used when Entra or IMDS does not know the identity.
+	ConditionReasonIdentityNotFound = "IdentityNotFound"
+	// ConditionReasonFederationMismatch is used when no federated identity credential trusts the service account.
+	ConditionReasonFederationMismatch = "FederationMismatch"
+	// ConditionReasonRegistryUnauthorized is used when the registry refuses to issue a token to the identity.
+	ConditionReasonRegistryUnauthorized = "RegistryUnauthorized"
+	// ConditionReasonScopeDenied is used when the registry refuses to issue a token for the scope.
+	ConditionReasonScopeDenied = "ScopeDenied"
+	// ConditionReasonRegistryNotFound is used when the registry does not exist.
+	ConditionReasonRegistryNotFound = "RegistryNotFound"
+	// ConditionReasonThrottled is used when Entra, IMDS or the registry throttled our requests.
+	ConditionReasonThrottled = "Throttled"
+	// ConditionReasonTransientError is used when a request failed in a way that is retried automatically.
+	ConditionReasonTransientError = "TransientError"
+	// ConditionReasonVerificationFailed is used when the registry did not accept a new pull credential, which was
+	// discarded in favor of the current one.
+	ConditionReasonVerificationFailed = "VerificationFailed"
+	// ConditionReasonCredentialFailed is used for any other failure to issue a pull credential.
+	ConditionReasonCredentialFailed = "Failed"
+
+	// ConditionTypeScopeFullyGranted indicates whether the registry granted every action in the requested scope. The
+	// condition is only reported for bindings requesting a scope.
+	ConditionTypeScopeFullyGranted = "ScopeFullyGranted"
+
+	// ConditionReasonScopeFullyGranted is used when the registry granted the requested scope.
+	ConditionReasonScopeFullyGranted = "FullyGranted"
+	// ConditionReasonScopePartiallyGranted is used when the registry granted fewer actions than requested.
+	ConditionReasonScopePartiallyGranted = "PartiallyGranted"
+)
+
 // +genclient
 // +kubebuilder:resource:path=acrpullbindings,shortName=apb;apbs,scope=Namespaced
 // +kubebuilder:object:root=true
@@ -200,6 +459,7 @@ type AcrPullBindingStatus struct {
 // +kubebuilder:printcolumn:name="Last Refresh",type="date",JSONPath=".status.lastTokenRefreshTime",description="Time the token was last refreshed.",priority=1
 // +kubebuilder:printcolumn:name="Expiration",type="date",JSONPath=".status.tokenExpirationTime",description="Time the current token expires.",priority=0
 // +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.error",description="Errors encountered during token generation, if any.",priority=0
+// +kubebuilder:printcolumn:name="Probe",type="string",JSONPath=".status.lastProbeResult",description="Outcome of the last probe of the registry, if probed.",priority=1
 
 // AcrPullBinding is the Schema for the acrpullbindings API
 type AcrPullBinding struct {
@@ -0,0 +1,107 @@
+/*
+   MIT License
+
+   Copyright (c) Microsoft Corporation.
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AcrPullPolicySpec defines which identities, registries and scopes AcrPullBindings in a set of namespaces may use.
+type AcrPullPolicySpec struct {
+	// +kubebuilder:validation:Optional
+
+	// NamespaceSelector chooses the namespaces to which this policy applies. An empty selector applies the policy to
+	// every namespace.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +listType=atomic
+
+	// AllowedIdentities lists the identities AcrPullBindings in the selected namespaces may use. If empty, any
+	// identity may be used.
+	AllowedIdentities []AllowedIdentity `json:"allowedIdentities,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +listType=set
+	// +kubebuilder:example="*.azurecr.io"
+
+	// AllowedRegistries lists the ACR servers AcrPullBindings in the selected namespaces may bind to. Entries are
+	// shell-style patterns as implemented by path.Match, e.g. team-a.azurecr.io or *.azurecr.io, where ** may
+	// additionally be used to match any sequence of characters including /. If empty, any registry may be used.
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +listType=set
+	// +kubebuilder:example="repository:team-a/*:pull"
+
+	// AllowedScopes lists the token scopes AcrPullBindings in the selected namespaces may request. Every
+	// space-delimited scope in a binding must match one of these shell-style patterns, as implemented by path.Match,
+	// e.g. repository:team-a/*:pull. As * does not match /, nested repositories such as team-a/app/frontend need
+	// **, which matches any sequence of characters including /, e.g. repository:team-a/**:pull. If empty, any scope
+	// may be requested.
+	AllowedScopes []string `json:"allowedScopes,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="[has(self.clientID), has(self.resourceID)].exists_one(x, x)", message="only client or resource ID can be set"
+
+// AllowedIdentity identifies an Azure identity that AcrPullBindings may use.
+type AllowedIdentity struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:example="1b461305-28be-5271-beda-bd9fd2e24251"
+
+	// ClientID is the client identifier for the identity.
+	ClientID string `json:"clientID,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:example=/subscriptions/sub-name/resourceGroups/rg-name/providers/Microsoft.ManagedIdentity/userAssignedIdentities/1b461305-28be-5271-beda-bd9fd2e24251
+
+	// ResourceID is the resource identifier for a managed identity.
+	ResourceID string `json:"resourceID,omitempty"`
+}
+
+// +kubebuilder:resource:path=acrpullpolicies,shortName=apol,scope=Cluster
+// +kubebuilder:object:root=true
+
+// AcrPullPolicy restricts the identities, registries and scopes that AcrPullBindings in the selected namespaces may
+// use. When more than one policy selects a namespace, a binding is allowed if it complies with any of them.
+type AcrPullPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AcrPullPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AcrPullPolicyList contains a list of AcrPullPolicy
+type AcrPullPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AcrPullPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AcrPullPolicy{}, &AcrPullPolicyList{})
+}
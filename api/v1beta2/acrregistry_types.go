@@ -0,0 +1,108 @@
+/*
+   MIT License
+
+   Copyright (c) Microsoft Corporation.
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:XValidation:rule="self.environment == 'AirgappedCloud' ? has(self.cloudConfig) != has(self.cloudProfileRef) : !has(self.cloudConfig) && !has(self.cloudProfileRef)", message="exactly one of cloudConfig or cloudProfileRef must be set for air-gapped cloud environments, and neither for other environments"
+
+// AcrRegistrySpec describes an Azure Container Registry and the cloud it is deployed in.
+type AcrRegistrySpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:example=example.azurecr.io
+	// +kubebuilder:validation:XValidation:rule="isURL('https://' + self) && url('https://' + self).getHostname() == self", message="server must be a fully-qualified domain name"
+
+	// Server is the FQDN for the Azure Container Registry, e.g. example.azurecr.io
+	Server string `json:"server"`
+
+	// +kubebuilder:validation:Optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:items:MaxLength=253
+	// +kubebuilder:validation:items:XValidation:rule="isURL('https://' + self) && url('https://' + self).getHostname() == self", message="additional hosts must be fully-qualified domain names"
+	// +kubebuilder:example={"example-eastus.azurecr.io","registry.example.com"}
+
+	// AdditionalHosts lists other host names that front the same registry, for which pull credentials are written as
+	// well.
+	AdditionalHosts []string `json:"additionalHosts,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=PublicCloud;USGovernmentCloud;ChinaCloud;AirgappedCloud
+	// +kubebuilder:default=PublicCloud
+	// +kubebuilder:example=PublicCloud
+
+	// Environment specifies the Azure Cloud environment in which the ACR is deployed.
+	Environment AzureEnvironmentType `json:"environment"`
+
+	// +kubebuilder:validation:Optional
+
+	// AirgappedCloudConfiguration configures a custom cloud to interact with when running air-gapped.
+	CloudConfig *AirgappedCloudConfiguration `json:"cloudConfig,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example=airgap
+
+	// CloudProfileRef names the AzureCloudProfile describing the air-gapped cloud to interact with, in place of an
+	// inline cloudConfig.
+	CloudProfileRef string `json:"cloudProfileRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example="repository:my-repository:pull"
+
+	// DefaultScope is the scope requested for bindings referring to this registry which do not set their own.
+	DefaultScope string `json:"defaultScope,omitempty"`
+}
+
+// +kubebuilder:resource:path=acrregistries,shortName=acrreg
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Server",type="string",JSONPath=".spec.server",description="FQDN of the registry.",priority=0
+// +kubebuilder:printcolumn:name="Environment",type="string",JSONPath=".spec.environment",description="Azure cloud the registry is deployed in.",priority=0
+
+// AcrRegistry describes a registry for the AcrPullBindings in its namespace to refer to by name, so that moving the
+// registry only requires editing this object. Credentials for the bindings referring to a registry are re-issued when
+// it changes.
+type AcrRegistry struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AcrRegistrySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AcrRegistryList contains a list of AcrRegistry
+type AcrRegistryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AcrRegistry `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AcrRegistry{}, &AcrRegistryList{})
+}
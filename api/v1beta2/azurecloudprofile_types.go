@@ -0,0 +1,97 @@
+/*
+   MIT License
+
+   Copyright (c) Microsoft Corporation.
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AzureCloudProfileSpec describes the endpoints of an Azure cloud.
+type AzureCloudProfileSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example="https://login.microsoftonline.com/"
+	// +kubebuilder:validation:XValidation:rule="isURL(self) && url(self).getScheme() == 'https'", message="entraAuthorityHost must be an https URL"
+
+	// EntraAuthorityHost is the Entra host identities in the cloud authenticate with.
+	EntraAuthorityHost string `json:"entraAuthorityHost"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example="https://management.azure.com/"
+
+	// ResourceManagerAudience is the audience of Resource Manager in the cloud, for which tokens exchanged with
+	// registries are requested from Entra.
+	ResourceManagerAudience string `json:"resourceManagerAudience"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:example="https://containerregistry.azure.net"
+
+	// ACRAudience is the audience of Azure Container Registry in the cloud. When set, tokens exchanged with
+	// registries are requested for this audience rather than for Resource Manager.
+	ACRAudience string `json:"acrAudience,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +listType=set
+	// +kubebuilder:example={"azurecr.io"}
+
+	// RegistrySuffixes lists the domains of the registries in the cloud. When set, bindings referring to this profile
+	// may only bind to registries under one of these domains.
+	RegistrySuffixes []string `json:"registrySuffixes,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// CABundle holds the PEM certificates to trust, along with the controller's, when connecting to the Entra and
+	// registry endpoints of the cloud.
+	CABundle string `json:"caBundle,omitempty"`
+}
+
+// +kubebuilder:resource:path=azurecloudprofiles,shortName=acp,scope=Cluster
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Authority",type="string",JSONPath=".spec.entraAuthorityHost",description="Entra host of the cloud.",priority=0
+// +kubebuilder:printcolumn:name="Audience",type="string",JSONPath=".spec.resourceManagerAudience",description="Resource Manager audience of the cloud.",priority=1
+
+// AzureCloudProfile describes an Azure cloud, such as an air-gapped one, for AcrPullBindings to refer to by name
+// rather than repeating its endpoints. Credentials for the bindings referring to a profile are re-issued when it
+// changes.
+type AzureCloudProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AzureCloudProfileSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AzureCloudProfileList contains a list of AzureCloudProfile
+type AzureCloudProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AzureCloudProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AzureCloudProfile{}, &AzureCloudProfileList{})
+}
@@ -0,0 +1,131 @@
+/*
+   MIT License
+
+   Copyright (c) Microsoft Corporation.
+
+   Permission is hereby granted, free of charge, to any person obtaining a copy
+   of this software and associated documentation files (the "Software"), to deal
+   in the Software without restriction, including without limitation the rights
+   to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+   copies of the Software, and to permit persons to whom the Software is
+   furnished to do so, subject to the following conditions:
+
+   The above copyright notice and this permission notice shall be included in all
+   copies or substantial portions of the Software.
+
+   THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+   IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+   FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+   AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+   LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+   OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+   SOFTWARE
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:XValidation:rule="has(self.managedIdentity) != has(self.workloadIdentity)", message="exactly one of managedIdentity or workloadIdentity must be set"
+
+// AzureIdentitySpec describes an Entra identity that AcrPullBindings authenticate as.
+type AzureIdentitySpec struct {
+	// +kubebuilder:validation:Optional
+
+	// ManagedIdentity describes a managed identity assigned to the nodes of the controller.
+	ManagedIdentity *ManagedIdentityAuth `json:"managedIdentity,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// WorkloadIdentity describes an identity federated with the service accounts named by the bindings referring to
+	// it, in their workloadIdentity.
+	WorkloadIdentity *FederatedIdentity `json:"workloadIdentity,omitempty"`
+}
+
+// FederatedIdentity identifies an identity federated with a service account.
+type FederatedIdentity struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example="1b461305-28be-5271-beda-bd9fd2e24251"
+
+	// ClientID is the client identifier of the federated identity.
+	ClientID string `json:"clientID"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:example="72f988bf-86f1-41af-91ab-2d7cd011db47"
+
+	// TenantID is the tenant identifier of the federated identity.
+	TenantID string `json:"tenantID"`
+}
+
+// +kubebuilder:resource:path=azureidentities,shortName=azid
+// +kubebuilder:object:root=true
+
+// AzureIdentity describes an identity for the AcrPullBindings in its namespace to refer to by name, so that recreating
+// the identity only requires editing this object. Credentials for the bindings referring to an identity are re-issued
+// when it changes.
+type AzureIdentity struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AzureIdentitySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AzureIdentityList contains a list of AzureIdentity
+type AzureIdentityList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AzureIdentity `json:"items"`
+}
+
+// +kubebuilder:validation:XValidation:rule="has(self.managedIdentity) != has(self.workloadIdentity)", message="exactly one of managedIdentity or workloadIdentity must be set"
+
+// ClusterAzureIdentitySpec describes an Entra identity that AcrPullBindings in a set of namespaces authenticate as.
+type ClusterAzureIdentitySpec struct {
+	// +kubebuilder:validation:Optional
+
+	// ManagedIdentity describes a managed identity assigned to the nodes of the controller.
+	ManagedIdentity *ManagedIdentityAuth `json:"managedIdentity,omitempty"`
+
+	// +kubebuilder:validation:Optional
+
+	// WorkloadIdentity describes an identity federated with the service accounts named by the bindings referring to
+	// it, in their workloadIdentity.
+	WorkloadIdentity *FederatedIdentity `json:"workloadIdentity,omitempty"`
+
+	// +kubebuilder:validation:Required
+
+	// NamespaceSelector chooses the namespaces whose AcrPullBindings may use this identity. An empty selector allows
+	// every namespace.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+}
+
+// +kubebuilder:resource:path=clusterazureidentities,shortName=cazid,scope=Cluster
+// +kubebuilder:object:root=true
+
+// ClusterAzureIdentity describes an identity for AcrPullBindings in the namespaces it selects to refer to by name.
+// Credentials for the bindings referring to an identity are re-issued when it changes.
+type ClusterAzureIdentity struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterAzureIdentitySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterAzureIdentityList contains a list of ClusterAzureIdentity
+type ClusterAzureIdentityList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterAzureIdentity `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AzureIdentity{}, &AzureIdentityList{}, &ClusterAzureIdentity{}, &ClusterAzureIdentityList{})
+}
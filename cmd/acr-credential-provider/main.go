@@ -0,0 +1,79 @@
+// Command acr-credential-provider is a kubelet image credential provider that issues ACR credentials for the managed
+// identities assigned to the node, so that nodes pull from ACR without any pull secrets.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Azure/msi-acrpull/internal/credentialprovider"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+)
+
+func main() {
+	var configPath string
+	var allowedACRServerSuffixesFlag commaSeparatedStringSlice
+	var httpConfig authorizer.HTTPConfig
+	var caBundlePath string
+	flag.StringVar(&configPath, "config", "", "Path to the file mapping registries to the managed identities to pull from them as.")
+	flag.Var(&allowedACRServerSuffixesFlag, "allowed-acr-server-suffixes", "Comma-separated list of ACR server domain suffixes credentials may be issued for. May be specified multiple times. If empty, no ACR server suffix validation is performed.")
+	flag.StringVar(&httpConfig.ProxyURL, "http-proxy", "", "The URL of the proxy to send requests to Entra and ACR through. If empty, the HTTPS_PROXY and HTTP_PROXY environment variables are honored.")
+	flag.StringVar(&httpConfig.NoProxy, "no-proxy", "", "Comma-separated list of hosts, domains and CIDRs to reach without the proxy, in the format of NO_PROXY. If empty, the NO_PROXY environment variable is honored. IMDS is never reached through the proxy.")
+	flag.StringVar(&caBundlePath, "ca-bundle", "", "The path of a file holding PEM certificates to trust, in addition to the system roots, when connecting to Entra and ACR.")
+	flag.Parse()
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "--config is required")
+		os.Exit(1)
+	}
+
+	if caBundlePath != "" {
+		caBundle, err := os.ReadFile(caBundlePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read --ca-bundle: %v\n", err)
+			os.Exit(1)
+		}
+		httpConfig.CABundle = caBundle
+	}
+	if err := authorizer.ConfigureHTTP(httpConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid HTTP configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	config, err := credentialprovider.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	provider := credentialprovider.NewProvider(config, allowedACRServerSuffixesFlag)
+	if err := provider.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		cancel()
+		os.Exit(1)
+	}
+}
+
+type commaSeparatedStringSlice []string
+
+func (values *commaSeparatedStringSlice) String() string {
+	if values == nil {
+		return ""
+	}
+	return strings.Join(*values, ",")
+}
+
+func (values *commaSeparatedStringSlice) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*values = append(*values, item)
+		}
+	}
+	return nil
+}
@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/internal/audit"
 	"github.com/Azure/msi-acrpull/internal/controller"
+	"github.com/Azure/msi-acrpull/internal/sharding"
+	"github.com/Azure/msi-acrpull/internal/tracing"
 	"github.com/Azure/msi-acrpull/pkg/authorizer"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	crclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -24,6 +31,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	msiacrpullv1beta1 "github.com/Azure/msi-acrpull/api/v1beta1"
 	//+kubebuilder:scaffold:imports
@@ -33,6 +41,11 @@ const (
 	defaultACRServerEnvKey                 = "ACR_SERVER"
 	defaultManagedIdentityResourceIDEnvKey = "MANAGED_IDENTITY_RESOURCE_ID"
 	defaultManagedIdentityClientIDEnvKey   = "MANAGED_IDENTITY_CLIENT_ID"
+	podNameEnvKey                          = "POD_NAME"
+	podNamespaceEnvKey                     = "POD_NAMESPACE"
+
+	// tracingShutdownTimeout bounds how long we wait to flush traces on shutdown
+	tracingShutdownTimeout = 5 * time.Second
 )
 
 var (
@@ -55,6 +68,27 @@ func main() {
 	var ttlRotationFraction float64
 	var apbLabelSelectorString string
 	var allowedACRServerSuffixesFlag commaSeparatedStringSlice
+	var watchNamespacesFlag commaSeparatedStringSlice
+	var namespaceSelectorString string
+	var enforcePullPolicies bool
+	var requirePullPolicy bool
+	var enableWebhooks bool
+	var authorizeIdentityUse bool
+	var webhookPort int
+	var webhookCertDir string
+	var identityCheckOpts controller.IdentityCheckOpts
+	var auditLogDestination string
+	var tracingOpts tracing.Opts
+	var shards int
+	var shardLeaseNamespace string
+	var rateLimits authorizer.RateLimits
+	var httpConfig authorizer.HTTPConfig
+	var caBundlePath string
+	var v1beta1MaxConcurrentReconciles int
+	var v1beta2MaxConcurrentReconciles int
+	var verifyPullCredentials bool
+	var enableServiceAccountBindings bool
+	var tokenServiceOpts controller.TokenServiceOpts
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -64,12 +98,93 @@ func main() {
 	flag.Float64Var(&ttlRotationFraction, "ttl-rotation-fraction", 0.5, "The fraction of the pull token's TTL at which the v1beta2 reconciler will refresh the token.")
 	flag.StringVar(&apbLabelSelectorString, "label-selector", "", "Kubernetes label selector used to filter AcrPullBindings (e.g. environment!=prod,tier in (frontend,backend))")
 	flag.Var(&allowedACRServerSuffixesFlag, "allowed-acr-server-suffixes", "Comma-separated list of ACR server domain suffixes the controller may exchange tokens with. May be specified multiple times. If empty, no ACR server suffix validation is performed.")
+	flag.Var(&watchNamespacesFlag, "watch-namespaces", "Comma-separated list of namespaces in which to watch AcrPullBindings, Secrets and ServiceAccounts. May be specified multiple times. If empty, all namespaces are watched.")
+	flag.StringVar(&namespaceSelectorString, "namespace-selector", "", "Kubernetes label selector used to choose the namespaces to watch (e.g. acr.microsoft.com/tenant=team-a). Namespaces are watched while their labels match, and are intersected with --watch-namespaces, if set.")
+	flag.BoolVar(&enforcePullPolicies, "enforce-acr-pull-policies", false, "Restrict AcrPullBindings to the identities, registries and scopes allowed by the AcrPullPolicies selecting their namespace.")
+	flag.BoolVar(&requirePullPolicy, "require-acr-pull-policy", false, "Deny AcrPullBindings in namespaces that no AcrPullPolicy selects. Requires --enforce-acr-pull-policies.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Serve validating admission webhooks for AcrPullBindings.")
+	flag.BoolVar(&authorizeIdentityUse, "authorize-identity-use", false, "Deny AcrPullBindings using managed identities, and AzureIdentities and ClusterAzureIdentities describing them, unless their author may 'use' the identity's managedidentities.acrpull.microsoft.com resource. Requires --enable-webhooks.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port the admission webhook server binds to.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "", "The directory containing the serving certificate and key for the admission webhook server. Defaults to <temp-dir>/k8s-webhook-server/serving-certs.")
+	flag.StringVar(&identityCheckOpts.ManagedIdentityClientID, "identity-health-check-client-id", "", "The client ID of a managed identity for which to fetch an ARM token as part of the readiness check.")
+	flag.StringVar(&identityCheckOpts.ManagedIdentityResourceID, "identity-health-check-resource-id", "", "The resource ID of a managed identity for which to fetch an ARM token as part of the readiness check, if no client ID is set.")
+	flag.StringVar(&identityCheckOpts.AuthorityHost, "identity-health-check-authority-host", "", "An Entra authority host (e.g. https://login.microsoftonline.com/) to check for reachability as part of the readiness check.")
+	flag.StringVar(&auditLogDestination, "audit-log", "", "Where to write a JSON audit record of every pull credential issued: \"stdout\", the path of a file to append to, or an http(s) URL of a collector to POST records to. If empty, no audit records are written.")
+	flag.StringVar(&tracingOpts.Endpoint, "otlp-traces-endpoint", "", "The URL of an OTLP/HTTP endpoint to export traces of reconciliation to (e.g. http://otel-collector:4318/v1/traces). If empty, no traces are exported.")
+	flag.Float64Var(&tracingOpts.SampleRatio, "trace-sample-ratio", 1, "The fraction of reconciliations to trace when exporting traces.")
+	flag.IntVar(&shards, "shards", 0, "The number of shards to hash namespaces into, for replicas to claim through Leases and reconcile in parallel. If zero, sharding is disabled and every replica watches all namespaces. Each replica only caches objects in the namespaces of its shards, opening one watch per kind for each of them. Cannot be combined with --leader-elect.")
+	flag.StringVar(&shardLeaseNamespace, "shard-lease-namespace", os.Getenv(podNamespaceEnvKey), "The namespace holding the Leases used to claim shards. Defaults to the namespace of the pod.")
+	flag.Float64Var(&rateLimits.RegistryQPS, "registry-token-qps", 0, "The sustained rate of token exchanges allowed with each ACR registry, per second. Exchanges over the limit wait for their turn. If zero, exchanges are not limited.")
+	flag.IntVar(&rateLimits.RegistryBurst, "registry-token-burst", 1, "The number of token exchanges allowed with each ACR registry in a burst, when --registry-token-qps is set.")
+	flag.Float64Var(&rateLimits.IdentityQPS, "identity-token-qps", 0, "The sustained rate of token requests allowed from Entra or IMDS for each identity, per second. Requests over the limit wait for their turn. If zero, requests are not limited.")
+	flag.IntVar(&rateLimits.IdentityBurst, "identity-token-burst", 1, "The number of token requests allowed from Entra or IMDS for each identity in a burst, when --identity-token-qps is set.")
+	flag.StringVar(&httpConfig.ProxyURL, "http-proxy", "", "The URL of the proxy to send requests to Entra, IMDS and ACR through (e.g. http://proxy.example.com:3128). If empty, the HTTPS_PROXY and HTTP_PROXY environment variables are honored.")
+	flag.StringVar(&httpConfig.NoProxy, "no-proxy", "", "Comma-separated list of hosts, domains and CIDRs to reach without the proxy, in the format of NO_PROXY. If empty, the NO_PROXY environment variable is honored. IMDS is never reached through the proxy.")
+	flag.StringVar(&caBundlePath, "ca-bundle", "", "The path of a file holding PEM certificates to trust, in addition to the system roots, when connecting to Entra and ACR, such as that of a proxy intercepting TLS.")
+	flag.IntVar(&v1beta1MaxConcurrentReconciles, "v1beta1-max-concurrent-reconciles", 1, "The number of msi-acrpull.microsoft.com/v1beta1 AcrPullBindings to reconcile at once.")
+	flag.IntVar(&v1beta2MaxConcurrentReconciles, "v1beta2-max-concurrent-reconciles", 1, "The number of acrpull.microsoft.com/v1beta2 AcrPullBindings to reconcile at once.")
+	flag.BoolVar(&verifyPullCredentials, "verify-pull-credentials", false, "Present each new acrpull.microsoft.com/v1beta2 pull credential to the registry before it replaces the current one, keeping the current one if the registry does not accept the new one.")
+	flag.BoolVar(&enableServiceAccountBindings, "enable-service-account-bindings", false, "Create an acrpull.microsoft.com/v1beta2 AcrPullBinding for each ServiceAccount annotated with acr.microsoft.com/registry and acr.microsoft.com/scope, authenticating with its workload identity.")
+	flag.StringVar(&tokenServiceOpts.BindAddress, "token-service-bind-address", "", "The address the token service binds to, serving the pull credentials of acrpull.microsoft.com/v1beta2 AcrPullBindings to clients presenting a token for their ServiceAccount. If empty, the token service is disabled.")
+	flag.StringVar(&tokenServiceOpts.CertDir, "token-service-cert-dir", "", "The directory containing the serving certificate and key for the token service. Required when the token service is enabled, unless --token-service-insecure is set.")
+	flag.BoolVar(&tokenServiceOpts.Insecure, "token-service-insecure", false, "Serve the token service over plain HTTP when --token-service-cert-dir is not set, exposing pull credentials and ServiceAccount tokens to the network.")
+	flag.StringVar(&tokenServiceOpts.Audience, "token-service-audience", "acrpull-token-service", "The audience ServiceAccount tokens presented to the token service must be issued for.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	allowedACRServerSuffixes := []string(allowedACRServerSuffixesFlag)
+	if requirePullPolicy && !enforcePullPolicies {
+		fmt.Fprintln(os.Stderr, "--require-acr-pull-policy requires --enforce-acr-pull-policies")
+		os.Exit(1)
+	}
+	if authorizeIdentityUse && !enableWebhooks {
+		fmt.Fprintln(os.Stderr, "--authorize-identity-use requires --enable-webhooks")
+		os.Exit(1)
+	}
+	if rateLimits.RegistryQPS < 0 || rateLimits.IdentityQPS < 0 {
+		fmt.Fprintln(os.Stderr, "--registry-token-qps and --identity-token-qps must not be negative")
+		os.Exit(1)
+	}
+	if v1beta1MaxConcurrentReconciles < 1 || v1beta2MaxConcurrentReconciles < 1 {
+		fmt.Fprintln(os.Stderr, "--v1beta1-max-concurrent-reconciles and --v1beta2-max-concurrent-reconciles must be at least 1")
+		os.Exit(1)
+	}
+	authorizer.SetRateLimits(rateLimits)
+	if caBundlePath != "" {
+		caBundle, err := os.ReadFile(caBundlePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read --ca-bundle: %v\n", err)
+			os.Exit(1)
+		}
+		httpConfig.CABundle = caBundle
+	}
+	if err := authorizer.ConfigureHTTP(httpConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid HTTP configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if tokenServiceOpts.BindAddress != "" && tokenServiceOpts.CertDir == "" && !tokenServiceOpts.Insecure {
+		fmt.Fprintln(os.Stderr, "--token-service-bind-address requires --token-service-cert-dir, or --token-service-insecure to serve plain HTTP")
+		os.Exit(1)
+	}
+	namespaceSelector, err := parseNamespaceSelector(namespaceSelectorString)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --namespace-selector: %v\n", err)
+		os.Exit(1)
+	}
+	if shards < 0 {
+		fmt.Fprintln(os.Stderr, "--shards must not be negative")
+		os.Exit(1)
+	}
+	if shards > 0 && enableLeaderElection {
+		fmt.Fprintln(os.Stderr, "--shards cannot be combined with --leader-elect, as every replica must reconcile its shards")
+		os.Exit(1)
+	}
+	if shards > 0 && shardLeaseNamespace == "" {
+		fmt.Fprintln(os.Stderr, "--shards requires --shard-lease-namespace or the "+podNamespaceEnvKey+" environment variable")
+		os.Exit(1)
+	}
 	defaultACRServer := os.Getenv(defaultACRServerEnvKey)
 	defaultManagedIdentityResourceID := os.Getenv(defaultManagedIdentityResourceIDEnvKey)
 	defaultManagedIdentityClientID := os.Getenv(defaultManagedIdentityClientIDEnvKey)
@@ -83,36 +198,122 @@ func main() {
 		os.Exit(1)
 	}
 
-	var pullBindings msiacrpullv1beta1.AcrPullBindingList
-	if err := client.List(ctx, &pullBindings); err != nil {
-		setupLog.Error(err, "unable to fetch ACRPullBindings")
+	var auditSink audit.Sink
+	if auditLogDestination != "" {
+		auditSink, err = audit.NewSink(auditLogDestination)
+		if err != nil {
+			setupLog.Error(err, "unable to set up audit log")
+			os.Exit(1)
+		}
+	}
+
+	if tracingOpts.Endpoint != "" {
+		shutdownTracing, err := tracing.Setup(ctx, tracingOpts)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+			defer cancel()
+			if err := shutdownTracing(shutdownCtx); err != nil {
+				setupLog.Error(err, "failed to flush traces")
+			}
+		}()
+	}
+
+	namespaces := sets.List(sets.New[string](watchNamespacesFlag...))
+	if len(namespaces) > 0 {
+		setupLog.Info(fmt.Sprintf("restricting informers to namespaces: %s", strings.Join(namespaces, ", ")))
+	}
+	if namespaceSelector != nil {
+		setupLog.Info(fmt.Sprintf("restricting informers to namespaces matching selector: %s", namespaceSelector))
+	}
+	scanned, err := scannedNamespaces(ctx, client, namespaces, namespaceSelector)
+	if err != nil {
+		setupLog.Error(err, "unable to determine namespaces to scan for legacy pull secrets")
 		os.Exit(1)
 	}
 
+	var pullBindings msiacrpullv1beta1.AcrPullBindingList
 	var secrets corev1.SecretList
-	if err := client.List(ctx, &secrets); err != nil {
-		setupLog.Error(err, "unable to fetch Secrets")
-		os.Exit(1)
+	for _, namespace := range scanned {
+		var namespacedPullBindings msiacrpullv1beta1.AcrPullBindingList
+		if err := client.List(ctx, &namespacedPullBindings, crclient.InNamespace(namespace)); err != nil {
+			setupLog.Error(err, "unable to fetch ACRPullBindings")
+			os.Exit(1)
+		}
+		pullBindings.Items = append(pullBindings.Items, namespacedPullBindings.Items...)
+
+		var namespacedSecrets corev1.SecretList
+		if err := client.List(ctx, &namespacedSecrets, crclient.InNamespace(namespace)); err != nil {
+			setupLog.Error(err, "unable to fetch Secrets")
+			os.Exit(1)
+		}
+		secrets.Items = append(secrets.Items, namespacedSecrets.Items...)
 	}
 
 	cleanupRequired := controller.LegacyPullSecretsPresentWithoutLabels(pullBindings, secrets)
 
-	// when we've already cleaned up all legacy secrets, we can filter our
-	// informers to only the set of secrets we create and manage
-	var cacheOpts cache.Options
-	if !cleanupRequired {
-		setupLog.Info(fmt.Sprintf("filtering Secret informers for label %s", controller.ACRPullBindingLabel))
-		requirement, err := labels.NewRequirement(controller.ACRPullBindingLabel, selection.Exists, []string{})
+	// we only need to watch the secrets we create and manage; while legacy secrets remain without labels, the legacy
+	// secret cache serves reads of secrets from an unfiltered informer until cleanup completes
+	requirement, err := labels.NewRequirement(controller.ACRPullBindingLabel, selection.Exists, []string{})
+	if err != nil {
+		setupLog.Error(err, "unable to create label selector")
+		os.Exit(1)
+	}
+	cacheOpts := cache.Options{
+		ByObject: map[crclient.Object]cache.ByObject{
+			&corev1.Secret{}: {
+				Label: labels.NewSelector().Add(*requirement),
+			},
+		},
+	}
+	legacySecretCache := &controller.LegacySecretCache{Logger: ctrl.Log.WithName("cache").WithName("LegacySecrets")}
+	var newCache cache.NewCacheFunc
+	if cleanupRequired {
+		setupLog.Info(fmt.Sprintf("serving Secrets without label %s until legacy token cleanup completes", controller.ACRPullBindingLabel))
+		newCache = legacySecretCache.NewCache
+	}
+
+	var coordinator *sharding.Coordinator
+	var ownsNamespace func(string) bool
+	if shards > 0 {
+		// legacy cleanup counts unlabelled secrets across the whole cluster, which no single shard can see
+		if cleanupRequired {
+			setupLog.Error(nil, "legacy pull secrets without labels remain; run without --shards until legacy token cleanup completes")
+			os.Exit(1)
+		}
+		identity, err := shardIdentity()
 		if err != nil {
-			setupLog.Error(err, "unable to create label selector")
+			setupLog.Error(err, "unable to determine replica identity for sharding")
 			os.Exit(1)
 		}
-		cacheOpts = cache.Options{
-			ByObject: map[crclient.Object]cache.ByObject{
-				&corev1.Secret{}: {
-					Label: labels.NewSelector().Add(*requirement),
-				},
-			},
+		setupLog.Info(fmt.Sprintf("sharding namespaces into %d shards as replica %s", shards, identity))
+		coordinator = &sharding.Coordinator{
+			Client:    client,
+			Logger:    ctrl.Log.WithName("sharding"),
+			Namespace: shardLeaseNamespace,
+			Identity:  identity,
+			Shards:    shards,
+		}
+		ownsNamespace = coordinator.OwnsNamespace
+	}
+	// when sharding or selecting namespaces by label, a cache is run for each namespace we watch, started and stopped as
+	// namespaces come into our shards and match the selector, or leave them
+	if coordinator != nil || namespaceSelector != nil {
+		namespacedCache := sharding.NewCache(coordinator, namespaceSelector, ctrl.Log.WithName("cache").WithName("Namespaced"))
+		if cleanupRequired {
+			legacySecretCache.New = namespacedCache
+		} else {
+			newCache = namespacedCache
+		}
+	}
+
+	if len(namespaces) > 0 {
+		cacheOpts.DefaultNamespaces = make(map[string]cache.Config, len(namespaces))
+		for _, namespace := range namespaces {
+			cacheOpts.DefaultNamespaces[namespace] = cache.Config{}
 		}
 	}
 
@@ -124,9 +325,6 @@ func main() {
 			setupLog.Error(err, "unable to parse label selector for AcrPullBinding")
 			os.Exit(1)
 		}
-		if cacheOpts.ByObject == nil {
-			cacheOpts.ByObject = make(map[crclient.Object]cache.ByObject)
-		}
 		cacheOpts.ByObject[&msiacrpullv1beta1.AcrPullBinding{}] = cache.ByObject{Label: selector}
 		cacheOpts.ByObject[&msiacrpullv1beta2.AcrPullBinding{}] = cache.ByObject{Label: selector}
 	}
@@ -134,8 +332,10 @@ func main() {
 	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                 scheme,
 		Cache:                  cacheOpts,
+		NewCache:               newCache,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
+		WebhookServer:          webhook.NewServer(webhook.Options{Port: webhookPort, CertDir: webhookCertDir}),
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "aks.azure.com",
 	})
@@ -143,13 +343,24 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	credentials := authorizer.NewProvider()
 	apbReconciler := controller.NewV1beta1Reconciler(&controller.V1beta1ReconcilerOpts{
 		CoreOpts: controller.CoreOpts{
 			Client: mgr.GetClient(),
 			Logger: ctrl.Log.WithName("controller").WithName("AcrPullBinding"),
 			Scheme: mgr.GetScheme(),
+			// the webhook server on every replica admits bindings in any namespace, whichever shards it owns
+			APIReader: mgr.GetAPIReader(),
+
+			Credentials:          credentials,
+			AuditSink:            auditSink,
+			EnforcePullPolicies:  enforcePullPolicies,
+			RequirePullPolicy:    requirePullPolicy,
+			AuthorizeIdentityUse: authorizeIdentityUse,
+			OwnsNamespace:        ownsNamespace,
+
+			MaxConcurrentReconciles: v1beta1MaxConcurrentReconciles,
 		},
-		Auth:                             authorizer.NewAuthorizer(),
 		DefaultManagedIdentityResourceID: defaultManagedIdentityResourceID,
 		DefaultManagedIdentityClientID:   defaultManagedIdentityClientID,
 		DefaultACRServer:                 defaultACRServer,
@@ -171,39 +382,105 @@ func main() {
 			Client: mgr.GetClient(),
 			Logger: ctrl.Log.WithName("controller").WithName("AcrPullBindingV1beta2"),
 			Scheme: mgr.GetScheme(),
+			// the webhook server on every replica admits bindings in any namespace, whichever shards it owns
+			APIReader: mgr.GetAPIReader(),
+
+			Credentials:          credentials,
+			AuditSink:            auditSink,
+			EnforcePullPolicies:  enforcePullPolicies,
+			RequirePullPolicy:    requirePullPolicy,
+			AuthorizeIdentityUse: authorizeIdentityUse,
+			OwnsNamespace:        ownsNamespace,
+			Recorder:             mgr.GetEventRecorderFor("acrpull-controller"),
+
+			MaxConcurrentReconciles: v1beta2MaxConcurrentReconciles,
 		},
 		TTLRotationFraction:            ttlRotationFraction,
 		ServiceAccountTokenAudience:    serviceAccountTokenAudience,
 		ServiceAccountClient:           kubeClient.CoreV1(),
+		SecretClient:                   kubeClient.CoreV1(),
+		ConfigMapClient:                kubeClient.CoreV1(),
 		PullBindingLabelSelectorString: apbLabelSelectorString,
 		AllowedACRServerSuffixes:       allowedACRServerSuffixes,
+		VerifyPullCredentials:          verifyPullCredentials,
 	})
 	if err := v1beta2Reconciler.SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AcrPullBindingV1beta2")
 		os.Exit(1)
 	}
 
+	if enableWebhooks {
+		if err := apbReconciler.SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AcrPullBinding")
+			os.Exit(1)
+		}
+		if err := v1beta2Reconciler.SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AcrPullBindingV1beta2")
+			os.Exit(1)
+		}
+	}
+
+	if enableServiceAccountBindings {
+		serviceAccountBindingController := &controller.ServiceAccountBindingController{
+			Client:        mgr.GetClient(),
+			Log:           ctrl.Log.WithName("controllers").WithName("ServiceAccountBinding"),
+			Scheme:        mgr.GetScheme(),
+			Recorder:      mgr.GetEventRecorderFor("acrpull-controller"),
+			OwnsNamespace: ownsNamespace,
+		}
+		if err := serviceAccountBindingController.SetupWithManager(ctx, mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ServiceAccountBinding")
+			os.Exit(1)
+		}
+	}
+
+	if tokenServiceOpts.BindAddress != "" {
+		tokenServiceOpts.Client = mgr.GetClient()
+		// pull secrets carry the label the cache selects Secrets by, so requests are served from the cache; callers may be
+		// in any namespace, so when sharding, those outside of the shards this replica owns are read from the API server
+		tokenServiceOpts.Reader = sharding.UnshardedReader(mgr.GetCache(), mgr.GetAPIReader())
+		tokenServiceOpts.Logger = ctrl.Log.WithName("tokenservice")
+		if err := mgr.Add(controller.NewTokenService(tokenServiceOpts)); err != nil {
+			setupLog.Error(err, "unable to set up token service")
+			os.Exit(1)
+		}
+	}
+
 	if cleanupRequired {
 		setupLog.Info("setting up controller to clean up legacy pull tokens")
 		cleanupController := &controller.LegacyTokenCleanupController{
-			Client: mgr.GetClient(),
-			Log:    ctrl.Log.WithName("controllers").WithName("LegacyTokenCleanup"),
+			Client:            mgr.GetClient(),
+			Log:               ctrl.Log.WithName("controllers").WithName("LegacyTokenCleanup"),
+			OnCleanupComplete: legacySecretCache.CleanupComplete,
 		}
 		if err := cleanupController.SetupWithManager(ctx, mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "LegacyTokenCleanup")
 			os.Exit(1)
 		}
 	}
+	if coordinator != nil {
+		if err := mgr.Add(coordinator); err != nil {
+			setupLog.Error(err, "unable to set up shard coordinator")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	if err := mgr.AddReadyzCheck("readyz", controller.NewCacheSyncCheck(mgr.GetCache())); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if identityCheck := controller.NewIdentityCheck(identityCheckOpts); identityCheck != nil {
+		if err := mgr.AddReadyzCheck("identity", identityCheck); err != nil {
+			setupLog.Error(err, "unable to set up identity check")
+			os.Exit(1)
+		}
+	}
+	controller.ReportLeaderElection(ctx, setupLog, mgr.Elected())
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctx); err != nil {
@@ -212,6 +489,14 @@ func main() {
 	}
 }
 
+// shardIdentity identifies this replica to the others when claiming shards, preferring the pod name
+func shardIdentity() (string, error) {
+	if podName := os.Getenv(podNameEnvKey); podName != "" {
+		return podName, nil
+	}
+	return os.Hostname()
+}
+
 type commaSeparatedStringSlice []string
 
 func (values *commaSeparatedStringSlice) String() string {
@@ -236,3 +521,48 @@ func commaSeparatedValues(value string) []string {
 	}
 	return values
 }
+
+// parseNamespaceSelector parses the label selector choosing the namespaces to watch, if one is provided
+func parseNamespaceSelector(selectorString string) (labels.Selector, error) {
+	trimmedSelector := strings.TrimSpace(selectorString)
+	if trimmedSelector == "" {
+		return nil, nil
+	}
+	selector, err := labels.Parse(trimmedSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse namespace selector %q: %w", trimmedSelector, err)
+	}
+	return selector, nil
+}
+
+// scannedNamespaces determines the namespaces to scan for legacy pull secrets at startup, from an explicit list of
+// namespaces and a namespace label selector. When neither is provided, the whole cluster is scanned. With a selector,
+// the namespaces matching it at startup are scanned, which may be none; when both are provided, only explicitly-listed
+// namespaces matching the selector are scanned.
+func scannedNamespaces(ctx context.Context, client crclient.Client, explicit []string, selector labels.Selector) ([]string, error) {
+	namespaces := sets.New[string](explicit...)
+	if selector == nil {
+		return namespacesOrAll(sets.List(namespaces)), nil
+	}
+
+	var namespaceList corev1.NamespaceList
+	if err := client.List(ctx, &namespaceList, crclient.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	selected := sets.New[string]()
+	for _, namespace := range namespaceList.Items {
+		if namespaces.Len() == 0 || namespaces.Has(namespace.Name) {
+			selected.Insert(namespace.Name)
+		}
+	}
+	return sets.List(selected), nil
+}
+
+// namespacesOrAll returns the namespaces to list objects in, falling back to all namespaces when none are configured.
+func namespacesOrAll(namespaces []string) []string {
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return namespaces
+}
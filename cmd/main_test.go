@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"reflect"
 	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestCommaSeparatedValues(t *testing.T) {
@@ -56,3 +61,69 @@ func TestCommaSeparatedStringSliceFlag(t *testing.T) {
 		t.Fatalf("expected %#v, got %#v", want, []string(values))
 	}
 }
+
+func TestScannedNamespaces(t *testing.T) {
+	namespaces := []corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tenant": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-a-staging", Labels: map[string]string{"tenant": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tenant": "b"}}},
+	}
+
+	testCases := []struct {
+		name     string
+		explicit []string
+		selector string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name: "nothing configured scans the whole cluster",
+			want: []string{""},
+		},
+		{
+			name:     "explicit namespaces are de-duplicated and sorted",
+			explicit: []string{"team-b", "team-a", "team-b"},
+			want:     []string{"team-a", "team-b"},
+		},
+		{
+			name:     "selector chooses labelled namespaces",
+			selector: "tenant=a",
+			want:     []string{"team-a", "team-a-staging"},
+		},
+		{
+			name:     "selector is intersected with explicit namespaces",
+			explicit: []string{"team-a", "team-b"},
+			selector: "tenant=a",
+			want:     []string{"team-a"},
+		},
+		{
+			name:     "selector matching nothing scans nothing, as namespaces may match it later",
+			selector: "tenant=c",
+		},
+		{
+			name:     "invalid selector is an error",
+			selector: "tenant in (",
+			wantErr:  true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			for i := range namespaces {
+				builder = builder.WithObjects(&namespaces[i])
+			}
+			selector, err := parseNamespaceSelector(testCase.selector)
+			if err == nil {
+				var got []string
+				got, err = scannedNamespaces(context.Background(), builder.Build(), testCase.explicit, selector)
+				if err == nil && (len(got) != 0 || len(testCase.want) != 0) && !reflect.DeepEqual(got, testCase.want) {
+					t.Fatalf("expected %#v, got %#v", testCase.want, got)
+				}
+			}
+			if testCase.wantErr != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", testCase.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+{{- /*
+Pull bindings are only admitted in the namespaces the controller watches, as it has no permission to read the objects
+they refer to elsewhere, and would never reconcile them.
+*/ -}}
+{{- define "acrpull.webhookNamespaceSelector" }}
+{{- with .Values.watchNamespaces }}
+    namespaceSelector:
+      matchExpressions:
+        - key: kubernetes.io/metadata.name
+          operator: In
+          values: {{ toJson . }}
+{{- end }}
+{{- end }}
@@ -1,4 +1,5 @@
-package controller
+// Package acrserver validates the registry servers credentials are issued for.
+package acrserver
 
 import (
 	"fmt"
@@ -7,7 +8,9 @@ import (
 	"strings"
 )
 
-func validateACRServerSuffix(acrServer string, allowedSuffixes []string) error {
+// ValidateSuffix checks that the ACR server is a host name under one of the allowed domain suffixes; any server is
+// allowed when there are none.
+func ValidateSuffix(acrServer string, allowedSuffixes []string) error {
 	allowedSuffixes = normalizeACRServerSuffixes(allowedSuffixes)
 	if len(allowedSuffixes) == 0 {
 		return nil
@@ -1,11 +1,11 @@
-package controller
+package acrserver
 
 import (
 	"strings"
 	"testing"
 )
 
-func Test_validateACRServerSuffix(t *testing.T) {
+func TestValidateSuffix(t *testing.T) {
 	for _, testCase := range []struct {
 		name            string
 		acrServer       string
@@ -46,7 +46,7 @@ func Test_validateACRServerSuffix(t *testing.T) {
 		},
 	} {
 		t.Run(testCase.name, func(t *testing.T) {
-			err := validateACRServerSuffix(testCase.acrServer, testCase.allowedSuffixes)
+			err := ValidateSuffix(testCase.acrServer, testCase.allowedSuffixes)
 			if testCase.wantErr == "" {
 				if err != nil {
 					t.Fatalf("expected no error, got %v", err)
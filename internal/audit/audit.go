@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuthMethodManagedIdentity  = "managedIdentity"
+	AuthMethodWorkloadIdentity = "workloadIdentity"
+	AuthMethodClientToken      = "clientToken"
+
+	// webhookTimeout bounds how long delivering a record to a collector may take
+	webhookTimeout = 5 * time.Second
+)
+
+// Record describes a registry credential issued for a pull binding. Records must never contain credentials.
+type Record struct {
+	Time time.Time `json:"time"`
+
+	BindingAPIVersion string `json:"bindingAPIVersion"`
+	BindingNamespace  string `json:"bindingNamespace"`
+	BindingName       string `json:"bindingName"`
+	BindingUID        string `json:"bindingUID"`
+	// ServiceAccount is the service account the pull credential is attached to
+	ServiceAccount string `json:"serviceAccount"`
+
+	AuthMethod string `json:"authMethod"`
+	ClientID   string `json:"clientID,omitempty"`
+	ResourceID string `json:"resourceID,omitempty"`
+	TenantID   string `json:"tenantID,omitempty"`
+	// TokenName is the name of the registry client token used, for client token authentication
+	TokenName string `json:"tokenName,omitempty"`
+
+	Server string `json:"server"`
+	Scope  string `json:"scope,omitempty"`
+
+	// TokenID and ExpiresOn are the jti and exp claims of the issued registry token
+	TokenID   string    `json:"tokenID,omitempty"`
+	ExpiresOn time.Time `json:"expiresOn"`
+
+	// ServiceAccountToken describes the service account token minted to authenticate a workload identity, if any
+	ServiceAccountToken *ServiceAccountToken `json:"serviceAccountToken,omitempty"`
+}
+
+// ServiceAccountToken describes a service account token minted to issue a registry credential
+type ServiceAccountToken struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Audiences []string  `json:"audiences,omitempty"`
+	TokenID   string    `json:"tokenID,omitempty"`
+	ExpiresOn time.Time `json:"expiresOn"`
+}
+
+// Sink receives audit records
+type Sink interface {
+	Emit(ctx context.Context, record Record) error
+}
+
+// NewSink builds a sink for the destination: "stdout", an http:// or https:// URL of a collector to POST records to,
+// or the path of a file to append records to
+func NewSink(destination string) (Sink, error) {
+	switch {
+	case destination == "stdout":
+		return &writerSink{writer: os.Stdout}, nil
+	case strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "https://"):
+		return &webhookSink{endpoint: destination, client: &http.Client{Timeout: webhookTimeout}}, nil
+	case destination != "":
+		file, err := os.OpenFile(destination, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		return &writerSink{writer: file}, nil
+	default:
+		return nil, fmt.Errorf("audit log destination is empty")
+	}
+}
+
+// writerSink writes records as JSON lines
+type writerSink struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+func (s *writerSink) Emit(_ context.Context, record Record) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := s.writer.Write(append(encoded, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// webhookSink POSTs each record as JSON to a collector
+type webhookSink struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (s *webhookSink) Emit(ctx context.Context, record Record) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to build audit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send audit record: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to send audit record: unexpected status %s", resp.Status)
+	}
+	return nil
+}
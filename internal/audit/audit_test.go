@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testRecord() Record {
+	return Record{
+		Time:              time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		BindingAPIVersion: "acrpull.microsoft.com/v1beta2",
+		BindingNamespace:  "ns",
+		BindingName:       "binding",
+		BindingUID:        "uid",
+		ServiceAccount:    "delegate",
+		AuthMethod:        AuthMethodWorkloadIdentity,
+		ClientID:          "client-id",
+		TenantID:          "tenant-id",
+		Server:            "registry.azurecr.io",
+		Scope:             "repository:testing:pull",
+		TokenID:           "jti",
+		ExpiresOn:         time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC),
+		ServiceAccountToken: &ServiceAccountToken{
+			Namespace: "ns",
+			Name:      "delegate",
+			Audiences: []string{"api://AzureCRTokenExchange"},
+			TokenID:   "sa-jti",
+			ExpiresOn: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewSink(path)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	for range 2 {
+		if err := sink.Emit(context.Background(), testRecord()); err != nil {
+			t.Fatalf("failed to emit record: %v", err)
+		}
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %d: %s", len(lines), contents)
+	}
+	for _, line := range lines {
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("failed to decode record: %v", err)
+		}
+		if diff := cmp.Diff(testRecord(), record); diff != "" {
+			t.Errorf("unexpected record (-want, +got):\n%s", diff)
+		}
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []Record
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read body: %v", err)
+		}
+		var record Record
+		if err := json.Unmarshal(body, &record); err != nil {
+			t.Errorf("failed to decode record: %v", err)
+		}
+		received = append(received, record)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := sink.Emit(context.Background(), testRecord()); err != nil {
+		t.Fatalf("failed to emit record: %v", err)
+	}
+	if diff := cmp.Diff([]Record{testRecord()}, received); diff != "" {
+		t.Errorf("unexpected records (-want, +got):\n%s", diff)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Emit(context.Background(), testRecord()); err == nil {
+		t.Errorf("expected an error when the collector fails")
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	if _, err := NewSink(""); err == nil {
+		t.Errorf("expected an error for an empty destination")
+	}
+	if sink, err := NewSink("stdout"); err != nil || sink == nil {
+		t.Errorf("expected a stdout sink, got %v, %v", sink, err)
+	}
+	if _, err := NewSink(filepath.Join(t.TempDir(), "missing", "audit.log")); err == nil {
+		t.Errorf("expected an error for a file in a missing directory")
+	}
+}
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+//+kubebuilder:rbac:groups=acrpull.microsoft.com,resources=acrpullpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// pullPolicyRequest captures the inputs of a pull binding that AcrPullPolicies restrict
+type pullPolicyRequest struct {
+	// clientID and resourceID identify the Azure identity used by the binding; both are empty when the identity is
+	// determined by workload identity annotations on a service account
+	clientID   string
+	resourceID string
+	server     string
+	scope      string
+	// authHost is the host of the token service the identity token is sent to, when it is not the registry itself
+	authHost string
+}
+
+// pullPolicies holds the AcrPullPolicies that may apply to pull bindings in a namespace
+type pullPolicies struct {
+	namespace *corev1.Namespace
+	policies  []msiacrpullv1beta2.AcrPullPolicy
+	// required denies bindings in namespaces that no policy selects
+	required bool
+}
+
+// policyViolationError is returned when a pull binding does not comply with the AcrPullPolicies for its namespace
+type policyViolationError struct {
+	message string
+}
+
+func (e *policyViolationError) Error() string {
+	return e.message
+}
+
+// fetchPullPolicies gathers the inputs required to evaluate AcrPullPolicies for pull bindings in a namespace
+func fetchPullPolicies(ctx context.Context, client crclient.Reader, namespace string, required bool) (*pullPolicies, error) {
+	ns := &corev1.Namespace{}
+	if err := client.Get(ctx, crclient.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("failed to get namespace: %w", err)
+	}
+
+	var policies msiacrpullv1beta2.AcrPullPolicyList
+	if err := client.List(ctx, &policies); err != nil {
+		return nil, fmt.Errorf("failed to list pull policies: %w", err)
+	}
+
+	return &pullPolicies{
+		namespace: ns,
+		policies:  policies.Items,
+		required:  required,
+	}, nil
+}
+
+// admit determines if the request is allowed by the policies that select the namespace. A binding is allowed if it
+// complies with any policy selecting its namespace. When no policy selects the namespace, the binding is allowed
+// unless policies are required. A nil receiver allows everything.
+func (p *pullPolicies) admit(request pullPolicyRequest) error {
+	if p == nil {
+		return nil
+	}
+
+	var selecting []msiacrpullv1beta2.AcrPullPolicy
+	for _, policy := range p.policies {
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.NamespaceSelector)
+		if err != nil {
+			// an invalid selector can't select anything, but we should not let it open up access
+			continue
+		}
+		if selector.Matches(labels.Set(p.namespace.Labels)) {
+			selecting = append(selecting, policy)
+		}
+	}
+
+	if len(selecting) == 0 {
+		if p.required {
+			return &policyViolationError{message: fmt.Sprintf("no AcrPullPolicy selects namespace %q", p.namespace.Name)}
+		}
+		return nil
+	}
+
+	slices.SortFunc(selecting, func(a, b msiacrpullv1beta2.AcrPullPolicy) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	var violations []string
+	for _, policy := range selecting {
+		violation := policyViolation(policy.Spec, request)
+		if violation == "" {
+			return nil
+		}
+		violations = append(violations, fmt.Sprintf("%s: %s", policy.Name, violation))
+	}
+	return &policyViolationError{message: fmt.Sprintf("binding does not comply with any AcrPullPolicy selecting namespace %q: %s", p.namespace.Name, strings.Join(violations, "; "))}
+}
+
+// policyViolation describes how the request violates the policy, returning an empty string for compliant requests
+func policyViolation(spec msiacrpullv1beta2.AcrPullPolicySpec, request pullPolicyRequest) string {
+	// workload identities configured through service account annotations are not restricted here, as Entra will
+	// only issue tokens for identities federated with that service account
+	if len(spec.AllowedIdentities) > 0 && (request.clientID != "" || request.resourceID != "") {
+		if !slices.ContainsFunc(spec.AllowedIdentities, func(identity msiacrpullv1beta2.AllowedIdentity) bool {
+			return (request.clientID != "" && strings.EqualFold(identity.ClientID, request.clientID)) ||
+				(request.resourceID != "" && identity.ResourceID != "" && strings.EqualFold(path.Clean(identity.ResourceID), path.Clean(request.resourceID)))
+		}) {
+			identity := request.clientID
+			if identity == "" {
+				identity = request.resourceID
+			}
+			return fmt.Sprintf("identity %q is not allowed", identity)
+		}
+	}
+
+	if len(spec.AllowedRegistries) > 0 && !matchesAnyPattern(spec.AllowedRegistries, strings.ToLower(request.server)) {
+		return fmt.Sprintf("registry %q is not allowed", request.server)
+	}
+	if len(spec.AllowedRegistries) > 0 && request.authHost != "" && !matchesAnyPattern(spec.AllowedRegistries, request.authHost) {
+		return fmt.Sprintf("auth endpoint host %q is not allowed", request.authHost)
+	}
+
+	if len(spec.AllowedScopes) > 0 {
+		scopes := strings.Fields(request.scope)
+		if len(scopes) == 0 {
+			return "unscoped tokens are not allowed"
+		}
+		for _, scope := range scopes {
+			if !matchesAnyPattern(spec.AllowedScopes, scope) {
+				return fmt.Sprintf("scope %q is not allowed", scope)
+			}
+		}
+	}
+
+	return ""
+}
+
+func matchesAnyPattern(patterns []string, value string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		return matchesPattern(pattern, value)
+	})
+}
+
+// matchesPattern matches a value against a path.Match pattern, extended so that ** matches any sequence of
+// characters including /, since * alone cannot match the nested repositories registries commonly use
+func matchesPattern(pattern, value string) bool {
+	if !strings.Contains(pattern, "**") {
+		matched, err := path.Match(pattern, value)
+		return err == nil && matched
+	}
+	// path.Match only reports malformed patterns while matching, so check the pattern up front to reject it the
+	// same way regardless of the value
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return false
+	}
+	expression, err := regexp.Compile("^" + patternExpression(pattern) + "$")
+	if err != nil {
+		return false
+	}
+	return expression.MatchString(value)
+}
+
+// patternExpression translates a well-formed path.Match pattern, extended with **, into a regular expression
+func patternExpression(pattern string) string {
+	var expression strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				for i+1 < len(pattern) && pattern[i+1] == '*' {
+					i++
+				}
+				expression.WriteString(".*")
+			} else {
+				expression.WriteString("[^/]*")
+			}
+		case '?':
+			expression.WriteString("[^/]")
+		case '\\':
+			i++
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			expression.WriteByte('[')
+			i++
+			if pattern[i] == '^' {
+				expression.WriteByte('^')
+				i++
+			}
+			for ; pattern[i] != ']'; i++ {
+				switch pattern[i] {
+				case '\\':
+					i++
+					expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+				case '[':
+					expression.WriteString(`\[`)
+				default:
+					expression.WriteByte(pattern[i])
+				}
+			}
+			expression.WriteByte(']')
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expression.String()
+}
+
+// policyCompliantCondition records the outcome of evaluating pull policies for a binding
+func policyCompliantCondition(err error, generation int64, now func() time.Time) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               msiacrpullv1beta2.ConditionTypePolicyCompliant,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		LastTransitionTime: metav1.NewTime(now()),
+		Reason:             msiacrpullv1beta2.ConditionReasonPolicyCompliant,
+		Message:            "binding complies with AcrPullPolicies",
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = msiacrpullv1beta2.ConditionReasonPolicyViolation
+		condition.Message = err.Error()
+	}
+	return condition
+}
+
+// enqueuePullBindings lists pull bindings into the list and returns requests for each of them
+func enqueuePullBindings(ctx context.Context, client crclient.Client, list crclient.ObjectList, opts ...crclient.ListOption) []reconcile.Request {
+	if err := client.List(ctx, list, opts...); err != nil {
+		return nil
+	}
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, item := range items {
+		if object, ok := item.(crclient.Object); ok {
+			requests = append(requests, reconcile.Request{NamespacedName: crclient.ObjectKeyFromObject(object)})
+		}
+	}
+	return requests
+}
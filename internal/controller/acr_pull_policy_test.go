@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_pullPolicies_admit(t *testing.T) {
+	teamA := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tenant": "a"}}}
+	teamB := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tenant": "b"}}}
+
+	teamAPolicy := msiacrpullv1beta2.AcrPullPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+		Spec: msiacrpullv1beta2.AcrPullPolicySpec{
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+			AllowedIdentities: []msiacrpullv1beta2.AllowedIdentity{
+				{ClientID: "team-a-client-id"},
+				{ResourceID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/team-a"},
+			},
+			AllowedRegistries: []string{"team-a.azurecr.io"},
+			AllowedScopes:     []string{"repository:team-a/*:pull"},
+		},
+	}
+	nestedPolicy := *teamAPolicy.DeepCopy()
+	nestedPolicy.Spec.AllowedScopes = []string{"repository:team-a/**:pull"}
+	sharedPolicy := msiacrpullv1beta2.AcrPullPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+		Spec: msiacrpullv1beta2.AcrPullPolicySpec{
+			AllowedRegistries: []string{"shared.azurecr.io"},
+			AllowedScopes:     []string{"repository:base/*:pull"},
+		},
+	}
+
+	for _, testCase := range []struct {
+		name     string
+		policies *pullPolicies
+		request  pullPolicyRequest
+		wantErr  string
+	}{
+		{
+			name:    "no policies allows everything",
+			request: pullPolicyRequest{clientID: "anything", server: "anywhere.azurecr.io"},
+		},
+		{
+			name:     "namespace not selected by any policy is allowed",
+			policies: &pullPolicies{namespace: teamB, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io", scope: "repository:team-a/app:pull"},
+		},
+		{
+			name:     "namespace not selected by any policy is denied when policies are required",
+			policies: &pullPolicies{namespace: teamB, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}, required: true},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io", scope: "repository:team-a/app:pull"},
+			wantErr:  `no AcrPullPolicy selects namespace "team-b"`,
+		},
+		{
+			name:     "compliant client ID is allowed",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "TEAM-A-CLIENT-ID", server: "team-a.azurecr.io", scope: "repository:team-a/app:pull repository:team-a/sidecar:pull"},
+		},
+		{
+			name:     "compliant resource ID is allowed",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{resourceID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/team-a/", server: "team-a.azurecr.io", scope: "repository:team-a/app:pull"},
+		},
+		{
+			name:     "workload identity from service account annotations is not restricted by identity",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{server: "team-a.azurecr.io", scope: "repository:team-a/app:pull"},
+		},
+		{
+			name:     "other team's identity is denied",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-b-client-id", server: "team-a.azurecr.io", scope: "repository:team-a/app:pull"},
+			wantErr:  `binding does not comply with any AcrPullPolicy selecting namespace "team-a": team-a: identity "team-b-client-id" is not allowed`,
+		},
+		{
+			name:     "other registry is denied",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-b.azurecr.io", scope: "repository:team-a/app:pull"},
+			wantErr:  `team-a: registry "team-b.azurecr.io" is not allowed`,
+		},
+		{
+			name:     "auth endpoint on an allowed registry host is allowed",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io", scope: "repository:team-a/app:pull", authHost: "team-a.azurecr.io"},
+		},
+		{
+			name:     "auth endpoint on another host is denied",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io", scope: "repository:team-a/app:pull", authHost: "auth.attacker.example.com"},
+			wantErr:  `team-a: auth endpoint host "auth.attacker.example.com" is not allowed`,
+		},
+		{
+			name:     "push scope is denied",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io", scope: "repository:team-a/app:pull repository:team-a/app:pull,push"},
+			wantErr:  `team-a: scope "repository:team-a/app:pull,push" is not allowed`,
+		},
+		{
+			name:     "nested repository is denied by a single-segment wildcard",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io", scope: "repository:team-a/app/frontend:pull"},
+			wantErr:  `team-a: scope "repository:team-a/app/frontend:pull" is not allowed`,
+		},
+		{
+			name:     "nested repository is allowed by a recursive wildcard",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{nestedPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io", scope: "repository:team-a/app/frontend:pull repository:team-a/app:pull"},
+		},
+		{
+			name:     "recursive wildcard does not match outside its prefix",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{nestedPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io", scope: "repository:team-b/app/frontend:pull"},
+			wantErr:  `team-a: scope "repository:team-b/app/frontend:pull" is not allowed`,
+		},
+		{
+			name:     "unscoped token is denied when scopes are restricted",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-a.azurecr.io"},
+			wantErr:  `team-a: unscoped tokens are not allowed`,
+		},
+		{
+			name:     "binding complying with any selecting policy is allowed",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{teamAPolicy, sharedPolicy}},
+			request:  pullPolicyRequest{clientID: "team-b-client-id", server: "shared.azurecr.io", scope: "repository:base/debian:pull"},
+		},
+		{
+			name:     "violations of every selecting policy are reported",
+			policies: &pullPolicies{namespace: teamA, policies: []msiacrpullv1beta2.AcrPullPolicy{sharedPolicy, teamAPolicy}},
+			request:  pullPolicyRequest{clientID: "team-a-client-id", server: "team-b.azurecr.io", scope: "repository:team-a/app:pull"},
+			wantErr:  `binding does not comply with any AcrPullPolicy selecting namespace "team-a": shared: registry "team-b.azurecr.io" is not allowed; team-a: registry "team-b.azurecr.io" is not allowed`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.policies.admit(testCase.request)
+			if testCase.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error containing %q", testCase.wantErr)
+			}
+			if _, ok := err.(*policyViolationError); !ok {
+				t.Fatalf("expected a policy violation, got %T", err)
+			}
+			if got := err.Error(); !strings.Contains(got, testCase.wantErr) {
+				t.Fatalf("expected error containing %q, got %q", testCase.wantErr, got)
+			}
+		})
+	}
+}
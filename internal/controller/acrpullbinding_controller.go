@@ -11,8 +11,12 @@ import (
 	"time"
 
 	msiacrpullv1beta1 "github.com/Azure/msi-acrpull/api/v1beta1"
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/internal/acrserver"
+	"github.com/Azure/msi-acrpull/internal/audit"
 	"github.com/Azure/msi-acrpull/pkg/authorizer"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -20,6 +24,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -34,6 +39,8 @@ const (
 	tokenRefreshAnnotation = "acr.microsoft.com/token.refresh"
 	// tokenInputsAnnotation is an annotation on Secrets that records the inputs that were used to create the pull credential, for change detection
 	tokenInputsAnnotation = "acr.microsoft.com/token.inputs"
+	// tokenGrantedScopeAnnotation is an annotation on Secrets that records the access the registry granted in the pull credential, if known
+	tokenGrantedScopeAnnotation = "acr.microsoft.com/token.granted-scope"
 
 	ownerKey                  = ".metadata.controller"
 	dockerConfigKey           = ".dockerconfigjson"
@@ -47,7 +54,6 @@ const (
 type V1beta1ReconcilerOpts struct {
 	CoreOpts
 
-	Auth                             authorizer.Interface
 	DefaultManagedIdentityResourceID string
 	DefaultManagedIdentityClientID   string
 	DefaultACRServer                 string
@@ -59,12 +65,19 @@ func NewV1beta1Reconciler(opts *V1beta1ReconcilerOpts) *AcrPullBindingReconciler
 	if opts.now == nil {
 		opts.now = time.Now
 	}
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = otel.GetTracerProvider()
+	}
+	if opts.Credentials == nil {
+		opts.Credentials = authorizer.NewProvider()
+	}
 
 	return &AcrPullBindingReconciler{
 		&genericReconciler[*msiacrpullv1beta1.AcrPullBinding]{
-			Client: opts.Client,
-			Logger: opts.Logger,
-			Scheme: opts.Scheme,
+			Client:    opts.Client,
+			APIReader: opts.APIReader,
+			Logger:    opts.Logger,
+			Scheme:    opts.Scheme,
 			NewBinding: func() *msiacrpullv1beta1.AcrPullBinding {
 				return &msiacrpullv1beta1.AcrPullBinding{}
 			},
@@ -90,27 +103,61 @@ func NewV1beta1Reconciler(opts *V1beta1ReconcilerOpts) *AcrPullBindingReconciler
 			GetPullSecretName: func(binding *msiacrpullv1beta1.AcrPullBinding) string {
 				return legacySecretName(binding.Name)
 			},
-			GetInputsHash: func(binding *msiacrpullv1beta1.AcrPullBinding) string {
+			GetInputsHash: func(binding *msiacrpullv1beta1.AcrPullBinding, _ *bindingReferences) string {
 				msiClientID, msiResourceID, acrServer := specOrDefault(opts, binding.Spec)
 				return base36sha224([]byte(msiClientID + msiResourceID + acrServer + binding.Spec.Scope))
 			},
-			ValidateBinding: func(binding *msiacrpullv1beta1.AcrPullBinding) error {
-				_, _, acrServer := specOrDefault(opts, binding.Spec)
-				return validateACRServerSuffix(acrServer, opts.AllowedACRServerSuffixes)
+			ValidateBinding: func(binding *msiacrpullv1beta1.AcrPullBinding, _ *bindingReferences, policies *pullPolicies) error {
+				msiClientID, msiResourceID, acrServer := specOrDefault(opts, binding.Spec)
+				if err := acrserver.ValidateSuffix(acrServer, opts.AllowedACRServerSuffixes); err != nil {
+					return err
+				}
+				return policies.admit(pullPolicyRequest{
+					clientID:   msiClientID,
+					resourceID: msiResourceID,
+					server:     acrServer,
+					scope:      binding.Spec.Scope,
+				})
+			},
+			GetManagedIdentity: func(binding *msiacrpullv1beta1.AcrPullBinding) (string, string) {
+				msiClientID, msiResourceID, _ := specOrDefault(opts, binding.Spec)
+				return msiClientID, msiResourceID
 			},
-			CreatePullCredential: func(ctx context.Context, binding *msiacrpullv1beta1.AcrPullBinding, serviceAccount *corev1.ServiceAccount) (string, time.Time, error) {
+			CreatePullCredential: func(ctx context.Context, binding *msiacrpullv1beta1.AcrPullBinding, _ *bindingReferences, serviceAccount *corev1.ServiceAccount) (*pullCredential, error) {
 				msiClientID, msiResourceID, acrServer := specOrDefault(opts, binding.Spec)
-				acrAccessToken, err := opts.Auth.AcquireACRAccessToken(ctx, msiResourceID, msiClientID, acrServer, binding.Spec.Scope)
+				if msiClientID == "" && msiResourceID == "" {
+					return nil, fmt.Errorf("failed to retrieve ACR access token: either a client ID or a resource ID is required")
+				}
+				acrCredential, err := opts.Credentials.Credential(ctx, &authorizer.CredentialRequest{
+					Method:     authorizer.AuthMethodManagedIdentity,
+					ClientID:   msiClientID,
+					ResourceID: msiResourceID,
+					Cloud:      authorizer.LegacyCloud(),
+					Registry:   acrServer,
+					Scope:      binding.Spec.Scope,
+				})
 				if err != nil {
-					return "", time.Time{}, fmt.Errorf("failed to retrieve ACR access token: %w", err)
+					return nil, fmt.Errorf("failed to retrieve ACR access token: %w", err)
 				}
 
-				dockerConfig, err := authorizer.CreateACRDockerCfg(acrServer, acrAccessToken)
+				dockerConfig, err := acrCredential.DockerConfig()
 				if err != nil {
-					return "", time.Time{}, fmt.Errorf("failed to write ACR dockercfg: %v", err)
+					return nil, fmt.Errorf("failed to write ACR dockercfg: %v", err)
 				}
 
-				return dockerConfig, acrAccessToken.ExpiresOn, nil
+				record := audit.Record{
+					BindingAPIVersion: msiacrpullv1beta1.GroupVersion.String(),
+					AuthMethod:        audit.AuthMethodManagedIdentity,
+					ClientID:          msiClientID,
+					Server:            acrServer,
+					Scope:             binding.Spec.Scope,
+					TokenID:           acrCredential.TokenID,
+				}
+				if msiClientID == "" {
+					// the client ID takes precedence, so the resource ID is only used without one
+					record.ResourceID = msiResourceID
+				}
+				return &pullCredential{dockerConfig: dockerConfig, expiresOn: acrCredential.Token.ExpiresOn, audit: record}, nil
 			},
 			UpdateStatusError: func(binding *msiacrpullv1beta1.AcrPullBinding, s string) *msiacrpullv1beta1.AcrPullBinding {
 				updated := binding.DeepCopy()
@@ -143,7 +190,15 @@ func NewV1beta1Reconciler(opts *V1beta1ReconcilerOpts) *AcrPullBindingReconciler
 			LabelSelector: func() (labels.Selector, error) {
 				return acrPullBindingLabelSelector(opts.PullBindingLabelSelectorString)
 			},
-			now: opts.now,
+			AuditSink:               opts.AuditSink,
+			EnforcePullPolicies:     opts.EnforcePullPolicies,
+			RequirePullPolicy:       opts.RequirePullPolicy,
+			AuthorizeIdentityUse:    opts.AuthorizeIdentityUse,
+			Tracer:                  opts.TracerProvider.Tracer(tracerName),
+			Recorder:                opts.Recorder,
+			OwnsNamespace:           opts.OwnsNamespace,
+			MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
+			now:                     opts.now,
 		},
 	}
 }
@@ -250,12 +305,22 @@ func (r *AcrPullBindingReconciler) SetupWithManager(ctx context.Context, mgr ctr
 		return err
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&msiacrpullv1beta1.AcrPullBinding{}).
 		Named("acr-pull-binding").
+		WithOptions(crcontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(enqueuePullBindingsForPullSecret(mgr))).
-		Watches(&corev1.ServiceAccount{}, handler.EnqueueRequestsFromMapFunc(enqueuePullBindingsForServiceAccount(mgr))).
-		Complete(r)
+		Watches(&corev1.ServiceAccount{}, handler.EnqueueRequestsFromMapFunc(enqueuePullBindingsForServiceAccount(mgr)))
+	if r.EnforcePullPolicies {
+		builder = builder.
+			Watches(&msiacrpullv1beta2.AcrPullPolicy{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, _ client.Object) []reconcile.Request {
+				return enqueuePullBindings(ctx, mgr.GetClient(), &msiacrpullv1beta1.AcrPullBindingList{})
+			})).
+			Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, object client.Object) []reconcile.Request {
+				return enqueuePullBindings(ctx, mgr.GetClient(), &msiacrpullv1beta1.AcrPullBindingList{}, client.InNamespace(object.GetName()))
+			}))
+	}
+	return builder.Complete(r)
 }
 
 func indexPullSecretByPullBinding(object client.Object) []string {
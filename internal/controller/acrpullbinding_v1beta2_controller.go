@@ -3,22 +3,32 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	azworkloadidentity "github.com/Azure/azure-workload-identity/pkg/webhook"
 	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/internal/acrserver"
+	"github.com/Azure/msi-acrpull/internal/audit"
+	"github.com/Azure/msi-acrpull/internal/tracing"
 	"github.com/Azure/msi-acrpull/pkg/authorizer"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -28,12 +38,43 @@ type CoreOpts struct {
 	Logger logr.Logger
 	Scheme *runtime.Scheme
 
+	// APIReader reads objects for the admission webhooks, which validate pull bindings in any namespace, including those
+	// this replica does not watch or reconcile; defaults to Client
+	APIReader crclient.Reader
+
+	// Credentials issues registry credentials, defaulting to managed and workload identity for ACR
+	Credentials authorizer.CredentialProvider
+
+	// AuditSink receives a record of every pull credential issued, if set
+	AuditSink audit.Sink
+
+	// EnforcePullPolicies restricts pull bindings to the identities, registries and scopes allowed by AcrPullPolicies
+	EnforcePullPolicies bool
+	// RequirePullPolicy denies pull bindings in namespaces that no AcrPullPolicy selects
+	RequirePullPolicy bool
+	// AuthorizeIdentityUse requires the author of a pull binding to be authorized to use its managed identity at admission
+	AuthorizeIdentityUse bool
+
+	// TracerProvider records spans for reconciliation, defaulting to the globally registered provider
+	TracerProvider trace.TracerProvider
+
+	// Recorder records events on pull bindings, if set
+	Recorder record.EventRecorder
+
+	// OwnsNamespace determines whether this replica reconciles pull bindings in a namespace when sharding is enabled; if
+	// unset, pull bindings in every namespace are reconciled
+	OwnsNamespace func(namespace string) bool
+
+	// MaxConcurrentReconciles is the number of pull bindings the controller reconciles at once, defaulting to one
+	MaxConcurrentReconciles int
+
 	now func() time.Time
 }
 
 type ServiceAccountTokenMinter func(ctx context.Context, serviceAccountNamespace, serviceAccountName string) (*authenticationv1.TokenRequest, error)
-type armTokenFetcher func(ctx context.Context, spec msiacrpullv1beta2.AcrPullBindingSpec, tenantId, clientId, serviceAccountToken string) (azcore.AccessToken, error)
-type armAcrTokenExchanger func(ctx context.Context, armToken azcore.AccessToken, spec msiacrpullv1beta2.AcrConfiguration) (azcore.AccessToken, error)
+type clientTokenReader func(ctx context.Context, namespace, secretName string) (tokenName, password string, err error)
+type caBundleReader func(ctx context.Context, namespace string, ref msiacrpullv1beta2.ConfigMapKeyReference) ([]byte, error)
+type acrTokenVerifier func(ctx context.Context, acrToken azcore.AccessToken, spec msiacrpullv1beta2.AcrConfiguration) error
 
 // V1beta2ReconcilerOpts configures the inputs for reconciling v1beta2 pull bindings
 type V1beta2ReconcilerOpts struct {
@@ -41,25 +82,40 @@ type V1beta2ReconcilerOpts struct {
 
 	TTLRotationFraction            float64
 	ServiceAccountClient           corev1client.ServiceAccountsGetter
+	SecretClient                   corev1client.SecretsGetter
+	ConfigMapClient                corev1client.ConfigMapsGetter
 	ServiceAccountTokenAudience    string
 	PullBindingLabelSelectorString string
 	AllowedACRServerSuffixes       []string
 
+	// VerifyPullCredentials presents each new pull credential to the registry before it replaces the current one, which
+	// is kept if the registry does not accept the new one
+	VerifyPullCredentials bool
+
 	// exposed here to allow unit tests to over-write them
-	mintToken                   ServiceAccountTokenMinter
-	fetchArmToken               armTokenFetcher
-	exchangeArmTokenForAcrToken armAcrTokenExchanger
+	mintToken       ServiceAccountTokenMinter
+	readClientToken clientTokenReader
+	readCABundle    caBundleReader
+	verifyAcrToken  acrTokenVerifier
+	probeRegistry   registryProber
 }
 
 func NewV1beta2Reconciler(opts *V1beta2ReconcilerOpts) *PullBindingReconciler {
 	if opts.now == nil {
 		opts.now = time.Now
 	}
-	if opts.fetchArmToken == nil {
-		opts.fetchArmToken = authorizer.ARMTokenForBinding
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = otel.GetTracerProvider()
+	}
+	tracer := opts.TracerProvider.Tracer(tracerName)
+	if opts.Credentials == nil {
+		opts.Credentials = authorizer.NewProvider()
 	}
-	if opts.exchangeArmTokenForAcrToken == nil {
-		opts.exchangeArmTokenForAcrToken = authorizer.ExchangeACRAccessTokenForSpec
+	if opts.verifyAcrToken == nil {
+		opts.verifyAcrToken = authorizer.DefaultRegistryVerifier.VerifyForSpec
+	}
+	if opts.probeRegistry == nil {
+		opts.probeRegistry = authorizer.DefaultRegistryVerifier.Verify
 	}
 	if opts.mintToken == nil {
 		opts.mintToken = func(ctx context.Context, serviceAccountNamespace, serviceAccountName string) (*authenticationv1.TokenRequest, error) {
@@ -71,11 +127,69 @@ func NewV1beta2Reconciler(opts *V1beta2ReconcilerOpts) *PullBindingReconciler {
 		}
 	}
 
+	if opts.readClientToken == nil {
+		// n.b. client token secrets are not labelled as pull secrets, so they are not in the cache and must be read directly
+		opts.readClientToken = func(ctx context.Context, namespace, secretName string) (string, string, error) {
+			secret, err := opts.SecretClient.Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+			if err != nil {
+				return "", "", err
+			}
+			return string(secret.Data[corev1.BasicAuthUsernameKey]), string(secret.Data[corev1.BasicAuthPasswordKey]), nil
+		}
+	}
+
+	if opts.readCABundle == nil {
+		// n.b. we do not cache config maps, and only read the few that hold the CA bundles of air-gapped clouds
+		opts.readCABundle = func(ctx context.Context, namespace string, ref msiacrpullv1beta2.ConfigMapKeyReference) ([]byte, error) {
+			configMap, err := opts.ConfigMapClient.ConfigMaps(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			return []byte(configMap.Data[ref.Key]), nil
+		}
+	}
+	// withCABundle returns a context whose requests to the cloud of the binding trust the CA bundle of the cloud, if any
+	withCABundle := func(ctx context.Context, binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences) (context.Context, error) {
+		if references != nil && references.cloudProfile != nil {
+			return authorizer.WithCABundle(ctx, []byte(references.cloudProfile.Spec.CABundle)), nil
+		}
+		if binding.Spec.ACR.Environment != msiacrpullv1beta2.AzureEnvironmentAirgappedCloud || binding.Spec.ACR.CloudConfig == nil || binding.Spec.ACR.CloudConfig.CABundleRef == nil {
+			return ctx, nil
+		}
+		ref := *binding.Spec.ACR.CloudConfig.CABundleRef
+		if ref.Key == "" {
+			ref.Key = "ca.crt"
+		}
+		caBundle, err := opts.readCABundle(ctx, binding.Namespace, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle from config map %s: %w", ref.Name, err)
+		}
+		if len(caBundle) == 0 {
+			return nil, fmt.Errorf("config map %s holds no CA bundle under key %s", ref.Name, ref.Key)
+		}
+		return authorizer.WithCABundle(ctx, caBundle), nil
+	}
+
+	var verifyPullCredential func(context.Context, *msiacrpullv1beta2.AcrPullBinding, *bindingReferences, *pullCredential) error
+	if opts.VerifyPullCredentials {
+		verifyPullCredential = func(ctx context.Context, binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences, credential *pullCredential) error {
+			binding = withReferences(binding, references)
+			verifyCtx, verifySpan := tracer.Start(ctx, "VerifyPullCredential", trace.WithAttributes(attribute.String("acr.server", binding.Spec.ACR.Server)))
+			verifyCtx, err := withCABundle(verifyCtx, binding, references)
+			if err == nil {
+				err = opts.verifyAcrToken(verifyCtx, credential.token, binding.Spec.ACR)
+			}
+			tracing.End(verifySpan, err)
+			return err
+		}
+	}
+
 	return &PullBindingReconciler{
 		genericReconciler: &genericReconciler[*msiacrpullv1beta2.AcrPullBinding]{
-			Client: opts.Client,
-			Logger: opts.Logger,
-			Scheme: opts.Scheme,
+			Client:    opts.Client,
+			APIReader: opts.APIReader,
+			Logger:    opts.Logger,
+			Scheme:    opts.Scheme,
 			NewBinding: func() *msiacrpullv1beta2.AcrPullBinding {
 				return &msiacrpullv1beta2.AcrPullBinding{}
 			},
@@ -97,62 +211,208 @@ func NewV1beta2Reconciler(opts *V1beta2ReconcilerOpts) *PullBindingReconciler {
 			GetPullSecretName: func(binding *msiacrpullv1beta2.AcrPullBinding) string {
 				return pullSecretName(binding.Name)
 			},
-			GetInputsHash: func(binding *msiacrpullv1beta2.AcrPullBinding) string {
-				return inputsHash(binding.Spec)
+			ResolveReferences: func(ctx context.Context, reader crclient.Reader, binding *msiacrpullv1beta2.AcrPullBinding) (*bindingReferences, error) {
+				return resolveV1beta2References(ctx, reader, binding)
 			},
-			ValidateBinding: func(binding *msiacrpullv1beta2.AcrPullBinding) error {
-				return validateACRServerSuffix(binding.Spec.ACR.Server, opts.AllowedACRServerSuffixes)
+			GetInputsHash: func(binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences) string {
+				return inputsHash(withReferences(binding, references).Spec, references)
 			},
-			CreatePullCredential: func(ctx context.Context, binding *msiacrpullv1beta2.AcrPullBinding, serviceAccount *corev1.ServiceAccount) (string, time.Time, error) {
-				var tenantId, clientId, token string
-				if binding.Spec.Auth.WorkloadIdentity != nil {
+			ValidateBinding: func(binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences, policies *pullPolicies) error {
+				if err := validateIdentity(binding, references); err != nil {
+					return err
+				}
+				binding = withReferences(binding, references)
+				if binding.Spec.ACR.RegistryRef != "" && binding.Spec.ACR.Scope == "" {
+					return fmt.Errorf("registry %s has no default scope, so the binding must set a scope", binding.Spec.ACR.RegistryRef)
+				}
+				validateHost := func(host string) error {
+					if err := acrserver.ValidateSuffix(host, opts.AllowedACRServerSuffixes); err != nil {
+						return err
+					}
+					if references != nil && references.cloudProfile != nil {
+						if err := acrserver.ValidateSuffix(host, references.cloudProfile.Spec.RegistrySuffixes); err != nil {
+							return fmt.Errorf("cloud profile %s: %w", references.cloudProfile.Name, err)
+						}
+					}
+					return nil
+				}
+				hosts := append([]string{binding.Spec.ACR.Server}, binding.Spec.ACR.AdditionalHosts...)
+				for _, host := range hosts {
+					if err := validateHost(host); err != nil {
+						return err
+					}
+				}
+				// the identity token is sent to the auth endpoint, so it is held to the same suffixes as the registry
+				if binding.Spec.ACR.AuthEndpoint != "" {
+					host, err := authEndpointHost(binding.Spec.ACR.AuthEndpoint)
+					if err != nil {
+						return err
+					}
+					if err := validateHost(host); err != nil {
+						return fmt.Errorf("auth endpoint: %w", err)
+					}
+				}
+				return policies.admit(v1beta2PolicyRequest(binding.Spec))
+			},
+			GetManagedIdentity: func(binding *msiacrpullv1beta2.AcrPullBinding) (string, string) {
+				if binding.Spec.Auth.ManagedIdentity == nil {
+					return "", ""
+				}
+				return binding.Spec.Auth.ManagedIdentity.ClientID, binding.Spec.Auth.ManagedIdentity.ResourceID
+			},
+			CreatePullCredential: func(ctx context.Context, binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences, serviceAccount *corev1.ServiceAccount) (*pullCredential, error) {
+				binding = withReferences(binding, references)
+				record := audit.Record{
+					BindingAPIVersion: msiacrpullv1beta2.GroupVersion.String(),
+					Server:            binding.Spec.ACR.Server,
+					Scope:             binding.Spec.ACR.Scope,
+				}
+				cloud, err := cloudForBinding(binding.Spec.ACR, references)
+				if err != nil {
+					return nil, err
+				}
+				registry, endpoint := authorizer.RegistryForSpec(binding.Spec.ACR)
+				request := &authorizer.CredentialRequest{
+					Cloud:        cloud,
+					Registry:     registry,
+					Endpoint:     endpoint,
+					AuthEndpoint: binding.Spec.ACR.AuthEndpoint,
+					Scope:        binding.Spec.ACR.Scope,
+				}
+				if binding.Spec.ACR.ConnectedRegistry != nil {
+					request.RegistryType = authorizer.RegistryTypeConnectedRegistry
+				}
+				if binding.Spec.Auth.ClientToken != nil {
+					tokenName, password, err := opts.readClientToken(ctx, binding.Namespace, binding.Spec.Auth.ClientToken.SecretName)
+					if err != nil {
+						return nil, fmt.Errorf("failed to read client token from secret %s: %w", binding.Spec.Auth.ClientToken.SecretName, err)
+					}
+					request.Method = authorizer.AuthMethodClientToken
+					request.TokenName = tokenName
+					request.SubjectToken = func(context.Context) (string, error) {
+						return password, nil
+					}
+
+					record.AuthMethod = audit.AuthMethodClientToken
+					record.TokenName = tokenName
+				} else if binding.Spec.Auth.WorkloadIdentity != nil {
+					request.Method = authorizer.AuthMethodWorkloadIdentity
 					if binding.Spec.Auth.WorkloadIdentity.TenantID != "" {
-						tenantId = binding.Spec.Auth.WorkloadIdentity.TenantID
-						clientId = binding.Spec.Auth.WorkloadIdentity.ClientID
+						request.TenantID = binding.Spec.Auth.WorkloadIdentity.TenantID
+						request.ClientID = binding.Spec.Auth.WorkloadIdentity.ClientID
 					} else {
-						for _, annotation := range []struct { // n.b. we need an array here to be able to test for the error output
-							value string
-							into  *string
-						}{
-							{value: azworkloadidentity.ClientIDAnnotation, into: &clientId},
-							{value: azworkloadidentity.TenantIDAnnotation, into: &tenantId},
-						} {
-							value, set := serviceAccount.Annotations[annotation.value]
-							if !set {
-								return "", time.Time{}, fmt.Errorf("service account %s missing %s annotation", serviceAccount.Name, annotation.value)
-							}
-							*annotation.into = value
+						var err error
+						request.TenantID, request.ClientID, err = workloadIdentityFromAnnotations(serviceAccount)
+						if err != nil {
+							return nil, err
 						}
 					}
-
-					response, err := opts.mintToken(ctx, serviceAccount.Namespace, serviceAccount.Name)
-					if err != nil {
-						return "", time.Time{}, fmt.Errorf("failed to mint service account token: %w", err)
+					request.SubjectToken = func(ctx context.Context) (string, error) {
+						mintCtx, mintSpan := tracer.Start(ctx, "MintServiceAccountToken", trace.WithAttributes(attribute.String("serviceaccount.name", serviceAccount.Name)))
+						response, err := opts.mintToken(mintCtx, serviceAccount.Namespace, serviceAccount.Name)
+						tracing.End(mintSpan, err)
+						if err != nil {
+							return "", fmt.Errorf("failed to mint service account token: %w", err)
+						}
+						record.ServiceAccountToken = &audit.ServiceAccountToken{
+							Namespace: serviceAccount.Namespace,
+							Name:      serviceAccount.Name,
+							Audiences: response.Spec.Audiences,
+							TokenID:   authorizer.TokenID(response.Status.Token),
+							ExpiresOn: response.Status.ExpirationTimestamp.Time,
+						}
+						return response.Status.Token, nil
 					}
-					token = response.Status.Token
+
+					record.AuthMethod = audit.AuthMethodWorkloadIdentity
+					record.TenantID, record.ClientID = request.TenantID, request.ClientID
+				} else if binding.Spec.Auth.ManagedIdentity != nil {
+					request.Method = authorizer.AuthMethodManagedIdentity
+					request.ClientID = binding.Spec.Auth.ManagedIdentity.ClientID
+					request.ResourceID = binding.Spec.Auth.ManagedIdentity.ResourceID
+
+					record.AuthMethod = audit.AuthMethodManagedIdentity
+					record.ClientID = binding.Spec.Auth.ManagedIdentity.ClientID
+					record.ResourceID = binding.Spec.Auth.ManagedIdentity.ResourceID
 				}
 
-				armToken, err := opts.fetchArmToken(ctx, binding.Spec, tenantId, clientId, token)
+				ctx, err = withCABundle(ctx, binding, references)
 				if err != nil {
-					return "", time.Time{}, fmt.Errorf("failed to retrieve ARM token: %v", err)
+					return nil, err
 				}
-
-				acrToken, err := opts.exchangeArmTokenForAcrToken(ctx, armToken, binding.Spec.ACR)
+				acrCredential, err := opts.Credentials.Credential(ctx, request)
 				if err != nil {
-					return "", time.Time{}, fmt.Errorf("failed to retrieve ACR token: %v", err)
+					return nil, err
 				}
 
-				dockerConfig, err := authorizer.CreateACRDockerCfg(binding.Spec.ACR.Server, acrToken)
+				dockerConfig, err := acrCredential.DockerConfig(binding.Spec.ACR.AdditionalHosts...)
 				if err != nil {
-					return "", time.Time{}, fmt.Errorf("failed to write ACR dockercfg: %v", err)
+					return nil, fmt.Errorf("failed to write ACR dockercfg: %v", err)
 				}
-				return dockerConfig, acrToken.ExpiresOn, nil
+				record.TokenID = acrCredential.TokenID
+				return &pullCredential{dockerConfig: dockerConfig, expiresOn: acrCredential.Token.ExpiresOn, token: acrCredential.Token, grantedScope: acrCredential.GrantedScope, audit: record}, nil
+			},
+			CheckServiceAccount: func(binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences, serviceAccount *corev1.ServiceAccount) error {
+				binding = withReferences(binding, references)
+				if binding.Spec.Auth.WorkloadIdentity == nil || binding.Spec.Auth.WorkloadIdentity.TenantID != "" {
+					return nil
+				}
+				_, _, err := workloadIdentityFromAnnotations(serviceAccount)
+				return err
+			},
+			VerifyPullCredential: verifyPullCredential,
+			ProbePullCredential: func(ctx context.Context, binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences, pullSecret *corev1.Secret) *probeOutcome {
+				binding = withReferences(binding, references)
+				if binding.Spec.Probe == nil {
+					if binding.Status.LastProbeTime != nil {
+						return &probeOutcome{removed: true}
+					}
+					return nil
+				}
+				if !probeDue(binding.Spec.Probe, binding.Status.LastProbeTime, opts.now) {
+					return nil
+				}
+				manifest := probeManifest(binding.Spec.Probe)
+				probeCtx, probeSpan := tracer.Start(ctx, "ProbeRegistry", trace.WithAttributes(attribute.String("acr.server", binding.Spec.ACR.Server), attribute.String("acr.manifest", manifest)))
+				registry, endpoint := authorizer.RegistryForSpec(binding.Spec.ACR)
+				token, err := authorizer.ACRTokenFromDockerCfg(registry, string(pullSecret.Data[dockerConfigKey]))
+				if err == nil {
+					probeCtx, err = withCABundle(probeCtx, binding, references)
+				}
+				if err == nil {
+					err = opts.probeRegistry(probeCtx, endpoint, token, manifest)
+				}
+				tracing.End(probeSpan, err)
+				outcome := newProbeOutcome(err, opts.now())
+				recordProbeOutcome(binding, outcome)
+				return outcome
+			},
+			RecordProbe: func(binding *msiacrpullv1beta2.AcrPullBinding, outcome *probeOutcome) *msiacrpullv1beta2.AcrPullBinding {
+				if outcome.removed {
+					binding.Status.LastProbeTime = nil
+					binding.Status.LastProbeResult = ""
+					binding.Status.LastProbeMessage = ""
+					return binding
+				}
+				binding.Status.LastProbeTime = &metav1.Time{Time: outcome.time}
+				binding.Status.LastProbeResult = outcome.result
+				binding.Status.LastProbeMessage = outcome.message
+				return binding
 			},
 			UpdateStatusError: func(binding *msiacrpullv1beta2.AcrPullBinding, s string) *msiacrpullv1beta2.AcrPullBinding {
 				updated := binding.DeepCopy()
 				updated.Status.Error = s
 				return updated
 			},
+			GetConditions: func(binding *msiacrpullv1beta2.AcrPullBinding) *[]metav1.Condition {
+				return &binding.Status.Conditions
+			},
+			GetRequestedScope: func(binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences) string {
+				return withReferences(binding, references).Spec.ACR.Scope
+			},
+			GetGrantedScope: func(binding *msiacrpullv1beta2.AcrPullBinding) *string {
+				return &binding.Status.GrantedScope
+			},
 			NeedsRefresh: func(logger logr.Logger, pullSecret *corev1.Secret, now func() time.Time) bool {
 				return needsRefresh(now, pullSecretRefresh(logger, pullSecret), pullSecretExpiry(logger, pullSecret), opts.TTLRotationFraction)
 			},
@@ -163,6 +423,11 @@ func NewV1beta2Reconciler(opts *V1beta2ReconcilerOpts) *PullBindingReconciler {
 						refresh, expiry := binding.Status.LastTokenRefreshTime.Time, binding.Status.TokenExpirationTime.Time
 						requeueAfter = refreshBoundary(refresh, expiry, opts.TTLRotationFraction).Sub(now())
 					}
+					if binding.Spec.Probe != nil && binding.Status.LastProbeTime != nil {
+						if untilProbe := binding.Status.LastProbeTime.Add(binding.Spec.Probe.Interval.Duration).Sub(now()); untilProbe < requeueAfter {
+							requeueAfter = untilProbe
+						}
+					}
 					return requeueAfter
 				}
 			},
@@ -180,7 +445,15 @@ func NewV1beta2Reconciler(opts *V1beta2ReconcilerOpts) *PullBindingReconciler {
 			LabelSelector: func() (labels.Selector, error) {
 				return acrPullBindingLabelSelector(opts.PullBindingLabelSelectorString)
 			},
-			now: opts.now,
+			AuditSink:               opts.AuditSink,
+			EnforcePullPolicies:     opts.EnforcePullPolicies,
+			RequirePullPolicy:       opts.RequirePullPolicy,
+			AuthorizeIdentityUse:    opts.AuthorizeIdentityUse,
+			Tracer:                  tracer,
+			Recorder:                opts.Recorder,
+			OwnsNamespace:           opts.OwnsNamespace,
+			MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
+			now:                     opts.now,
 		},
 	}
 }
@@ -194,15 +467,89 @@ func (r *PullBindingReconciler) SetupWithManager(ctx context.Context, mgr ctrl.M
 	if err := mgr.GetFieldIndexer().IndexField(ctx, &msiacrpullv1beta2.AcrPullBinding{}, serviceAccountField, indexV1beta2PullBindingByServiceAccount); err != nil {
 		return err
 	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &msiacrpullv1beta2.AcrPullBinding{}, cloudProfileField, indexV1beta2PullBindingByCloudProfile); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &msiacrpullv1beta2.AcrPullBinding{}, registryField, indexV1beta2PullBindingByRegistry); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &msiacrpullv1beta2.AcrRegistry{}, registryCloudProfileField, indexRegistryByCloudProfile); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &msiacrpullv1beta2.AcrPullBinding{}, identityField, indexV1beta2PullBindingByIdentity); err != nil {
+		return err
+	}
 	// n.b. we do not need to add the imagePullSecretsField indexer on service accounts since v1beta1 controller does it
 	// n.b. we do not need to add the pullBindingField indexer on service accounts since v1beta1 controller does it
 
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&msiacrpullv1beta2.AcrPullBinding{}).
 		Named("acr-pull-binding-v1beta2").
+		WithOptions(crcontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(enqueuePullBindingsForPullSecret(mgr))).
 		Watches(&corev1.ServiceAccount{}, handler.EnqueueRequestsFromMapFunc(enqueueV1beta2PullBindingsForServiceAccount(mgr))).
-		Complete(r)
+		Watches(&msiacrpullv1beta2.AzureCloudProfile{}, handler.EnqueueRequestsFromMapFunc(enqueueV1beta2PullBindingsForCloudProfile(mgr))).
+		Watches(&msiacrpullv1beta2.AcrRegistry{}, handler.EnqueueRequestsFromMapFunc(enqueueV1beta2PullBindingsForRegistry(mgr))).
+		Watches(&msiacrpullv1beta2.AzureIdentity{}, handler.EnqueueRequestsFromMapFunc(enqueueV1beta2PullBindingsForIdentity(mgr))).
+		Watches(&msiacrpullv1beta2.ClusterAzureIdentity{}, handler.EnqueueRequestsFromMapFunc(enqueueV1beta2PullBindingsForClusterIdentity(mgr)))
+	if r.EnforcePullPolicies {
+		builder = builder.
+			Watches(&msiacrpullv1beta2.AcrPullPolicy{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, _ crclient.Object) []reconcile.Request {
+				return enqueuePullBindings(ctx, mgr.GetClient(), &msiacrpullv1beta2.AcrPullBindingList{})
+			})).
+			Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, object crclient.Object) []reconcile.Request {
+				return enqueuePullBindings(ctx, mgr.GetClient(), &msiacrpullv1beta2.AcrPullBindingList{}, crclient.InNamespace(object.GetName()))
+			}))
+	}
+	return builder.Complete(r)
+}
+
+// workloadIdentityFromAnnotations determines the default federated identity for a service account from the annotations
+// used by Azure Workload Identity
+func workloadIdentityFromAnnotations(serviceAccount *corev1.ServiceAccount) (tenantId, clientId string, err error) {
+	for _, annotation := range []struct { // n.b. we need an array here to be able to test for the error output
+		value string
+		into  *string
+	}{
+		{value: azworkloadidentity.ClientIDAnnotation, into: &clientId},
+		{value: azworkloadidentity.TenantIDAnnotation, into: &tenantId},
+	} {
+		value, set := serviceAccount.Annotations[annotation.value]
+		if !set {
+			return "", "", fmt.Errorf("service account %s missing %s annotation", serviceAccount.Name, annotation.value)
+		}
+		*annotation.into = value
+	}
+	return tenantId, clientId, nil
+}
+
+// v1beta2PolicyRequest determines the inputs of a v1beta2 pull binding that AcrPullPolicies restrict
+func v1beta2PolicyRequest(spec msiacrpullv1beta2.AcrPullBindingSpec) pullPolicyRequest {
+	request := pullPolicyRequest{
+		server: spec.ACR.Server,
+		scope:  spec.ACR.Scope,
+	}
+	if spec.ACR.AuthEndpoint != "" {
+		// unparseable endpoints are rejected before policies are evaluated
+		request.authHost, _ = authEndpointHost(spec.ACR.AuthEndpoint)
+	}
+	switch {
+	case spec.Auth.ManagedIdentity != nil:
+		request.clientID = spec.Auth.ManagedIdentity.ClientID
+		request.resourceID = spec.Auth.ManagedIdentity.ResourceID
+	case spec.Auth.WorkloadIdentity != nil:
+		request.clientID = spec.Auth.WorkloadIdentity.ClientID
+	}
+	return request
+}
+
+// authEndpointHost returns the host name of the auth endpoint of a binding, without the port it listens on
+func authEndpointHost(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Hostname() == "" {
+		return "", fmt.Errorf("auth endpoint %q is not a valid URL", endpoint)
+	}
+	return strings.ToLower(parsed.Hostname()), nil
 }
 
 func indexV1beta2PullBindingByServiceAccount(object crclient.Object) []string {
@@ -236,17 +583,43 @@ func enqueueV1beta2PullBindingsForServiceAccount(mgr ctrl.Manager) func(ctx cont
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=*
 //+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get
 
 // inputsHash captures all the inputs for the pull binding which, if changed, would require a token regeneration
-func inputsHash(spec msiacrpullv1beta2.AcrPullBindingSpec) string {
+func inputsHash(spec msiacrpullv1beta2.AcrPullBindingSpec, references *bindingReferences) string {
 	inputs := []byte(spec.ServiceAccountName)
 	switch {
 	case spec.Auth.ManagedIdentity != nil:
 		inputs = append(inputs, []byte("managedIdentity"+spec.Auth.ManagedIdentity.ResourceID+spec.Auth.ManagedIdentity.ClientID)...)
 	case spec.Auth.WorkloadIdentity != nil:
 		inputs = append(inputs, []byte("workloadIdentity"+spec.Auth.WorkloadIdentity.ServiceAccountName)...)
+	case spec.Auth.ClientToken != nil:
+		inputs = append(inputs, []byte("clientToken"+spec.Auth.ClientToken.SecretName)...)
 	}
 	inputs = append(inputs, []byte(string(spec.ACR.Environment)+spec.ACR.Server+spec.ACR.Scope)...)
+	// n.b. hosts are only hashed when set, so that the hash of existing bindings does not change
+	if len(spec.ACR.AdditionalHosts) > 0 {
+		hosts := slices.Clone(spec.ACR.AdditionalHosts)
+		slices.Sort(hosts)
+		inputs = append(inputs, []byte("additionalHosts"+strings.Join(hosts, ","))...)
+	}
+	if spec.ACR.AuthEndpoint != "" {
+		inputs = append(inputs, []byte("authEndpoint"+spec.ACR.AuthEndpoint)...)
+	}
+	if spec.ACR.ConnectedRegistry != nil {
+		inputs = append(inputs, []byte(fmt.Sprintf("connectedRegistry%d%t", spec.ACR.ConnectedRegistry.Port, spec.ACR.ConnectedRegistry.AllowInsecureHTTP))...)
+	}
+	// credentials are re-issued when the cloud profile changes, as they were issued by the cloud it described
+	if references != nil && references.cloudProfile != nil {
+		profile := references.cloudProfile.Spec
+		inputs = append(inputs, []byte("cloudProfile"+references.cloudProfile.Name+profile.EntraAuthorityHost+profile.ResourceManagerAudience+profile.ACRAudience+profile.CABundle)...)
+	}
+	// the client and tenant ID of workload identities are only hashed when they come from an identity, so that the hash
+	// of existing bindings does not change
+	if spec.Auth.IdentityRef != nil && spec.Auth.WorkloadIdentity != nil {
+		inputs = append(inputs, []byte("identity"+spec.Auth.WorkloadIdentity.ClientID+spec.Auth.WorkloadIdentity.TenantID)...)
+	}
 	return base36sha224(inputs)
 }
 
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	msiacrpullv1beta1 "github.com/Azure/msi-acrpull/api/v1beta1"
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// pullBindingValidator rejects pull bindings at admission time which the reconciler would refuse to mint credentials
+// for, using the same validation as the reconciler, and warns about missing objects the binding depends on
+type pullBindingValidator[O pullBinding] struct {
+	client crclient.Client
+	// reader serves bindings in any namespace, as the webhook may be asked to admit bindings in namespaces the
+	// reconciler's cache does not hold
+	reader crclient.Reader
+
+	resolveReferences     func(context.Context, crclient.Reader, O) (*bindingReferences, error)
+	validate              func(O, *bindingReferences, *pullPolicies) error
+	getSpec               func(O) any
+	getManagedIdentity    func(O) (string, string)
+	getServiceAccountName func(O) string
+	checkServiceAccount   func(O, *bindingReferences, *corev1.ServiceAccount) error
+
+	// deprecation is returned as a warning on every create and update, if set
+	deprecation string
+
+	enforcePullPolicies  bool
+	requirePullPolicy    bool
+	authorizeIdentityUse bool
+}
+
+func newPullBindingValidator[O pullBinding](r *genericReconciler[O], getSpec func(O) any) *pullBindingValidator[O] {
+	var reader crclient.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	return &pullBindingValidator[O]{
+		client:                r.Client,
+		reader:                reader,
+		resolveReferences:     r.ResolveReferences,
+		validate:              r.ValidateBinding,
+		getSpec:               getSpec,
+		getManagedIdentity:    r.GetManagedIdentity,
+		getServiceAccountName: r.GetServiceAccountName,
+		checkServiceAccount:   r.CheckServiceAccount,
+		enforcePullPolicies:   r.EnforcePullPolicies,
+		requirePullPolicy:     r.RequirePullPolicy,
+		authorizeIdentityUse:  r.AuthorizeIdentityUse,
+	}
+}
+
+var _ admission.CustomValidator = &pullBindingValidator[*msiacrpullv1beta2.AcrPullBinding]{}
+
+func (v *pullBindingValidator[O]) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	binding, ok := obj.(O)
+	if !ok {
+		return nil, fmt.Errorf("expected a pull binding, got %T", obj)
+	}
+	return v.validateBinding(ctx, binding)
+}
+
+func (v *pullBindingValidator[O]) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldBinding, ok := oldObj.(O)
+	if !ok {
+		return nil, fmt.Errorf("expected a pull binding, got %T", oldObj)
+	}
+	binding, ok := newObj.(O)
+	if !ok {
+		return nil, fmt.Errorf("expected a pull binding, got %T", newObj)
+	}
+	// we must never block the removal of our finalizer, or other metadata changes on bindings that were valid
+	// under policies that have since changed; the reconciler reports those violations in status instead
+	if !binding.GetDeletionTimestamp().IsZero() {
+		return nil, nil
+	}
+	if equality.Semantic.DeepEqual(v.getSpec(oldBinding), v.getSpec(binding)) {
+		return v.deprecationWarnings(), nil
+	}
+	return v.validateBinding(ctx, binding)
+}
+
+func (v *pullBindingValidator[O]) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *pullBindingValidator[O]) validateBinding(ctx context.Context, binding O) (admission.Warnings, error) {
+	warnings := v.deprecationWarnings()
+	if err := v.authorize(ctx, binding); err != nil {
+		return warnings, err
+	}
+	references := &bindingReferences{}
+	resolved := true
+	if v.resolveReferences != nil {
+		var err error
+		references, err = v.resolveReferences(ctx, v.reader, binding)
+		switch {
+		case err != nil:
+			// the reconciler validates the binding once it can resolve what it refers to, so a failed lookup here
+			// should not deny it
+			warnings = append(warnings, fmt.Sprintf("the binding could not be validated, as %v", err))
+			references, resolved = &bindingReferences{}, false
+		case references.missing != nil:
+			// referenced resources may be created after the binding, so these do not deny it; the binding cannot be
+			// validated without them, which the reconciler does once they exist
+			warnings = append(warnings, fmt.Sprintf("%v, no pull credential will be created until it exists", references.missing))
+			resolved = false
+		}
+	}
+	if v.validate != nil && resolved {
+		var policies *pullPolicies
+		if v.enforcePullPolicies {
+			var err error
+			policies, err = fetchPullPolicies(ctx, v.reader, binding.GetNamespace(), v.requirePullPolicy)
+			if err != nil {
+				return warnings, err
+			}
+		}
+		if err := v.validate(binding, references, policies); err != nil {
+			return warnings, err
+		}
+	}
+	return append(warnings, v.serviceAccountWarnings(ctx, binding, references)...), nil
+}
+
+// serviceAccountWarnings warns about problems with the service account the binding targets, which the reconciler
+// would otherwise only report in status; service accounts may be created after the binding, so these do not deny it
+func (v *pullBindingValidator[O]) serviceAccountWarnings(ctx context.Context, binding O, references *bindingReferences) admission.Warnings {
+	if v.getServiceAccountName == nil {
+		return nil
+	}
+	serviceAccountName := v.getServiceAccountName(binding)
+	serviceAccount := &corev1.ServiceAccount{}
+	if err := v.reader.Get(ctx, crclient.ObjectKey{Namespace: binding.GetNamespace(), Name: serviceAccountName}, serviceAccount); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Warnings{fmt.Sprintf("service account %q not found, no pull credential will be created until it exists", serviceAccountName)}
+		}
+		return admission.Warnings{fmt.Sprintf("service account %q could not be checked: %v", serviceAccountName, err)}
+	}
+	if v.checkServiceAccount != nil {
+		if err := v.checkServiceAccount(binding, references, serviceAccount); err != nil {
+			return admission.Warnings{fmt.Sprintf("no pull credential will be created until %v", err)}
+		}
+	}
+	return nil
+}
+
+func (v *pullBindingValidator[O]) deprecationWarnings() admission.Warnings {
+	if v.deprecation == "" {
+		return nil
+	}
+	return admission.Warnings{v.deprecation}
+}
+
+// authorize ensures that the author of the binding may use the managed identity it references, as otherwise anyone
+// able to create a pull binding could mint pull credentials for any identity assigned to the controller's nodes
+func (v *pullBindingValidator[O]) authorize(ctx context.Context, binding O) error {
+	if !v.authorizeIdentityUse || v.getManagedIdentity == nil {
+		return nil
+	}
+	identity := managedIdentityName(v.getManagedIdentity(binding))
+	if identity == "" {
+		return nil
+	}
+	request, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to determine the author of the binding: %w", err)
+	}
+	return authorizeIdentityUse(ctx, v.client, request.UserInfo, binding.GetNamespace(), identity)
+}
+
+const v1beta1DeprecationWarning = "msi-acrpull.microsoft.com/v1beta1 AcrPullBinding is deprecated; migrate to acrpull.microsoft.com/v1beta2 AcrPullBinding"
+
+func (r *AcrPullBindingReconciler) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	validator := newPullBindingValidator(r.genericReconciler, func(binding *msiacrpullv1beta1.AcrPullBinding) any {
+		return binding.Spec
+	})
+	validator.deprecation = v1beta1DeprecationWarning
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&msiacrpullv1beta1.AcrPullBinding{}).
+		WithValidator(validator).
+		Complete()
+}
+
+func (r *PullBindingReconciler) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if err := ctrl.NewWebhookManagedBy(mgr).
+		For(&msiacrpullv1beta2.AcrPullBinding{}).
+		WithValidator(newPullBindingValidator(r.genericReconciler, func(binding *msiacrpullv1beta2.AcrPullBinding) any {
+			return binding.Spec
+		})).
+		Complete(); err != nil {
+		return err
+	}
+	if r.AuthorizeIdentityUse {
+		return setupIdentityWebhooksWithManager(mgr, r.Client)
+	}
+	return nil
+}
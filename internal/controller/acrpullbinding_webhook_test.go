@@ -0,0 +1,563 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	msiacrpullv1beta1 "github.com/Azure/msi-acrpull/api/v1beta1"
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func Test_pullBindingValidator(t *testing.T) {
+	if err := msiacrpullv1beta2.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("failed to set up scheme: %v", err)
+	}
+
+	binding := func(clientID string) *msiacrpullv1beta2.AcrPullBinding {
+		return &msiacrpullv1beta2.AcrPullBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "binding"},
+			Spec: msiacrpullv1beta2.AcrPullBindingSpec{
+				ServiceAccountName: "delegate",
+				ACR: msiacrpullv1beta2.AcrConfiguration{
+					Server:      "team-a.azurecr.io",
+					Scope:       "repository:team-a/app:pull",
+					Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+				},
+				Auth: msiacrpullv1beta2.AuthenticationMethod{
+					ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: clientID},
+				},
+			},
+		}
+	}
+	deleted := binding("team-b-client-id")
+	deleted.Finalizers = []string{msiAcrPullFinalizerName}
+	deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	relabelled := binding("team-b-client-id")
+	relabelled.Labels = map[string]string{"new": "label"}
+	registryBinding := func(registry string) *msiacrpullv1beta2.AcrPullBinding {
+		binding := binding("team-a-client-id")
+		binding.Spec.ACR = msiacrpullv1beta2.AcrConfiguration{RegistryRef: registry}
+		return binding
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tenant": "a"}}},
+		&msiacrpullv1beta2.AcrPullPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec: msiacrpullv1beta2.AcrPullPolicySpec{
+				NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+				AllowedIdentities: []msiacrpullv1beta2.AllowedIdentity{{ClientID: "team-a-client-id"}},
+			},
+		},
+		&msiacrpullv1beta2.AcrRegistry{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "shared"},
+			Spec: msiacrpullv1beta2.AcrRegistrySpec{
+				Server:       "shared.azurecr.io",
+				Environment:  msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+				DefaultScope: "repository:team-a/app:pull",
+			},
+		},
+		&msiacrpullv1beta2.AcrRegistry{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "elsewhere"},
+			Spec: msiacrpullv1beta2.AcrRegistrySpec{
+				Server:       "registry.example.com",
+				Environment:  msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+				DefaultScope: "repository:team-a/app:pull",
+			},
+		},
+	).Build()
+
+	reconciler := NewV1beta2Reconciler(&V1beta2ReconcilerOpts{
+		CoreOpts: CoreOpts{
+			Client:              client,
+			Logger:              testr.New(t),
+			Scheme:              scheme.Scheme,
+			EnforcePullPolicies: true,
+		},
+		AllowedACRServerSuffixes: []string{"azurecr.io"},
+	})
+	validator := newPullBindingValidator(reconciler.genericReconciler, func(binding *msiacrpullv1beta2.AcrPullBinding) any {
+		return binding.Spec
+	})
+
+	for _, testCase := range []struct {
+		name     string
+		old, new *msiacrpullv1beta2.AcrPullBinding
+		wantErr  string
+	}{
+		{
+			name: "compliant binding is created",
+			new:  binding("team-a-client-id"),
+		},
+		{
+			name:    "non-compliant binding is rejected on create",
+			new:     binding("team-b-client-id"),
+			wantErr: `binding does not comply with any AcrPullPolicy selecting namespace "team-a": team-a: identity "team-b-client-id" is not allowed`,
+		},
+		{
+			name:    "non-compliant spec change is rejected on update",
+			old:     binding("team-a-client-id"),
+			new:     binding("team-b-client-id"),
+			wantErr: `binding does not comply with any AcrPullPolicy selecting namespace "team-a": team-a: identity "team-b-client-id" is not allowed`,
+		},
+		{
+			name: "binding referring to a registry is validated against the registry",
+			new:  registryBinding("shared"),
+		},
+		{
+			name:    "binding referring to a registry outside the allowed suffixes is rejected",
+			new:     registryBinding("elsewhere"),
+			wantErr: `ACR server "registry.example.com" is not in the allowed ACR server suffixes: azurecr.io`,
+		},
+		{
+			name: "binding referring to a missing registry is allowed",
+			new:  registryBinding("missing"),
+		},
+		{
+			name: "metadata change on a binding that no longer complies is allowed",
+			old:  binding("team-b-client-id"),
+			new:  relabelled,
+		},
+		{
+			name: "finalizer removal on a binding that no longer complies is allowed",
+			old:  binding("team-b-client-id"),
+			new:  deleted,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var err error
+			if testCase.old == nil {
+				_, err = validator.ValidateCreate(context.Background(), testCase.new)
+			} else {
+				_, err = validator.ValidateUpdate(context.Background(), testCase.old, testCase.new)
+			}
+			if testCase.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != testCase.wantErr {
+				t.Fatalf("expected error %q, got %v", testCase.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_pullBindingValidator_authorizeIdentityUse(t *testing.T) {
+	if err := msiacrpullv1beta2.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("failed to set up scheme: %v", err)
+	}
+
+	managedIdentityBinding := func(clientID, resourceID string) *msiacrpullv1beta2.AcrPullBinding {
+		return &msiacrpullv1beta2.AcrPullBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "binding"},
+			Spec: msiacrpullv1beta2.AcrPullBindingSpec{
+				ServiceAccountName: "delegate",
+				ACR: msiacrpullv1beta2.AcrConfiguration{
+					Server:      "team-a.azurecr.io",
+					Scope:       "repository:team-a/app:pull",
+					Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+				},
+				Auth: msiacrpullv1beta2.AuthenticationMethod{
+					ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: clientID, ResourceID: resourceID},
+				},
+			},
+		}
+	}
+	workloadIdentityBinding := managedIdentityBinding("", "")
+	workloadIdentityBinding.Spec.Auth = msiacrpullv1beta2.AuthenticationMethod{
+		WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{ServiceAccountName: "delegate"},
+	}
+	identityRefBinding := managedIdentityBinding("", "")
+	identityRefBinding.Spec.Auth = msiacrpullv1beta2.AuthenticationMethod{
+		IdentityRef: &msiacrpullv1beta2.IdentityReference{Kind: "AzureIdentity", Name: "team-b"},
+	}
+
+	// alice may use the team-a identity in the team-a namespace, by client ID or by name
+	allowed := sets.New[string]("alice/team-a/team-a-client-id", "alice/team-a/team-a")
+
+	var reviews []authorizationv1.SubjectAccessReviewSpec
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&msiacrpullv1beta2.AzureIdentity{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "team-b"},
+			Spec: msiacrpullv1beta2.AzureIdentitySpec{
+				ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "team-b-client-id"},
+			},
+		},
+	).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, client crclient.WithWatch, obj crclient.Object, opts ...crclient.CreateOption) error {
+			review, ok := obj.(*authorizationv1.SubjectAccessReview)
+			if !ok {
+				return client.Create(ctx, obj, opts...)
+			}
+			reviews = append(reviews, review.Spec)
+			attributes := review.Spec.ResourceAttributes
+			if attributes.Verb != "use" || attributes.Group != "acrpull.microsoft.com" || attributes.Resource != "managedidentities" {
+				return nil
+			}
+			review.Status.Allowed = allowed.Has(strings.Join([]string{review.Spec.User, attributes.Namespace, attributes.Name}, "/"))
+			return nil
+		},
+	}).Build()
+
+	reconciler := NewV1beta2Reconciler(&V1beta2ReconcilerOpts{
+		CoreOpts: CoreOpts{
+			Client:               client,
+			Logger:               testr.New(t),
+			Scheme:               scheme.Scheme,
+			AuthorizeIdentityUse: true,
+		},
+	})
+	validator := newPullBindingValidator(reconciler.genericReconciler, func(binding *msiacrpullv1beta2.AcrPullBinding) any {
+		return binding.Spec
+	})
+
+	for _, testCase := range []struct {
+		name        string
+		user        string
+		binding     *msiacrpullv1beta2.AcrPullBinding
+		wantReviews int
+		wantErr     string
+	}{
+		{
+			name:        "authorized user may use client ID",
+			user:        "alice",
+			binding:     managedIdentityBinding("TEAM-A-CLIENT-ID", ""),
+			wantReviews: 1,
+		},
+		{
+			name:        "authorized user may use resource ID",
+			user:        "alice",
+			binding:     managedIdentityBinding("", "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/team-a"),
+			wantReviews: 1,
+		},
+		{
+			name:        "unauthorized identity is denied",
+			user:        "alice",
+			binding:     managedIdentityBinding("team-b-client-id", ""),
+			wantReviews: 1,
+			wantErr:     `user "alice" may not use managed identity "team-b-client-id" in namespace "team-a": requires "use" on managedidentities.acrpull.microsoft.com`,
+		},
+		{
+			name:        "unauthorized user is denied",
+			user:        "mallory",
+			binding:     managedIdentityBinding("team-a-client-id", ""),
+			wantReviews: 1,
+			wantErr:     `user "mallory" may not use managed identity "team-a-client-id" in namespace "team-a": requires "use" on managedidentities.acrpull.microsoft.com`,
+		},
+		{
+			name:    "workload identity bindings are not reviewed",
+			user:    "mallory",
+			binding: workloadIdentityBinding,
+		},
+		{
+			name:    "bindings referring to an identity are not reviewed, as the identity was on admission",
+			user:    "mallory",
+			binding: identityRefBinding,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			reviews = nil
+			ctx := admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{Username: testCase.user, Groups: []string{"system:authenticated"}},
+			}})
+			_, err := validator.ValidateCreate(ctx, testCase.binding)
+			if len(reviews) != testCase.wantReviews {
+				t.Fatalf("expected %d reviews, got %d", testCase.wantReviews, len(reviews))
+			}
+			for _, review := range reviews {
+				if review.User != testCase.user || len(review.Groups) != 1 {
+					t.Errorf("expected review for the requesting user, got %#v", review)
+				}
+			}
+			if testCase.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != testCase.wantErr {
+				t.Fatalf("expected error %q, got %v", testCase.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_pullBindingValidator_warnings(t *testing.T) {
+	for _, addToScheme := range []func(*runtime.Scheme) error{msiacrpullv1beta1.AddToScheme, msiacrpullv1beta2.AddToScheme} {
+		if err := addToScheme(scheme.Scheme); err != nil {
+			t.Fatalf("failed to set up scheme: %v", err)
+		}
+	}
+
+	binding := func(serviceAccountName, server string, auth msiacrpullv1beta2.AuthenticationMethod) *msiacrpullv1beta2.AcrPullBinding {
+		return &msiacrpullv1beta2.AcrPullBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "binding"},
+			Spec: msiacrpullv1beta2.AcrPullBindingSpec{
+				ServiceAccountName: serviceAccountName,
+				ACR: msiacrpullv1beta2.AcrConfiguration{
+					Server:      server,
+					Scope:       "repository:team-a/app:pull",
+					Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+				},
+				Auth: auth,
+			},
+		}
+	}
+	managedIdentity := msiacrpullv1beta2.AuthenticationMethod{
+		ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "client-id"},
+	}
+	workloadIdentity := msiacrpullv1beta2.AuthenticationMethod{
+		WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{ServiceAccountName: "delegate"},
+	}
+	explicitWorkloadIdentity := msiacrpullv1beta2.AuthenticationMethod{
+		WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{ServiceAccountName: "delegate", ClientID: "client-id", TenantID: "tenant-id"},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "delegate"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "federated", Annotations: map[string]string{
+			"azure.workload.identity/client-id": "client-id",
+			"azure.workload.identity/tenant-id": "tenant-id",
+		}}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "default"}},
+	).Build()
+
+	v1beta2Reconciler := NewV1beta2Reconciler(&V1beta2ReconcilerOpts{
+		CoreOpts: CoreOpts{
+			Client: client,
+			Logger: testr.New(t),
+			Scheme: scheme.Scheme,
+		},
+		AllowedACRServerSuffixes: []string{"azurecr.io"},
+	})
+	v1beta2Validator := newPullBindingValidator(v1beta2Reconciler.genericReconciler, func(binding *msiacrpullv1beta2.AcrPullBinding) any {
+		return binding.Spec
+	})
+
+	for _, testCase := range []struct {
+		name         string
+		binding      *msiacrpullv1beta2.AcrPullBinding
+		wantWarnings admission.Warnings
+		wantErr      string
+	}{
+		{
+			name:    "binding with existing service account has no warnings",
+			binding: binding("delegate", "team-a.azurecr.io", managedIdentity),
+		},
+		{
+			name:         "missing service account is a warning",
+			binding:      binding("missing", "team-a.azurecr.io", managedIdentity),
+			wantWarnings: admission.Warnings{`service account "missing" not found, no pull credential will be created until it exists`},
+		},
+		{
+			name:         "workload identity service account without annotations is a warning",
+			binding:      binding("delegate", "team-a.azurecr.io", workloadIdentity),
+			wantWarnings: admission.Warnings{`no pull credential will be created until service account delegate missing azure.workload.identity/client-id annotation`},
+		},
+		{
+			name:    "workload identity service account with annotations has no warnings",
+			binding: binding("federated", "team-a.azurecr.io", workloadIdentity),
+		},
+		{
+			name:    "workload identity with explicit identifiers does not need annotations",
+			binding: binding("delegate", "team-a.azurecr.io", explicitWorkloadIdentity),
+		},
+		{
+			name:    "disallowed server suffix is denied",
+			binding: binding("missing", "team-a.example.com", managedIdentity),
+			wantErr: `ACR server "team-a.example.com" is not in the allowed ACR server suffixes: azurecr.io`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			warnings, err := v1beta2Validator.ValidateCreate(context.Background(), testCase.binding)
+			if diff := cmp.Diff(testCase.wantWarnings, warnings); diff != "" {
+				t.Errorf("unexpected warnings (-want +got):\n%s", diff)
+			}
+			if testCase.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", testCase.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("failed lookups are warnings", func(t *testing.T) {
+		failing := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, client crclient.WithWatch, key crclient.ObjectKey, obj crclient.Object, opts ...crclient.GetOption) error {
+				return errors.New("unavailable")
+			},
+		}).Build()
+		reconciler := NewV1beta2Reconciler(&V1beta2ReconcilerOpts{
+			CoreOpts: CoreOpts{
+				Client:    client,
+				APIReader: failing,
+				Logger:    testr.New(t),
+				Scheme:    scheme.Scheme,
+			},
+			AllowedACRServerSuffixes: []string{"azurecr.io"},
+		})
+		validator := newPullBindingValidator(reconciler.genericReconciler, func(binding *msiacrpullv1beta2.AcrPullBinding) any {
+			return binding.Spec
+		})
+		registryBinding := binding("delegate", "", managedIdentity)
+		registryBinding.Spec.ACR = msiacrpullv1beta2.AcrConfiguration{RegistryRef: "shared"}
+
+		warnings, err := validator.ValidateCreate(context.Background(), registryBinding)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if diff := cmp.Diff(admission.Warnings{
+			`the binding could not be validated, as failed to get registry: unavailable`,
+			`service account "delegate" could not be checked: unavailable`,
+		}, warnings); diff != "" {
+			t.Errorf("unexpected warnings (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("v1beta1 bindings are deprecated", func(t *testing.T) {
+		v1beta1Reconciler := NewV1beta1Reconciler(&V1beta1ReconcilerOpts{
+			CoreOpts: CoreOpts{
+				Client: client,
+				Logger: testr.New(t),
+				Scheme: scheme.Scheme,
+			},
+		})
+		v1beta1Validator := newPullBindingValidator(v1beta1Reconciler.genericReconciler, func(binding *msiacrpullv1beta1.AcrPullBinding) any {
+			return binding.Spec
+		})
+		v1beta1Validator.deprecation = v1beta1DeprecationWarning
+		v1beta1Binding := &msiacrpullv1beta1.AcrPullBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "binding"},
+			Spec: msiacrpullv1beta1.AcrPullBindingSpec{
+				AcrServer:               "team-a.azurecr.io",
+				ManagedIdentityClientID: "client-id",
+			},
+		}
+
+		warnings, err := v1beta1Validator.ValidateCreate(context.Background(), v1beta1Binding)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if diff := cmp.Diff(admission.Warnings{v1beta1DeprecationWarning}, warnings); diff != "" {
+			t.Errorf("unexpected warnings on create (-want +got):\n%s", diff)
+		}
+
+		relabelled := v1beta1Binding.DeepCopy()
+		relabelled.Labels = map[string]string{"new": "label"}
+		warnings, err = v1beta1Validator.ValidateUpdate(context.Background(), v1beta1Binding, relabelled)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if diff := cmp.Diff(admission.Warnings{v1beta1DeprecationWarning}, warnings); diff != "" {
+			t.Errorf("unexpected warnings on update (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func Test_pullBindingValidator_sharding(t *testing.T) {
+	if err := msiacrpullv1beta2.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("failed to set up scheme: %v", err)
+	}
+
+	objects := []crclient.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tenant": "b"}}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "delegate"}},
+		&msiacrpullv1beta2.AcrPullPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-b"},
+			Spec: msiacrpullv1beta2.AcrPullPolicySpec{
+				NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "b"}},
+				AllowedIdentities: []msiacrpullv1beta2.AllowedIdentity{{ClientID: "team-b-client-id"}},
+			},
+		},
+		&msiacrpullv1beta2.AcrRegistry{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "shared"},
+			Spec: msiacrpullv1beta2.AcrRegistrySpec{
+				Server:       "shared.azurecr.io",
+				Environment:  msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+				DefaultScope: "repository:team-b/app:pull",
+			},
+		},
+	}
+	// the manager's cache on this replica only serves namespaced objects in the namespaces whose shards it owns
+	cached := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, client crclient.WithWatch, key crclient.ObjectKey, obj crclient.Object, opts ...crclient.GetOption) error {
+			if key.Namespace == "team-b" {
+				return fmt.Errorf("namespace %s is not in a shard owned by this replica", key.Namespace)
+			}
+			return client.Get(ctx, key, obj, opts...)
+		},
+	}).Build()
+	uncached := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+
+	reconciler := NewV1beta2Reconciler(&V1beta2ReconcilerOpts{
+		CoreOpts: CoreOpts{
+			Client:              cached,
+			APIReader:           uncached,
+			Logger:              testr.New(t),
+			Scheme:              scheme.Scheme,
+			EnforcePullPolicies: true,
+			OwnsNamespace: func(namespace string) bool {
+				return namespace != "team-b"
+			},
+		},
+		AllowedACRServerSuffixes: []string{"azurecr.io"},
+	})
+	validator := newPullBindingValidator(reconciler.genericReconciler, func(binding *msiacrpullv1beta2.AcrPullBinding) any {
+		return binding.Spec
+	})
+
+	binding := func(clientID string) *msiacrpullv1beta2.AcrPullBinding {
+		return &msiacrpullv1beta2.AcrPullBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "binding"},
+			Spec: msiacrpullv1beta2.AcrPullBindingSpec{
+				ServiceAccountName: "delegate",
+				ACR:                msiacrpullv1beta2.AcrConfiguration{RegistryRef: "shared"},
+				Auth: msiacrpullv1beta2.AuthenticationMethod{
+					ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: clientID},
+				},
+			},
+		}
+	}
+
+	t.Run("binding in a namespace owned by another replica is admitted", func(t *testing.T) {
+		warnings, err := validator.ValidateCreate(context.Background(), binding("team-b-client-id"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(warnings) != 0 {
+			t.Errorf("expected no warnings, got %v", warnings)
+		}
+	})
+
+	t.Run("binding in a namespace owned by another replica is still validated", func(t *testing.T) {
+		_, err := validator.ValidateCreate(context.Background(), binding("team-a-client-id"))
+		want := `binding does not comply with any AcrPullPolicy selecting namespace "team-b": team-b: identity "team-a-client-id" is not allowed`
+		if err == nil || err.Error() != want {
+			t.Fatalf("expected error %q, got %v", want, err)
+		}
+	})
+}
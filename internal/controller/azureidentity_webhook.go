@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// identityValidator ensures that the author of an AzureIdentity or ClusterAzureIdentity may use the managed identity it
+// describes, in its namespace or, for a ClusterAzureIdentity, cluster-wide. Bindings referring to an identity are not
+// authorized themselves, so the use of the managed identity is authorized once here for all of them.
+type identityValidator[O crclient.Object] struct {
+	client crclient.Client
+
+	getManagedIdentity func(O) *msiacrpullv1beta2.ManagedIdentityAuth
+}
+
+var _ admission.CustomValidator = &identityValidator[*msiacrpullv1beta2.AzureIdentity]{}
+
+func (v *identityValidator[O]) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	identity, ok := obj.(O)
+	if !ok {
+		return nil, fmt.Errorf("expected an identity, got %T", obj)
+	}
+	return nil, v.authorize(ctx, identity)
+}
+
+func (v *identityValidator[O]) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldIdentity, ok := oldObj.(O)
+	if !ok {
+		return nil, fmt.Errorf("expected an identity, got %T", oldObj)
+	}
+	identity, ok := newObj.(O)
+	if !ok {
+		return nil, fmt.Errorf("expected an identity, got %T", newObj)
+	}
+	if equality.Semantic.DeepEqual(v.getManagedIdentity(oldIdentity), v.getManagedIdentity(identity)) {
+		return nil, nil
+	}
+	return nil, v.authorize(ctx, identity)
+}
+
+func (v *identityValidator[O]) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *identityValidator[O]) authorize(ctx context.Context, identity O) error {
+	managedIdentity := v.getManagedIdentity(identity)
+	if managedIdentity == nil {
+		// Entra will only issue tokens for workload identities federated with the service account of the binding
+		return nil
+	}
+	request, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to determine the author of the identity: %w", err)
+	}
+	return authorizeIdentityUse(ctx, v.client, request.UserInfo, identity.GetNamespace(), managedIdentityName(managedIdentity.ClientID, managedIdentity.ResourceID))
+}
+
+func setupIdentityWebhooksWithManager(mgr ctrl.Manager, client crclient.Client) error {
+	if err := ctrl.NewWebhookManagedBy(mgr).
+		For(&msiacrpullv1beta2.AzureIdentity{}).
+		WithValidator(&identityValidator[*msiacrpullv1beta2.AzureIdentity]{
+			client: client,
+			getManagedIdentity: func(identity *msiacrpullv1beta2.AzureIdentity) *msiacrpullv1beta2.ManagedIdentityAuth {
+				return identity.Spec.ManagedIdentity
+			},
+		}).
+		Complete(); err != nil {
+		return err
+	}
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&msiacrpullv1beta2.ClusterAzureIdentity{}).
+		WithValidator(&identityValidator[*msiacrpullv1beta2.ClusterAzureIdentity]{
+			client: client,
+			getManagedIdentity: func(identity *msiacrpullv1beta2.ClusterAzureIdentity) *msiacrpullv1beta2.ManagedIdentityAuth {
+				return identity.Spec.ManagedIdentity
+			},
+		}).
+		Complete()
+}
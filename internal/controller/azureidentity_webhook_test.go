@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+)
+
+func Test_identityValidator(t *testing.T) {
+	if err := msiacrpullv1beta2.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("failed to set up scheme: %v", err)
+	}
+
+	// alice may use the team-a identity in the team-a namespace, and the shared identity cluster-wide
+	allowed := sets.New[string]("alice/team-a/team-a-client-id", "alice//shared-client-id")
+
+	var reviews int
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, client crclient.WithWatch, obj crclient.Object, opts ...crclient.CreateOption) error {
+			review, ok := obj.(*authorizationv1.SubjectAccessReview)
+			if !ok {
+				return client.Create(ctx, obj, opts...)
+			}
+			reviews++
+			attributes := review.Spec.ResourceAttributes
+			review.Status.Allowed = allowed.Has(strings.Join([]string{review.Spec.User, attributes.Namespace, attributes.Name}, "/"))
+			return nil
+		},
+	}).Build()
+
+	namespaced := &identityValidator[*msiacrpullv1beta2.AzureIdentity]{
+		client: client,
+		getManagedIdentity: func(identity *msiacrpullv1beta2.AzureIdentity) *msiacrpullv1beta2.ManagedIdentityAuth {
+			return identity.Spec.ManagedIdentity
+		},
+	}
+	cluster := &identityValidator[*msiacrpullv1beta2.ClusterAzureIdentity]{
+		client: client,
+		getManagedIdentity: func(identity *msiacrpullv1beta2.ClusterAzureIdentity) *msiacrpullv1beta2.ManagedIdentityAuth {
+			return identity.Spec.ManagedIdentity
+		},
+	}
+	managedIdentity := func(clientID string) *msiacrpullv1beta2.AzureIdentity {
+		return &msiacrpullv1beta2.AzureIdentity{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "identity"},
+			Spec: msiacrpullv1beta2.AzureIdentitySpec{
+				ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: clientID},
+			},
+		}
+	}
+	clusterIdentity := func(clientID string) *msiacrpullv1beta2.ClusterAzureIdentity {
+		return &msiacrpullv1beta2.ClusterAzureIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "identity"},
+			Spec: msiacrpullv1beta2.ClusterAzureIdentitySpec{
+				ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: clientID},
+			},
+		}
+	}
+	workloadIdentity := &msiacrpullv1beta2.AzureIdentity{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "identity"},
+		Spec: msiacrpullv1beta2.AzureIdentitySpec{
+			WorkloadIdentity: &msiacrpullv1beta2.FederatedIdentity{ClientID: "team-b-client-id", TenantID: "tenant"},
+		},
+	}
+	relabelled := managedIdentity("team-b-client-id")
+	relabelled.Labels = map[string]string{"new": "label"}
+
+	for _, testCase := range []struct {
+		name        string
+		validate    func(context.Context) error
+		wantReviews int
+		wantErr     string
+	}{
+		{
+			name: "authorized user may describe the managed identity",
+			validate: func(ctx context.Context) error {
+				_, err := namespaced.ValidateCreate(ctx, managedIdentity("team-a-client-id"))
+				return err
+			},
+			wantReviews: 1,
+		},
+		{
+			name: "unauthorized managed identity is denied",
+			validate: func(ctx context.Context) error {
+				_, err := namespaced.ValidateCreate(ctx, managedIdentity("team-b-client-id"))
+				return err
+			},
+			wantReviews: 1,
+			wantErr:     `user "alice" may not use managed identity "team-b-client-id" in namespace "team-a": requires "use" on managedidentities.acrpull.microsoft.com`,
+		},
+		{
+			name: "changing the managed identity is reviewed",
+			validate: func(ctx context.Context) error {
+				_, err := namespaced.ValidateUpdate(ctx, managedIdentity("team-a-client-id"), managedIdentity("team-b-client-id"))
+				return err
+			},
+			wantReviews: 1,
+			wantErr:     `user "alice" may not use managed identity "team-b-client-id" in namespace "team-a": requires "use" on managedidentities.acrpull.microsoft.com`,
+		},
+		{
+			name: "metadata changes are not reviewed",
+			validate: func(ctx context.Context) error {
+				_, err := namespaced.ValidateUpdate(ctx, managedIdentity("team-b-client-id"), relabelled)
+				return err
+			},
+		},
+		{
+			name: "workload identities are not reviewed",
+			validate: func(ctx context.Context) error {
+				_, err := namespaced.ValidateCreate(ctx, workloadIdentity)
+				return err
+			},
+		},
+		{
+			name: "cluster identities require use of the managed identity cluster-wide",
+			validate: func(ctx context.Context) error {
+				_, err := cluster.ValidateCreate(ctx, clusterIdentity("shared-client-id"))
+				return err
+			},
+			wantReviews: 1,
+		},
+		{
+			name: "cluster identities are denied for managed identities only usable in a namespace",
+			validate: func(ctx context.Context) error {
+				_, err := cluster.ValidateCreate(ctx, clusterIdentity("team-a-client-id"))
+				return err
+			},
+			wantReviews: 1,
+			wantErr:     `user "alice" may not use managed identity "team-a-client-id" in namespace "": requires "use" on managedidentities.acrpull.microsoft.com`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			reviews = 0
+			ctx := admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{Username: "alice"},
+			}})
+			err := testCase.validate(ctx)
+			if reviews != testCase.wantReviews {
+				t.Fatalf("expected %d reviews, got %d", testCase.wantReviews, reviews)
+			}
+			if testCase.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != testCase.wantErr {
+				t.Fatalf("expected error %q, got %v", testCase.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+)
+
+const (
+	// transientErrorRequeue is how soon we retry issuing a credential after throttling or a transient failure
+	transientErrorRequeue = 30 * time.Second
+	// permanentErrorRequeue is how soon we retry issuing a credential after a failure the user must remediate, as they
+	// may do so outside the cluster, where we would not see it
+	permanentErrorRequeue = 5 * time.Minute
+)
+
+// credentialErrorReasons maps the classifications of authorizer failures to condition reasons
+var credentialErrorReasons = []struct {
+	kind   error
+	reason string
+}{
+	{kind: authorizer.ErrIdentityNotFound, reason: msiacrpullv1beta2.ConditionReasonIdentityNotFound},
+	{kind: authorizer.ErrFederationMismatch, reason: msiacrpullv1beta2.ConditionReasonFederationMismatch},
+	{kind: authorizer.ErrRegistryUnauthorized, reason: msiacrpullv1beta2.ConditionReasonRegistryUnauthorized},
+	{kind: authorizer.ErrScopeDenied, reason: msiacrpullv1beta2.ConditionReasonScopeDenied},
+	{kind: authorizer.ErrRegistryNotFound, reason: msiacrpullv1beta2.ConditionReasonRegistryNotFound},
+	{kind: authorizer.ErrThrottled, reason: msiacrpullv1beta2.ConditionReasonThrottled},
+	{kind: authorizer.ErrTransient, reason: msiacrpullv1beta2.ConditionReasonTransientError},
+	{kind: authorizer.ErrVerificationFailed, reason: msiacrpullv1beta2.ConditionReasonVerificationFailed},
+	{kind: authorizer.ErrManifestNotFound, reason: msiacrpullv1beta2.ConditionReasonVerificationFailed},
+}
+
+// credentialErrorMessage describes a failure to issue a credential, along with how to remediate it, if we know
+func credentialErrorMessage(err error) string {
+	if hint := authorizer.Hint(err); hint != "" {
+		return fmt.Sprintf("%v. %s", err, hint)
+	}
+	return err.Error()
+}
+
+// credentialErrorRequeue determines how soon to retry issuing a credential after the failure; unclassified failures
+// are retried on the usual schedule
+func credentialErrorRequeue(err error) time.Duration {
+	switch {
+	case authorizer.Retryable(err):
+		return transientErrorRequeue
+	case authorizer.Classified(err):
+		return permanentErrorRequeue
+	default:
+		return 0
+	}
+}
+
+func credentialIssuedCondition(err error, generation int64, now func() time.Time) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               msiacrpullv1beta2.ConditionTypeCredentialIssued,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		LastTransitionTime: metav1.NewTime(now()),
+		Reason:             msiacrpullv1beta2.ConditionReasonCredentialIssued,
+		Message:            "pull credential issued",
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = msiacrpullv1beta2.ConditionReasonCredentialFailed
+		condition.Message = credentialErrorMessage(err)
+		for _, candidate := range credentialErrorReasons {
+			if errors.Is(err, candidate.kind) {
+				condition.Reason = candidate.reason
+				break
+			}
+		}
+	}
+	return condition
+}
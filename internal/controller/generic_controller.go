@@ -2,20 +2,30 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	msiacrpullv1beta1 "github.com/Azure/msi-acrpull/api/v1beta1"
 	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/internal/audit"
+	"github.com/Azure/msi-acrpull/internal/tracing"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	crclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -23,8 +33,10 @@ import (
 // genericReconciler reconciles AcrPullBindings
 type genericReconciler[O pullBinding] struct {
 	Client crclient.Client
-	Logger logr.Logger
-	Scheme *runtime.Scheme
+	// APIReader reads objects for the admission webhooks, if set, falling back to Client
+	APIReader crclient.Reader
+	Logger    logr.Logger
+	Scheme    *runtime.Scheme
 
 	NewBinding func() O
 
@@ -33,12 +45,34 @@ type genericReconciler[O pullBinding] struct {
 
 	GetServiceAccountName func(O) string
 	GetPullSecretName     func(O) string
-	GetInputsHash         func(O) string
-	ValidateBinding       func(O) error
-
-	CreatePullCredential func(context.Context, O, *corev1.ServiceAccount) (string, time.Time, error)
+	// ResolveReferences fetches the cluster resources the binding refers to by name, if the API version has any
+	ResolveReferences func(context.Context, crclient.Reader, O) (*bindingReferences, error)
+	GetInputsHash     func(O, *bindingReferences) string
+	ValidateBinding   func(O, *bindingReferences, *pullPolicies) error
+	// GetManagedIdentity returns the managed identity the binding uses, or empty strings for workload identities
+	GetManagedIdentity func(O) (clientID, resourceID string)
+
+	CreatePullCredential func(context.Context, O, *bindingReferences, *corev1.ServiceAccount) (*pullCredential, error)
+	// CheckServiceAccount determines if the service account has what CreatePullCredential needs from it, if anything
+	CheckServiceAccount func(O, *bindingReferences, *corev1.ServiceAccount) error
+	// VerifyPullCredential checks that the registry accepts a new pull credential before it replaces the current one,
+	// if set
+	VerifyPullCredential func(context.Context, O, *bindingReferences, *pullCredential) error
+	// ProbePullCredential probes the registry with the current pull credential if the binding configures a probe and
+	// one is due, returning nil otherwise
+	ProbePullCredential func(context.Context, O, *bindingReferences, *corev1.Secret) *probeOutcome
+	// RecordProbe records the outcome of a probe in the status of the binding, which must already be a copy we're free
+	// to mutate
+	RecordProbe func(O, *probeOutcome) O
 
 	UpdateStatusError func(O, string) O
+	// GetConditions exposes the conditions in the binding's status for mutation, if the API version has them
+	GetConditions func(O) *[]metav1.Condition
+	// GetRequestedScope returns the scope the binding requests from the registry
+	GetRequestedScope func(O, *bindingReferences) string
+	// GetGrantedScope exposes the scope granted by the registry in the binding's status for mutation, if the API version
+	// records it
+	GetGrantedScope func(O) *string
 
 	NeedsRefresh func(logr.Logger, *corev1.Secret, func() time.Time) bool
 	RequeueAfter func(now func() time.Time) func(O) time.Duration
@@ -48,11 +82,50 @@ type genericReconciler[O pullBinding] struct {
 
 	LabelSelector func() (labels.Selector, error)
 
+	// AuditSink receives a record of every pull credential issued, if set
+	AuditSink audit.Sink
+
+	EnforcePullPolicies bool
+	RequirePullPolicy   bool
+	// AuthorizeIdentityUse requires the author of a pull binding to be authorized to use its managed identity
+	AuthorizeIdentityUse bool
+
+	// Tracer records a span for each reconciliation and for the steps taken to issue a pull credential
+	Tracer trace.Tracer
+
+	// Recorder records events on pull bindings, if set
+	Recorder record.EventRecorder
+
+	// OwnsNamespace determines whether this replica reconciles pull bindings in a namespace, if set
+	OwnsNamespace func(namespace string) bool
+
+	// MaxConcurrentReconciles is the number of pull bindings reconciled at once
+	MaxConcurrentReconciles int
+
 	now func() time.Time
 }
 
-func (r *genericReconciler[O]) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+// tracerName identifies the spans recorded by the controllers
+const tracerName = "github.com/Azure/msi-acrpull/internal/controller"
+
+func (r *genericReconciler[O]) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := r.Tracer.Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("acrpullbinding.namespace", req.Namespace),
+		attribute.String("acrpullbinding.name", req.Name),
+	))
+	defer func() {
+		tracing.End(span, err)
+	}()
 	logger := r.Logger.WithValues("acrpullbinding", req.NamespacedName)
+	if span.SpanContext().IsSampled() {
+		logger = logger.WithValues("traceID", span.SpanContext().TraceID().String())
+	}
+
+	// requests may still be queued for namespaces in shards we have since handed over to another replica
+	if r.OwnsNamespace != nil && !r.OwnsNamespace(req.Namespace) {
+		logger.V(4).Info("skipping reconcile: namespace is not in a shard owned by this replica")
+		return ctrl.Result{}, nil
+	}
 
 	acrBinding := r.NewBinding()
 	if err := r.Client.Get(ctx, req.NamespacedName, acrBinding); err != nil {
@@ -118,12 +191,34 @@ func (r *genericReconciler[O]) Reconcile(ctx context.Context, req ctrl.Request)
 		referencingServiceAccounts = append(referencingServiceAccounts, serviceAccountList.Items...)
 	}
 
-	action := r.reconcile(ctx, logger, acrBinding, serviceAccount, pullSecrets.Items, referencingServiceAccounts)
+	// policies only admit live bindings, so failing to fetch them must not hold up the clean-up of deleted ones
+	var policies *pullPolicies
+	if r.EnforcePullPolicies && acrBinding.GetDeletionTimestamp().IsZero() {
+		policies, err = fetchPullPolicies(ctx, r.Client, req.Namespace, r.RequirePullPolicy)
+		if err != nil {
+			logger.Error(err, "failed to fetch pull policies")
+			return ctrl.Result{}, err
+		}
+	}
 
-	return action.execute(ctx, logger, r.Client, r.RequeueAfter(r.now))
+	references := &bindingReferences{}
+	if r.ResolveReferences != nil {
+		references, err = r.ResolveReferences(ctx, r.Client, acrBinding)
+		if err != nil {
+			logger.Error(err, "failed to resolve references")
+			return ctrl.Result{}, err
+		}
+	}
+
+	action := r.reconcile(ctx, logger, acrBinding, references, serviceAccount, pullSecrets.Items, referencingServiceAccounts, policies)
+
+	return action.execute(ctx, logger, r.Client, r.Tracer, r.Recorder, r.AuditSink, r.RequeueAfter(r.now))
 }
 
-func (r *genericReconciler[O]) reconcile(ctx context.Context, logger logr.Logger, acrBinding O, serviceAccount *corev1.ServiceAccount, pullSecrets []corev1.Secret, referencingServiceAccounts []corev1.ServiceAccount) *action[O] {
+func (r *genericReconciler[O]) reconcile(ctx context.Context, logger logr.Logger, acrBinding O, references *bindingReferences, serviceAccount *corev1.ServiceAccount, pullSecrets []corev1.Secret, referencingServiceAccounts []corev1.ServiceAccount, policies *pullPolicies) *action[O] {
+	if references == nil {
+		references = &bindingReferences{}
+	}
 	// examine DeletionTimestamp to determine if acr pull binding is under deletion
 	if acrBinding.GetDeletionTimestamp().IsZero() {
 		// the object is not being deleted, so if it does not have our finalizer,
@@ -137,10 +232,24 @@ func (r *genericReconciler[O]) reconcile(ctx context.Context, logger logr.Logger
 		return r.cleanUp(acrBinding, serviceAccount, pullSecrets, logger)
 	}
 
+	if references.missing != nil {
+		logger.Info(references.missing.Error())
+		return &action[O]{updatePullBindingStatus: r.UpdateStatusError(acrBinding, references.missing.Error())}
+	}
+
+	var conditions []metav1.Condition
 	if r.ValidateBinding != nil {
-		if err := r.ValidateBinding(acrBinding); err != nil {
+		if err := r.ValidateBinding(acrBinding, references, policies); err != nil {
 			logger.Info(err.Error())
-			return &action[O]{updatePullBindingStatus: r.UpdateStatusError(acrBinding, err.Error())}
+			updated := r.UpdateStatusError(acrBinding, err.Error())
+			var violation *policyViolationError
+			if errors.As(err, &violation) {
+				updated = r.setConditions(updated, policyCompliantCondition(violation, acrBinding.GetGeneration(), r.now))
+			}
+			return &action[O]{updatePullBindingStatus: updated}
+		}
+		if policies != nil {
+			conditions = append(conditions, policyCompliantCondition(nil, acrBinding.GetGeneration(), r.now))
 		}
 	}
 
@@ -179,27 +288,44 @@ func (r *genericReconciler[O]) reconcile(ctx context.Context, logger logr.Logger
 			pullSecret = &secret
 		}
 	}
-	inputHash := r.GetInputsHash(acrBinding)
+	inputHash := r.GetInputsHash(acrBinding, references)
 	pullSecretMissing := pullSecret == nil
 	pullSecretNeedsRefresh := !pullSecretMissing && r.NeedsRefresh(r.Logger, pullSecret, r.now)
 	pullSecretInputsChanged := !pullSecretMissing && pullSecret.Annotations[tokenInputsAnnotation] != inputHash
 	if pullSecretMissing || pullSecretNeedsRefresh || pullSecretInputsChanged {
 		logger.WithValues("pullSecretMissing", pullSecretMissing, "pullSecretNeedsRefresh", pullSecretNeedsRefresh, "pullSecretInputsChanged", pullSecretInputsChanged).Info("generating new pull credential")
 
-		dockerConfig, expiresOn, err := r.CreatePullCredential(ctx, acrBinding, serviceAccount)
+		credential, err := r.CreatePullCredential(ctx, acrBinding, references, serviceAccount)
 		if err != nil {
-			logger.Info(err.Error())
-			return &action[O]{updatePullBindingStatus: r.UpdateStatusError(acrBinding, err.Error())}
+			logger.WithValues("retryable", authorizer.Retryable(err)).Info(err.Error())
+			updated := r.setConditions(r.UpdateStatusError(acrBinding, credentialErrorMessage(err)), credentialIssuedCondition(err, acrBinding.GetGeneration(), r.now))
+			return &action[O]{updatePullBindingStatus: updated, requeueAfter: credentialErrorRequeue(err)}
 		}
 
-		newSecret := newPullSecret(acrBinding, r.GetPullSecretName(acrBinding), dockerConfig, r.Scheme, expiresOn, r.now, inputHash)
+		// a broken credential must not replace one that works, so we keep the current credential if the new one fails
+		if pullSecret != nil && r.VerifyPullCredential != nil {
+			if err := r.VerifyPullCredential(ctx, acrBinding, references, credential); err != nil {
+				err = fmt.Errorf("new pull credential failed verification, keeping the current one: %w", err)
+				logger.WithValues("retryable", authorizer.Retryable(err)).Info(err.Error())
+				updated := r.setConditions(r.UpdateStatusError(acrBinding, credentialErrorMessage(err)), credentialIssuedCondition(err, acrBinding.GetGeneration(), r.now))
+				return &action[O]{updatePullBindingStatus: updated, requeueAfter: credentialErrorRequeue(err)}
+			}
+		}
+
+		newSecret := newPullSecret(acrBinding, r.GetPullSecretName(acrBinding), credential.dockerConfig, r.Scheme, credential.expiresOn, r.now, inputHash)
+		if credential.grantedScope != nil {
+			newSecret.Annotations[tokenGrantedScopeAnnotation] = *credential.grantedScope
+		}
 		logger = logger.WithValues("secret", crclient.ObjectKeyFromObject(newSecret).String())
+		// credentials discarded after failing verification or a failed write are never handed out, so the credential is
+		// only audited once its secret is written
+		record := r.auditRecord(acrBinding, serviceAccount, credential)
 		if pullSecret == nil {
 			logger.Info("creating pull credential secret")
-			return &action[O]{createSecret: newSecret}
+			return &action[O]{createSecret: newSecret, audit: record}
 		} else {
 			logger.Info("updating pull credential secret")
-			return &action[O]{updateSecret: newSecret}
+			return &action[O]{updateSecret: newSecret, audit: record}
 		}
 	}
 
@@ -243,7 +369,40 @@ func (r *genericReconciler[O]) reconcile(ctx context.Context, logger logr.Logger
 		}
 	}
 
-	return r.setSuccessStatus(logger, acrBinding, pullSecret)
+	conditions = append(conditions, credentialIssuedCondition(nil, acrBinding.GetGeneration(), r.now))
+	grantedScope, scopeRecorded := pullSecret.Annotations[tokenGrantedScopeAnnotation]
+	if scopeRecorded && r.GetRequestedScope != nil && r.GetRequestedScope(acrBinding, references) != "" {
+		conditions = append(conditions, scopeFullyGrantedCondition(r.GetRequestedScope(acrBinding, references), grantedScope, acrBinding.GetGeneration(), r.now))
+	}
+	var probe *probeOutcome
+	if r.ProbePullCredential != nil {
+		probe = r.ProbePullCredential(ctx, acrBinding, references, pullSecret)
+	}
+	return r.setSuccessStatus(logger, acrBinding, pullSecret, grantedScope, conditions, probe)
+}
+
+// pullCredential is a registry credential issued for a pull binding
+type pullCredential struct {
+	dockerConfig string
+	expiresOn    time.Time
+	// token is the registry token in the credential
+	token azcore.AccessToken
+	// grantedScope is the access the registry granted in the credential, if the credential records it
+	grantedScope *string
+	// audit describes how the credential was issued; the binding's metadata is filled in when it is emitted
+	audit audit.Record
+}
+
+// auditRecord describes the issued credential for the audit log
+func (r *genericReconciler[O]) auditRecord(acrBinding O, serviceAccount *corev1.ServiceAccount, credential *pullCredential) *audit.Record {
+	record := credential.audit
+	record.Time = r.now()
+	record.BindingNamespace = acrBinding.GetNamespace()
+	record.BindingName = acrBinding.GetName()
+	record.BindingUID = string(acrBinding.GetUID())
+	record.ServiceAccount = serviceAccount.Name
+	record.ExpiresOn = credential.expiresOn
+	return &record
 }
 
 // sortPullSecrets ensures the semantically-correct ordering of pull secrets for the service account. The order of pull
@@ -333,13 +492,13 @@ func (r *genericReconciler[O]) cleanUp(acrBinding O,
 
 		// remove our finalizer from the list and update it.
 		log.Info("removing finalizer from pull binding")
-		return &action[O]{updatePullBinding: r.RemoveFinalizer(acrBinding, msiAcrPullFinalizerName)}
+		return &action[O]{updatePullBinding: r.RemoveFinalizer(acrBinding, msiAcrPullFinalizerName), forgetProbe: r.ProbePullCredential != nil}
 	}
 	log.Info("no finalizer present, nothing to do")
 	return nil
 }
 
-func (r *genericReconciler[O]) setSuccessStatus(log logr.Logger, acrBinding O, pullSecret *corev1.Secret) *action[O] {
+func (r *genericReconciler[O]) setSuccessStatus(log logr.Logger, acrBinding O, pullSecret *corev1.Secret, grantedScope string, conditions []metav1.Condition, probe *probeOutcome) *action[O] {
 	log = log.WithValues("secret", crclient.ObjectKeyFromObject(pullSecret).String())
 
 	// malformed expiry and refresh annotations indicate some other actor corrupted our pull credential secret;
@@ -369,33 +528,97 @@ func (r *genericReconciler[O]) setSuccessStatus(log logr.Logger, acrBinding O, p
 		return nil
 	}
 
-	if r.NeedsStatusUpdate(refresh, expiry, acrBinding) {
+	if r.NeedsStatusUpdate(refresh, expiry, acrBinding) || r.grantedScopeChanged(acrBinding, grantedScope) || r.conditionsChanged(acrBinding, conditions) || probe != nil {
 		log.Info("updating pull binding to reflect expiry and refresh time from secret")
-		return &action[O]{updatePullBindingStatus: r.UpdateStatus(refresh, expiry, acrBinding)}
+		warning := r.partialGrantWarning(acrBinding, conditions)
+		updated := r.setGrantedScope(r.setConditions(r.UpdateStatus(refresh, expiry, acrBinding), conditions...), grantedScope)
+		if probe != nil {
+			updated = r.RecordProbe(updated, probe)
+		}
+		return &action[O]{updatePullBindingStatus: updated, warning: warning, forgetProbe: probe != nil && probe.removed}
 	}
 	// there's nothing for us to do, but we must make sure that we re-queue for a refresh
 	return &action[O]{noop: acrBinding}
 }
 
-func (a *action[O]) execute(ctx context.Context, logger logr.Logger, client crclient.Client, refresh func(O) time.Duration) (ctrl.Result, error) {
+// setConditions records the conditions in the status of the binding, which must already be a copy we're free to mutate.
+func (r *genericReconciler[O]) setConditions(acrBinding O, conditions ...metav1.Condition) O {
+	if r.GetConditions == nil {
+		return acrBinding
+	}
+	for _, condition := range conditions {
+		apimeta.SetStatusCondition(r.GetConditions(acrBinding), condition)
+	}
+	return acrBinding
+}
+
+// conditionsChanged determines if recording the conditions would change the status of the binding
+func (r *genericReconciler[O]) conditionsChanged(acrBinding O, conditions []metav1.Condition) bool {
+	if r.GetConditions == nil {
+		return false
+	}
+	existing := *r.GetConditions(acrBinding)
+	for _, condition := range conditions {
+		current := apimeta.FindStatusCondition(existing, condition.Type)
+		if current == nil || current.Status != condition.Status || current.Reason != condition.Reason ||
+			current.Message != condition.Message || current.ObservedGeneration != condition.ObservedGeneration {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *action[O]) execute(ctx context.Context, logger logr.Logger, client crclient.Client, tracer trace.Tracer, recorder record.EventRecorder, sink audit.Sink, refresh func(O) time.Duration) (ctrl.Result, error) {
 	if a == nil {
 		return ctrl.Result{}, nil
 	}
 	a.validate()
 	if a.updatePullBinding != nil {
-		return ctrl.Result{}, client.Update(ctx, a.updatePullBinding)
+		if err := client.Update(ctx, a.updatePullBinding); err != nil {
+			return ctrl.Result{}, err
+		}
+		if a.forgetProbe {
+			forgetProbeOutcome(a.updatePullBinding.GetNamespace(), a.updatePullBinding.GetName())
+		}
+		return ctrl.Result{}, nil
 	} else if a.noop != nil {
 		after := clampRequeue(refresh(a.noop))
 		logger.WithValues("requeueAfter", after).Info("nothing to do, re-queueing for later processing")
 		return ctrl.Result{RequeueAfter: after}, nil
 	} else if a.updatePullBindingStatus != nil {
 		after := clampRequeue(refresh(a.updatePullBindingStatus))
+		if a.requeueAfter > 0 {
+			after = a.requeueAfter
+		}
 		logger.WithValues("requeueAfter", after).Info("re-queueing for later processing")
-		return ctrl.Result{RequeueAfter: after}, client.Status().Update(ctx, a.updatePullBindingStatus)
+		if err := client.Status().Update(ctx, a.updatePullBindingStatus); err != nil {
+			return ctrl.Result{}, err
+		}
+		if a.forgetProbe {
+			forgetProbeOutcome(a.updatePullBindingStatus.GetNamespace(), a.updatePullBindingStatus.GetName())
+		}
+		if a.warning != nil && recorder != nil {
+			recorder.Event(a.updatePullBindingStatus, corev1.EventTypeWarning, a.warning.Reason, a.warning.Message)
+		}
+		return ctrl.Result{RequeueAfter: after}, nil
 	} else if a.createSecret != nil {
-		return ctrl.Result{}, client.Create(ctx, a.createSecret)
+		ctx, span := tracer.Start(ctx, "CreatePullSecret", trace.WithAttributes(attribute.String("secret.name", a.createSecret.Name)))
+		err := client.Create(ctx, a.createSecret)
+		tracing.End(span, err)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		a.emitAuditRecord(ctx, logger, sink)
+		return ctrl.Result{}, nil
 	} else if a.updateSecret != nil {
-		return ctrl.Result{}, client.Update(ctx, a.updateSecret)
+		ctx, span := tracer.Start(ctx, "UpdatePullSecret", trace.WithAttributes(attribute.String("secret.name", a.updateSecret.Name)))
+		err := client.Update(ctx, a.updateSecret)
+		tracing.End(span, err)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		a.emitAuditRecord(ctx, logger, sink)
+		return ctrl.Result{}, nil
 	} else if a.deleteSecret != nil {
 		return ctrl.Result{}, client.Delete(ctx, a.deleteSecret)
 	} else if a.updateServiceAccount != nil {
@@ -405,6 +628,17 @@ func (a *action[O]) execute(ctx context.Context, logger logr.Logger, client crcl
 	return ctrl.Result{}, nil
 }
 
+// emitAuditRecord records the credential written by the action in the audit log; failures are logged, as the credential
+// has already been issued by the registry
+func (a *action[O]) emitAuditRecord(ctx context.Context, logger logr.Logger, sink audit.Sink) {
+	if a.audit == nil || sink == nil {
+		return
+	}
+	if err := sink.Emit(ctx, *a.audit); err != nil {
+		logger.Error(err, "failed to emit audit record")
+	}
+}
+
 // clampRequeue ensures that the requeue duration is greater than zero. Since we poll time.Now() more than once during
 // reconciliation, it may be possible to have the following sets of events:
 // t_refresh is when the credential should be refreshed based on our calculations
@@ -436,6 +670,21 @@ type action[O pullBinding] struct {
 	deleteSecret *corev1.Secret
 
 	updateServiceAccount *corev1.ServiceAccount
+
+	// requeueAfter overrides when to re-queue after updating the status of the binding, if set
+	requeueAfter time.Duration
+	// warning is recorded as an event on the binding once its status is updated, if set
+	warning *warningEvent
+	// forgetProbe drops the probe metric of the binding once it is updated, as it is no longer probed or is going away
+	forgetProbe bool
+	// audit is emitted to the audit log once the pull secret is written, if set
+	audit *audit.Record
+}
+
+// warningEvent describes a Warning event to record on a pull binding
+type warningEvent struct {
+	Reason  string
+	Message string
 }
 
 func (a *action[O]) validate() {
@@ -1,10 +1,19 @@
 package controller
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/internal/audit"
+	"github.com/go-logr/logr/testr"
 	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/trace/noop"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestSortPullSecrets(t *testing.T) {
@@ -41,3 +50,75 @@ func TestSortPullSecrets(t *testing.T) {
 		}
 	}
 }
+
+// recordingAuditSink records audit records in memory for tests
+type recordingAuditSink struct {
+	records []audit.Record
+}
+
+func (s *recordingAuditSink) Emit(_ context.Context, record audit.Record) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+// auditRecords returns the audit record carried by the action, if any
+func auditRecords[O pullBinding](a *action[O]) []audit.Record {
+	if a == nil || a.audit == nil {
+		return nil
+	}
+	return []audit.Record{*a.audit}
+}
+
+func TestActionExecute_audit(t *testing.T) {
+	secret := func() *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "acr-pull-binding"}}
+	}
+	record := audit.Record{BindingNamespace: "ns", BindingName: "binding"}
+
+	for _, testCase := range []struct {
+		name     string
+		existing []*corev1.Secret
+		action   *action[*msiacrpullv1beta2.AcrPullBinding]
+		wantErr  bool
+		want     []audit.Record
+	}{
+		{
+			name:   "created secret is audited",
+			action: &action[*msiacrpullv1beta2.AcrPullBinding]{createSecret: secret(), audit: &record},
+			want:   []audit.Record{record},
+		},
+		{
+			name:     "secret that failed to be created is not audited",
+			existing: []*corev1.Secret{secret()},
+			action:   &action[*msiacrpullv1beta2.AcrPullBinding]{createSecret: secret(), audit: &record},
+			wantErr:  true,
+		},
+		{
+			name:     "updated secret is audited",
+			existing: []*corev1.Secret{secret()},
+			action:   &action[*msiacrpullv1beta2.AcrPullBinding]{updateSecret: secret(), audit: &record},
+			want:     []audit.Record{record},
+		},
+		{
+			name:    "secret that failed to be updated is not audited",
+			action:  &action[*msiacrpullv1beta2.AcrPullBinding]{updateSecret: secret(), audit: &record},
+			wantErr: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme.Scheme)
+			for _, existing := range testCase.existing {
+				builder = builder.WithObjects(existing)
+			}
+			sink := &recordingAuditSink{}
+			refresh := func(*msiacrpullv1beta2.AcrPullBinding) time.Duration { return time.Hour }
+			_, err := testCase.action.execute(context.Background(), testr.New(t), builder.Build(), noop.NewTracerProvider().Tracer(""), nil, sink, refresh)
+			if testCase.wantErr != (err != nil) {
+				t.Errorf("expected error: %t, got %v", testCase.wantErr, err)
+			}
+			if diff := cmp.Diff(testCase.want, sink.records); diff != "" {
+				t.Errorf("unexpected audit records (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
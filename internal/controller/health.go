@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+)
+
+const (
+	// cacheSyncTimeout bounds how long a readiness probe waits for informer caches to sync
+	cacheSyncTimeout = time.Second
+	// identityCheckTimeout bounds how long an identity check waits for IMDS or Entra
+	identityCheckTimeout = 4 * time.Second
+	// identityCheckRetryInterval is how long a failed identity check is remembered, so that frequent probes do not
+	// overwhelm IMDS or Entra while they are unhealthy
+	identityCheckRetryInterval = 30 * time.Second
+	// identityCheckRefreshMargin is how long before expiry a cached ARM token is considered stale
+	identityCheckRefreshMargin = 5 * time.Minute
+	// authorityCheckInterval is how long a successful check of the Entra authority host is remembered
+	authorityCheckInterval = 5 * time.Minute
+)
+
+var leaderElected = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "acrpull_leader_elected",
+	Help: "Whether this replica currently holds the leader election lease and runs the controllers.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(leaderElected)
+}
+
+// NewCacheSyncCheck reports the replica as ready only once the informer caches have synced. Caches are started on
+// every replica, regardless of leader election, so that replicas waiting for the lease are ready to take over.
+func NewCacheSyncCheck(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informer caches have not synced")
+		}
+		return nil
+	}
+}
+
+// ReportLeaderElection records the leader election state of this replica in logs and metrics once elected
+func ReportLeaderElection(ctx context.Context, logger logr.Logger, elected <-chan struct{}) {
+	leaderElected.Set(0)
+	go func() {
+		select {
+		case <-elected:
+			logger.Info("elected leader, running controllers")
+			leaderElected.Set(1)
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// IdentityCheckOpts configures the identity health check; either or both of the managed identity and authority host
+// may be checked
+type IdentityCheckOpts struct {
+	// ManagedIdentityClientID and ManagedIdentityResourceID identify a managed identity to fetch ARM tokens for
+	ManagedIdentityClientID   string
+	ManagedIdentityResourceID string
+	// AuthorityHost is an Entra authority host, e.g. https://login.microsoftonline.com/, to check for reachability
+	AuthorityHost string
+
+	// exposed here to allow unit tests to over-write them
+	now          func() time.Time
+	fetchToken   func(context.Context, azidentity.ManagedIDKind) (time.Time, error)
+	getAuthority func(context.Context, string) error
+}
+
+// NewIdentityCheck returns a check that the configured identity endpoints are healthy, or nil if nothing is configured.
+// Successful results are cached, for the lifetime of the ARM token when checking a managed identity.
+func NewIdentityCheck(opts IdentityCheckOpts) healthz.Checker {
+	if opts.now == nil {
+		opts.now = time.Now
+	}
+	if opts.fetchToken == nil {
+		opts.fetchToken = func(ctx context.Context, id azidentity.ManagedIDKind) (time.Time, error) {
+			token, err := authorizer.AcquireARMToken(ctx, id)
+			return token.ExpiresOn, err
+		}
+	}
+	if opts.getAuthority == nil {
+		opts.getAuthority = getAuthorityMetadata
+	}
+
+	var checks []*cachedCheck
+	var id azidentity.ManagedIDKind
+	if opts.ManagedIdentityClientID != "" {
+		id = azidentity.ClientID(opts.ManagedIdentityClientID)
+	} else if opts.ManagedIdentityResourceID != "" {
+		id = azidentity.ResourceID(opts.ManagedIdentityResourceID)
+	}
+	if id != nil {
+		checks = append(checks, &cachedCheck{now: opts.now, probe: func(ctx context.Context) (time.Time, error) {
+			expiresOn, err := opts.fetchToken(ctx, id)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("failed to fetch ARM token for managed identity %s: %w", id, err)
+			}
+			return expiresOn.Add(-identityCheckRefreshMargin), nil
+		}})
+	}
+	if opts.AuthorityHost != "" {
+		checks = append(checks, &cachedCheck{now: opts.now, probe: func(ctx context.Context) (time.Time, error) {
+			if err := opts.getAuthority(ctx, opts.AuthorityHost); err != nil {
+				return time.Time{}, fmt.Errorf("failed to reach authority host %s: %w", opts.AuthorityHost, err)
+			}
+			return opts.now().Add(authorityCheckInterval), nil
+		}})
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), identityCheckTimeout)
+		defer cancel()
+		var errs []error
+		for _, check := range checks {
+			errs = append(errs, check.check(ctx))
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// cachedCheck remembers a successful probe until the time it returns, and a failed probe for a short interval
+type cachedCheck struct {
+	now   func() time.Time
+	probe func(context.Context) (time.Time, error)
+
+	lock       sync.Mutex
+	validUntil time.Time
+	err        error
+}
+
+func (c *cachedCheck) check(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.now().Before(c.validUntil) {
+		return c.err
+	}
+	validUntil, err := c.probe(ctx)
+	if err != nil {
+		validUntil = c.now().Add(identityCheckRetryInterval)
+	}
+	c.validUntil, c.err = validUntil, err
+	return err
+}
+
+// getAuthorityMetadata fetches the OpenID configuration from the authority host, which requires no credentials
+func getAuthorityMetadata(ctx context.Context, authorityHost string) error {
+	endpoint := strings.TrimSuffix(authorityHost, "/") + "/common/v2.0/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := authorizer.HTTPTransport().Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+func TestNewIdentityCheck(t *testing.T) {
+	if check := NewIdentityCheck(IdentityCheckOpts{}); check != nil {
+		t.Fatalf("expected no check without configuration")
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var tokenFetches, authorityFetches int
+	var tokenErr, authorityErr error
+	check := NewIdentityCheck(IdentityCheckOpts{
+		ManagedIdentityClientID: "client-id",
+		AuthorityHost:           "https://login.example.com/",
+		now: func() time.Time {
+			return now
+		},
+		fetchToken: func(_ context.Context, id azidentity.ManagedIDKind) (time.Time, error) {
+			if id.String() != "client-id" {
+				t.Errorf("unexpected identity %s", id)
+			}
+			tokenFetches++
+			return now.Add(time.Hour), tokenErr
+		},
+		getAuthority: func(_ context.Context, host string) error {
+			if host != "https://login.example.com/" {
+				t.Errorf("unexpected authority host %s", host)
+			}
+			authorityFetches++
+			return authorityErr
+		},
+	})
+
+	for _, step := range []struct {
+		name                 string
+		advance              time.Duration
+		tokenErr             error
+		authorityErr         error
+		wantErr              bool
+		wantTokenFetches     int
+		wantAuthorityFetches int
+	}{
+		{
+			name:                 "first check fetches a token and the authority metadata",
+			wantTokenFetches:     1,
+			wantAuthorityFetches: 1,
+		},
+		{
+			name:                 "results are cached",
+			advance:              time.Minute,
+			wantTokenFetches:     1,
+			wantAuthorityFetches: 1,
+		},
+		{
+			name:                 "authority is checked again after its interval",
+			advance:              authorityCheckInterval,
+			authorityErr:         errors.New("unreachable"),
+			wantErr:              true,
+			wantTokenFetches:     1,
+			wantAuthorityFetches: 2,
+		},
+		{
+			name:                 "failures are remembered for the retry interval",
+			advance:              identityCheckRetryInterval / 2,
+			wantErr:              true,
+			wantTokenFetches:     1,
+			wantAuthorityFetches: 2,
+		},
+		{
+			name:                 "failures are retried after the retry interval",
+			advance:              identityCheckRetryInterval,
+			wantTokenFetches:     1,
+			wantAuthorityFetches: 3,
+		},
+		{
+			name:                 "token is fetched again before it expires",
+			advance:              time.Hour - identityCheckRefreshMargin,
+			tokenErr:             errors.New("imds unavailable"),
+			wantErr:              true,
+			wantTokenFetches:     2,
+			wantAuthorityFetches: 4,
+		},
+	} {
+		now = now.Add(step.advance)
+		tokenErr, authorityErr = step.tokenErr, step.authorityErr
+		err := check(httptest.NewRequest("GET", "/readyz/identity", nil))
+		if (err != nil) != step.wantErr {
+			t.Errorf("%s: expected error %v, got %v", step.name, step.wantErr, err)
+		}
+		if tokenFetches != step.wantTokenFetches {
+			t.Errorf("%s: expected %d token fetches, got %d", step.name, step.wantTokenFetches, tokenFetches)
+		}
+		if authorityFetches != step.wantAuthorityFetches {
+			t.Errorf("%s: expected %d authority fetches, got %d", step.name, step.wantAuthorityFetches, authorityFetches)
+		}
+	}
+}
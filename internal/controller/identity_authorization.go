@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+const (
+	// identityUseVerb is the virtual verb a user must be granted on a managed identity to reference it in a pull binding
+	identityUseVerb = "use"
+	// managedIdentitiesResource is the virtual resource representing managed identities, named by client ID or by the
+	// name of the identity in its resource ID, lower-cased
+	managedIdentitiesResource = "managedidentities"
+)
+
+// managedIdentityName determines the name of the virtual managed identity resource that RBAC rules must refer to
+func managedIdentityName(clientID, resourceID string) string {
+	if clientID != "" {
+		return strings.ToLower(clientID)
+	}
+	if resourceID != "" {
+		return strings.ToLower(path.Base(path.Clean(resourceID)))
+	}
+	return ""
+}
+
+// authorizeIdentityUse determines if the user may use the managed identity in the namespace, using a
+// SubjectAccessReview so that cluster administrators may grant access to identities with ordinary RBAC
+func authorizeIdentityUse(ctx context.Context, client crclient.Client, user authenticationv1.UserInfo, namespace, identity string) error {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      identityUseVerb,
+				Group:     msiacrpullv1beta2.GroupVersion.Group,
+				Resource:  managedIdentitiesResource,
+				Name:      identity,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+		},
+	}
+	if err := client.Create(ctx, review); err != nil {
+		return fmt.Errorf("failed to review access to managed identity: %w", err)
+	}
+	if !review.Status.Allowed || review.Status.Denied {
+		message := fmt.Sprintf("user %q may not use managed identity %q in namespace %q: requires %q on %s.%s", user.Username, identity, namespace, identityUseVerb, managedIdentitiesResource, msiacrpullv1beta2.GroupVersion.Group)
+		if review.Status.Reason != "" {
+			message += ": " + review.Status.Reason
+		}
+		return errors.New(message)
+	}
+	return nil
+}
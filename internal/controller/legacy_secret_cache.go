@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LegacySecretCache builds the manager's cache while legacy pull secrets without labels remain on the cluster. The
+// cache's Secret informer is always filtered to the secrets we label, but until legacy token cleanup completes, reads
+// of Secrets are served from a second, unfiltered informer so that reconcilers can find the legacy secrets. Once
+// cleanup completes, the unfiltered informer is stopped and reads fall through to the filtered informer, without
+// needing to restart the process.
+type LegacySecretCache struct {
+	Logger logr.Logger
+	// New builds the filtered and unfiltered caches; if unset, cache.New is used
+	New cache.NewCacheFunc
+
+	lock  sync.Mutex
+	cache *legacySecretCache
+	done  bool
+}
+
+// NewCache is a cache.NewCacheFunc for the manager
+func (l *LegacySecretCache) NewCache(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+	newCache := l.New
+	if newCache == nil {
+		newCache = cache.New
+	}
+	filtered, err := newCache(config, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	unfilteredOpts := opts
+	unfilteredOpts.ByObject = make(map[client.Object]cache.ByObject, len(opts.ByObject))
+	for object, byObject := range opts.ByObject {
+		if _, isSecret := object.(*corev1.Secret); isSecret {
+			continue
+		}
+		unfilteredOpts.ByObject[object] = byObject
+	}
+	unfiltered, err := newCache(config, unfilteredOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.cache = newLegacySecretCache(l.Logger, filtered, unfiltered)
+	if l.done {
+		l.cache.stopUnfiltered()
+	}
+	return l.cache, nil
+}
+
+// CleanupComplete stops the unfiltered Secret informer, serving Secrets from the filtered informer from now on
+func (l *LegacySecretCache) CleanupComplete() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.done = true
+	if l.cache != nil {
+		l.cache.stopUnfiltered()
+	}
+}
+
+// legacySecretCache routes reads of Secrets to an unfiltered cache until it is stopped
+type legacySecretCache struct {
+	cache.Cache
+	logger logr.Logger
+
+	lock       sync.RWMutex
+	unfiltered cache.Cache
+	cancel     context.CancelFunc
+}
+
+func newLegacySecretCache(logger logr.Logger, filtered, unfiltered cache.Cache) *legacySecretCache {
+	return &legacySecretCache{Cache: filtered, logger: logger, unfiltered: unfiltered}
+}
+
+func (c *legacySecretCache) secretReader(object runtime.Object) client.Reader {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.unfiltered != nil {
+		switch object.(type) {
+		case *corev1.Secret, *corev1.SecretList:
+			return c.unfiltered
+		}
+	}
+	return c.Cache
+}
+
+func (c *legacySecretCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.secretReader(obj).Get(ctx, key, obj, opts...)
+}
+
+func (c *legacySecretCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.secretReader(list).List(ctx, list, opts...)
+}
+
+func (c *legacySecretCache) IndexField(ctx context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	if err := c.Cache.IndexField(ctx, obj, field, extractValue); err != nil {
+		return err
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if _, isSecret := obj.(*corev1.Secret); isSecret && c.unfiltered != nil {
+		return c.unfiltered.IndexField(ctx, obj, field, extractValue)
+	}
+	return nil
+}
+
+func (c *legacySecretCache) Start(ctx context.Context) error {
+	c.lock.Lock()
+	if c.unfiltered != nil {
+		unfilteredCtx, cancel := context.WithCancel(ctx)
+		c.cancel = cancel
+		// register the Secret informer up-front, so that waiting for the cache to sync includes it
+		if _, err := c.unfiltered.GetInformer(unfilteredCtx, &corev1.Secret{}, cache.BlockUntilSynced(false)); err != nil {
+			c.lock.Unlock()
+			cancel()
+			return err
+		}
+		go func(unfiltered cache.Cache) {
+			if err := unfiltered.Start(unfilteredCtx); err != nil {
+				c.logger.Error(err, "unfiltered Secret cache failed")
+			}
+		}(c.unfiltered)
+	}
+	c.lock.Unlock()
+	return c.Cache.Start(ctx)
+}
+
+func (c *legacySecretCache) WaitForCacheSync(ctx context.Context) bool {
+	c.lock.RLock()
+	unfiltered := c.unfiltered
+	c.lock.RUnlock()
+	if unfiltered != nil && !unfiltered.WaitForCacheSync(ctx) {
+		return false
+	}
+	return c.Cache.WaitForCacheSync(ctx)
+}
+
+func (c *legacySecretCache) stopUnfiltered() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.unfiltered == nil {
+		return
+	}
+	c.logger.Info("legacy token cleanup complete, serving Secrets from the label-filtered cache")
+	c.unfiltered = nil
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeCache serves reads from a fake client and records the fields indexed and whether it is running
+type fakeCache struct {
+	*informertest.FakeInformers
+	reader  crclient.Reader
+	indexed []string
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func newFakeCache(objects ...crclient.Object) *fakeCache {
+	return &fakeCache{
+		FakeInformers: &informertest.FakeInformers{},
+		reader:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build(),
+		started:       make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+}
+
+func (c *fakeCache) Get(ctx context.Context, key crclient.ObjectKey, obj crclient.Object, opts ...crclient.GetOption) error {
+	return c.reader.Get(ctx, key, obj, opts...)
+}
+
+func (c *fakeCache) List(ctx context.Context, list crclient.ObjectList, opts ...crclient.ListOption) error {
+	return c.reader.List(ctx, list, opts...)
+}
+
+func (c *fakeCache) IndexField(_ context.Context, _ crclient.Object, field string, _ crclient.IndexerFunc) error {
+	c.indexed = append(c.indexed, field)
+	return nil
+}
+
+func (c *fakeCache) Start(ctx context.Context) error {
+	close(c.started)
+	<-ctx.Done()
+	close(c.stopped)
+	return nil
+}
+
+func TestLegacySecretCache(t *testing.T) {
+	labelled := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "acr-pull-binding", Labels: map[string]string{ACRPullBindingLabel: "binding"}}}
+	legacy := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "binding-msi-acrpull-secret"}}
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "default"}}
+	filtered := newFakeCache(labelled, serviceAccount)
+	unfiltered := newFakeCache(labelled, legacy)
+
+	c := newLegacySecretCache(logr.Discard(), filtered, unfiltered)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.IndexField(ctx, &corev1.Secret{}, pullBindingField, indexPullSecretByPullBinding); err != nil {
+		t.Fatalf("failed to index secrets: %v", err)
+	}
+	if err := c.IndexField(ctx, &corev1.ServiceAccount{}, imagePullSecretsField, indexPullSecretByPullBinding); err != nil {
+		t.Fatalf("failed to index service accounts: %v", err)
+	}
+	if diff := cmp.Diff([]string{pullBindingField, imagePullSecretsField}, filtered.indexed); diff != "" {
+		t.Errorf("unexpected fields indexed in the filtered cache (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{pullBindingField}, unfiltered.indexed); diff != "" {
+		t.Errorf("unexpected fields indexed in the unfiltered cache (-want, +got):\n%s", diff)
+	}
+	go func() {
+		_ = c.Start(ctx)
+	}()
+	for _, started := range []chan struct{}{filtered.started, unfiltered.started} {
+		select {
+		case <-started:
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("expected the caches to start")
+		}
+	}
+
+	secretNames := func() []string {
+		var secrets corev1.SecretList
+		if err := c.List(ctx, &secrets); err != nil {
+			t.Fatalf("failed to list secrets: %v", err)
+		}
+		var names []string
+		for _, secret := range secrets.Items {
+			names = append(names, secret.Name)
+		}
+		return names
+	}
+	if diff := cmp.Diff([]string{"acr-pull-binding", "binding-msi-acrpull-secret"}, secretNames()); diff != "" {
+		t.Errorf("expected secrets from the unfiltered cache during cleanup (-want, +got):\n%s", diff)
+	}
+	if err := c.Get(ctx, crclient.ObjectKeyFromObject(serviceAccount), &corev1.ServiceAccount{}); err != nil {
+		t.Errorf("expected other objects from the filtered cache: %v", err)
+	}
+
+	c.stopUnfiltered()
+	select {
+	case <-unfiltered.stopped:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected the unfiltered cache to stop")
+	}
+	if diff := cmp.Diff([]string{"acr-pull-binding"}, secretNames()); diff != "" {
+		t.Errorf("expected secrets from the filtered cache after cleanup (-want, +got):\n%s", diff)
+	}
+}
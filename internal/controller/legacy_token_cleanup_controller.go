@@ -2,18 +2,21 @@ package controller
 
 import (
 	"context"
-	"os"
-	"slices"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	msiacrpullv1beta1 "github.com/Azure/msi-acrpull/api/v1beta1"
@@ -25,6 +28,15 @@ const (
 	imagePullSecretsField = ".imagePullSecrets"
 )
 
+var legacyPullSecretsUnlabelled = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "acrpull_legacy_pull_secrets_unlabelled",
+	Help: "The number of legacy pull secrets that legacy token cleanup has yet to label.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(legacyPullSecretsUnlabelled)
+}
+
 func indexPullBindingByServiceAccount(object client.Object) []string {
 	acrPullBinding, ok := object.(*msiacrpullv1beta1.AcrPullBinding)
 	if !ok {
@@ -53,9 +65,18 @@ func enqueuePullBindingsForServiceAccount(mgr ctrl.Manager) func(ctx context.Con
 type LegacyTokenCleanupController struct {
 	Client client.Client
 	Log    logr.Logger
+
+	// OnCleanupComplete is called once no legacy pull secrets remain without labels, so that the caller can stop
+	// watching Secrets the controller does not manage
+	OnCleanupComplete func()
+
+	now func() time.Time
 }
 
 func (c *LegacyTokenCleanupController) SetupWithManager(_ context.Context, mgr ctrl.Manager) error {
+	if c.now == nil {
+		c.now = time.Now
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		Named("legacy-token-cleanup").
 		For(&msiacrpullv1beta1.AcrPullBinding{}).
@@ -94,16 +115,37 @@ func (c *LegacyTokenCleanupController) Reconcile(ctx context.Context, req ctrl.R
 }
 
 func (c *LegacyTokenCleanupController) reconcile(acrBinding *msiacrpullv1beta1.AcrPullBinding, legacySecret *corev1.Secret) *cleanupAction {
+	status := metav1.ConditionTrue
+	reason := msiacrpullv1beta1.ConditionReasonLegacyPullSecretAbsent
+	message := "The binding has no legacy pull secret."
 	if legacySecret != nil {
-		if _, labelled := legacySecret.Labels[ACRPullBindingLabel]; labelled {
-			// legacy secret already labelled, so there's nothing left to do for this pull binding. In this case, it is
-			// possible that every object that required cleanup is already gone; in which case we should exit the
-			// process, so the Pod that succeeds us can filter the informers used to drive the controller and stop
-			// having to track extraneous objects
-			c.Log.Info("checking to see if legacy token cleanup is complete")
-			return &cleanupAction{checkCompletion: true}
+		reason = msiacrpullv1beta1.ConditionReasonLegacyPullSecretLabelled
+		message = "The legacy pull secret has been labelled."
+		if _, labelled := legacySecret.Labels[ACRPullBindingLabel]; !labelled {
+			status = metav1.ConditionFalse
+			reason = msiacrpullv1beta1.ConditionReasonLegacyPullSecretPending
+			message = "The legacy pull secret has yet to be labelled."
 		}
+	}
+
+	// we report that labelling is pending before labelling the secret, so that bindings still waiting on it can be told
+	// apart from those we have not examined
+	current := apimeta.FindStatusCondition(acrBinding.Status.Conditions, msiacrpullv1beta1.ConditionTypeLegacyPullSecretLabelled)
+	if current == nil || current.Status != status || current.Reason != reason || current.ObservedGeneration != acrBinding.Generation {
+		updated := acrBinding.DeepCopy()
+		apimeta.SetStatusCondition(&updated.Status.Conditions, metav1.Condition{
+			Type:               msiacrpullv1beta1.ConditionTypeLegacyPullSecretLabelled,
+			Status:             status,
+			ObservedGeneration: acrBinding.Generation,
+			LastTransitionTime: metav1.NewTime(c.now()),
+			Reason:             reason,
+			Message:            message,
+		})
+		c.Log.Info("recording legacy pull secret cleanup in pull binding status")
+		return &cleanupAction{updatePullBindingStatus: updated}
+	}
 
+	if status == metav1.ConditionFalse {
 		updated := legacySecret.DeepCopy()
 		if updated.Labels == nil {
 			updated.Labels = map[string]string{}
@@ -112,10 +154,9 @@ func (c *LegacyTokenCleanupController) reconcile(acrBinding *msiacrpullv1beta1.A
 		c.Log.WithValues("secretNamespace", updated.Namespace, "secretName", updated.Name).Info("adding label to pull secret")
 		return &cleanupAction{updateSecret: updated}
 	}
-	// legacy secret gone, so there's nothing left to do for this pull binding. In this case, it is
-	// possible that every object that required cleanup is already gone; in which case we should exit the
-	// process, so the Pod that succeeds us can filter the informers used to drive the controller and stop
-	// having to track extraneous objects
+
+	// there's nothing left to do for this pull binding. In this case, it is possible that every object that required
+	// cleanup is already handled; in which case we can stop tracking extraneous objects
 	c.Log.Info("checking to see if legacy token cleanup is complete")
 	return &cleanupAction{checkCompletion: true}
 }
@@ -126,7 +167,10 @@ func (c *LegacyTokenCleanupController) execute(ctx context.Context, action *clea
 	}
 	action.validate()
 	if action.updateSecret != nil {
-		return ctrl.Result{}, c.Client.Update(ctx, action.updateSecret)
+		// we don't watch Secrets, so we come back to record that the secret has been labelled
+		return ctrl.Result{Requeue: true}, c.Client.Update(ctx, action.updateSecret)
+	} else if action.updatePullBindingStatus != nil {
+		return ctrl.Result{}, c.Client.Status().Update(ctx, action.updatePullBindingStatus)
 	} else if action.checkCompletion {
 		return ctrl.Result{}, c.checkCompletion(ctx)
 	}
@@ -134,8 +178,9 @@ func (c *LegacyTokenCleanupController) execute(ctx context.Context, action *clea
 }
 
 type cleanupAction struct {
-	updateSecret    *corev1.Secret
-	checkCompletion bool
+	updateSecret            *corev1.Secret
+	updatePullBindingStatus *msiacrpullv1beta1.AcrPullBinding
+	checkCompletion         bool
 }
 
 func (a *cleanupAction) validate() {
@@ -143,6 +188,9 @@ func (a *cleanupAction) validate() {
 	if a.updateSecret != nil {
 		present++
 	}
+	if a.updatePullBindingStatus != nil {
+		present++
+	}
 	if a.checkCompletion {
 		present++
 	}
@@ -162,22 +210,34 @@ func (c *LegacyTokenCleanupController) checkCompletion(ctx context.Context) erro
 		return err
 	}
 
-	if !LegacyPullSecretsPresentWithoutLabels(pullBindings, secrets) {
-		c.Log.Info("no more legacy pull secrets present, restarting...")
-		os.Exit(0)
+	remaining := CountLegacyPullSecretsWithoutLabels(pullBindings, secrets)
+	legacyPullSecretsUnlabelled.Set(float64(remaining))
+	if remaining == 0 {
+		c.Log.Info("no more legacy pull secrets present")
+		if c.OnCleanupComplete != nil {
+			c.OnCleanupComplete()
+		}
 	}
 	return nil
 }
 
 // LegacyPullSecretsPresentWithoutLabels determines if any legacy pull secrets still exist on the cluster without labels.
 func LegacyPullSecretsPresentWithoutLabels(pullBindings msiacrpullv1beta1.AcrPullBindingList, secrets corev1.SecretList) bool {
+	return CountLegacyPullSecretsWithoutLabels(pullBindings, secrets) > 0
+}
+
+// CountLegacyPullSecretsWithoutLabels counts the legacy pull secrets on the cluster without labels.
+func CountLegacyPullSecretsWithoutLabels(pullBindings msiacrpullv1beta1.AcrPullBindingList, secrets corev1.SecretList) int {
 	secretNames := sets.Set[string]{}
 	for _, pullBinding := range pullBindings.Items {
 		secretNames.Insert(legacySecretName(pullBinding.Name))
 	}
 
-	return slices.ContainsFunc(secrets.Items, func(secret corev1.Secret) bool {
-		_, labelled := secret.Labels[ACRPullBindingLabel]
-		return secretNames.Has(secret.Name) && !labelled
-	})
+	var count int
+	for _, secret := range secrets.Items {
+		if _, labelled := secret.Labels[ACRPullBindingLabel]; secretNames.Has(secret.Name) && !labelled {
+			count++
+		}
+	}
+	return count
 }
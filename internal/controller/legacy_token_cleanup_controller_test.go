@@ -1,11 +1,16 @@
 package controller
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -13,6 +18,7 @@ import (
 )
 
 func Test_LegacyTokenCleanupController_reconcile(t *testing.T) {
+	fakeNow := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 	for _, testCase := range []struct {
 		name         string
 		acrBinding   *msiacrpullv1beta1.AcrPullBinding
@@ -21,11 +27,41 @@ func Test_LegacyTokenCleanupController_reconcile(t *testing.T) {
 		action *cleanupAction
 	}{
 		{
-			name: "legacy secret exists, label the secret",
+			name: "legacy secret exists, record that labelling is pending",
 			acrBinding: &msiacrpullv1beta1.AcrPullBinding{
 				ObjectMeta: metav1.ObjectMeta{Name: "binding"},
 			},
 			legacySecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "binding-msi-acrpull-secret"}},
+			action: &cleanupAction{
+				updatePullBindingStatus: &msiacrpullv1beta1.AcrPullBinding{
+					ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+					Status: msiacrpullv1beta1.AcrPullBindingStatus{
+						Conditions: []metav1.Condition{{
+							Type:               "LegacyPullSecretLabelled",
+							Status:             metav1.ConditionFalse,
+							LastTransitionTime: metav1.NewTime(fakeNow),
+							Reason:             "LabelPending",
+							Message:            "The legacy pull secret has yet to be labelled.",
+						}},
+					},
+				},
+			},
+		},
+		{
+			name: "legacy secret exists, pending condition recorded, label the secret",
+			acrBinding: &msiacrpullv1beta1.AcrPullBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+				Status: msiacrpullv1beta1.AcrPullBindingStatus{
+					Conditions: []metav1.Condition{{
+						Type:               "LegacyPullSecretLabelled",
+						Status:             metav1.ConditionFalse,
+						LastTransitionTime: metav1.NewTime(fakeNow.Add(-time.Hour)),
+						Reason:             "LabelPending",
+						Message:            "The legacy pull secret has yet to be labelled.",
+					}},
+				},
+			},
+			legacySecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "binding-msi-acrpull-secret"}},
 			action: &cleanupAction{
 				updateSecret: &corev1.Secret{
 					ObjectMeta: metav1.ObjectMeta{
@@ -38,10 +74,68 @@ func Test_LegacyTokenCleanupController_reconcile(t *testing.T) {
 			},
 		},
 		{
-			name: "legacy secret exists, already labelled, check for done",
+			name: "legacy secret exists, already labelled, record the condition",
+			acrBinding: &msiacrpullv1beta1.AcrPullBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "binding", Generation: 2},
+			},
+			legacySecret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "binding-msi-acrpull-secret",
+					Labels: map[string]string{
+						"acr.microsoft.com/binding": "binding",
+					},
+				},
+			},
+			action: &cleanupAction{
+				updatePullBindingStatus: &msiacrpullv1beta1.AcrPullBinding{
+					ObjectMeta: metav1.ObjectMeta{Name: "binding", Generation: 2},
+					Status: msiacrpullv1beta1.AcrPullBindingStatus{
+						Conditions: []metav1.Condition{{
+							Type:               "LegacyPullSecretLabelled",
+							Status:             metav1.ConditionTrue,
+							ObservedGeneration: 2,
+							LastTransitionTime: metav1.NewTime(fakeNow),
+							Reason:             "Labelled",
+							Message:            "The legacy pull secret has been labelled.",
+						}},
+					},
+				},
+			},
+		},
+		{
+			name: "legacy secret gone, record the condition",
 			acrBinding: &msiacrpullv1beta1.AcrPullBinding{
 				ObjectMeta: metav1.ObjectMeta{Name: "binding"},
 			},
+			action: &cleanupAction{
+				updatePullBindingStatus: &msiacrpullv1beta1.AcrPullBinding{
+					ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+					Status: msiacrpullv1beta1.AcrPullBindingStatus{
+						Conditions: []metav1.Condition{{
+							Type:               "LegacyPullSecretLabelled",
+							Status:             metav1.ConditionTrue,
+							LastTransitionTime: metav1.NewTime(fakeNow),
+							Reason:             "NoLegacyPullSecret",
+							Message:            "The binding has no legacy pull secret.",
+						}},
+					},
+				},
+			},
+		},
+		{
+			name: "legacy secret exists, already labelled, condition recorded, check for done",
+			acrBinding: &msiacrpullv1beta1.AcrPullBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+				Status: msiacrpullv1beta1.AcrPullBindingStatus{
+					Conditions: []metav1.Condition{{
+						Type:               "LegacyPullSecretLabelled",
+						Status:             metav1.ConditionTrue,
+						LastTransitionTime: metav1.NewTime(fakeNow.Add(-time.Hour)),
+						Reason:             "Labelled",
+						Message:            "The legacy pull secret has been labelled.",
+					}},
+				},
+			},
 			legacySecret: &corev1.Secret{
 				ObjectMeta: metav1.ObjectMeta{
 					Name: "binding-msi-acrpull-secret",
@@ -59,6 +153,9 @@ func Test_LegacyTokenCleanupController_reconcile(t *testing.T) {
 			controller := LegacyTokenCleanupController{
 				Client: nil,
 				Log:    ctrl.Log.WithName("test"),
+				now: func() time.Time {
+					return fakeNow
+				},
 			}
 			got := controller.reconcile(testCase.acrBinding, testCase.legacySecret)
 			if diff := cmp.Diff(testCase.action, got, cmp.AllowUnexported(cleanupAction{})); diff != "" {
@@ -67,3 +164,51 @@ func Test_LegacyTokenCleanupController_reconcile(t *testing.T) {
 		})
 	}
 }
+
+func Test_LegacyTokenCleanupController_checkCompletion(t *testing.T) {
+	if err := msiacrpullv1beta1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	binding := &msiacrpullv1beta1.AcrPullBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "binding"}}
+	legacySecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "binding-msi-acrpull-secret"}}
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(binding, legacySecret).Build()
+
+	var completed int
+	controller := LegacyTokenCleanupController{
+		Client: client,
+		Log:    ctrl.Log.WithName("test"),
+		OnCleanupComplete: func() {
+			completed++
+		},
+	}
+	if err := controller.checkCompletion(context.Background()); err != nil {
+		t.Fatalf("failed to check completion: %v", err)
+	}
+	if completed != 0 {
+		t.Errorf("expected cleanup to be incomplete with an unlabelled legacy secret")
+	}
+	if remaining := testutil.ToFloat64(legacyPullSecretsUnlabelled); remaining != 1 {
+		t.Errorf("expected 1 unlabelled legacy secret to be reported, got %v", remaining)
+	}
+	// the startup check counts secrets before the cleanup controller runs, and must not overwrite what it reports
+	if LegacyPullSecretsPresentWithoutLabels(msiacrpullv1beta1.AcrPullBindingList{}, corev1.SecretList{}) {
+		t.Errorf("expected no unlabelled legacy secrets without bindings")
+	}
+	if remaining := testutil.ToFloat64(legacyPullSecretsUnlabelled); remaining != 1 {
+		t.Errorf("expected counting legacy secrets to leave the reported count alone, got %v", remaining)
+	}
+
+	legacySecret.Labels = map[string]string{ACRPullBindingLabel: "binding"}
+	if err := client.Update(context.Background(), legacySecret); err != nil {
+		t.Fatalf("failed to label legacy secret: %v", err)
+	}
+	if err := controller.checkCompletion(context.Background()); err != nil {
+		t.Fatalf("failed to check completion: %v", err)
+	}
+	if completed != 1 {
+		t.Errorf("expected cleanup to complete once the legacy secret is labelled")
+	}
+	if remaining := testutil.ToFloat64(legacyPullSecretsUnlabelled); remaining != 0 {
+		t.Errorf("expected no unlabelled legacy secrets to be reported, got %v", remaining)
+	}
+}
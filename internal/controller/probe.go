@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+)
+
+var probeSucceeded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "acrpull_binding_probe_succeeded",
+	Help: "Whether the last probe of the registry with the current pull credential of an AcrPullBinding succeeded.",
+}, []string{"namespace", "name", "server"})
+
+func init() {
+	metrics.Registry.MustRegister(probeSucceeded)
+}
+
+type registryProber func(ctx context.Context, acrFQDN string, token azcore.AccessToken, manifest string) error
+
+// probeOutcome records when the registry was probed with the current pull credential, and how that went
+type probeOutcome struct {
+	time    time.Time
+	result  msiacrpullv1beta2.ProbeResult
+	message string
+
+	// removed is set when the binding no longer configures a probe, so the outcome of its last one must be forgotten
+	removed bool
+}
+
+// probeResults maps the classifications of probe failures to their outcome
+var probeResults = []struct {
+	kind   error
+	result msiacrpullv1beta2.ProbeResult
+}{
+	{kind: authorizer.ErrVerificationFailed, result: msiacrpullv1beta2.ProbeResultUnauthorized},
+	{kind: authorizer.ErrRegistryNotFound, result: msiacrpullv1beta2.ProbeResultNotFound},
+	{kind: authorizer.ErrManifestNotFound, result: msiacrpullv1beta2.ProbeResultNotFound},
+	{kind: authorizer.ErrThrottled, result: msiacrpullv1beta2.ProbeResultUnreachable},
+	{kind: authorizer.ErrTransient, result: msiacrpullv1beta2.ProbeResultUnreachable},
+}
+
+func newProbeOutcome(err error, now time.Time) *probeOutcome {
+	outcome := &probeOutcome{time: now, result: msiacrpullv1beta2.ProbeResultSucceeded}
+	if err != nil {
+		outcome.result = msiacrpullv1beta2.ProbeResultFailed
+		outcome.message = credentialErrorMessage(err)
+		for _, candidate := range probeResults {
+			if errors.Is(err, candidate.kind) {
+				outcome.result = candidate.result
+				break
+			}
+		}
+	}
+	return outcome
+}
+
+// probeDue determines if the registry should be probed, as it never has been or the interval has passed since it was
+func probeDue(probe *msiacrpullv1beta2.ProbeConfiguration, lastProbeTime *metav1.Time, now func() time.Time) bool {
+	return lastProbeTime == nil || !now().Before(lastProbeTime.Add(probe.Interval.Duration))
+}
+
+// probeManifest formats the manifest probed as <repository>:<tag> or <repository>@<digest>
+func probeManifest(probe *msiacrpullv1beta2.ProbeConfiguration) string {
+	reference := probe.Reference
+	if reference == "" {
+		reference = "latest"
+	}
+	separator := ":"
+	if strings.Contains(reference, ":") {
+		separator = "@"
+	}
+	return probe.Repository + separator + reference
+}
+
+// recordProbeOutcome exposes the outcome of the last probe for the binding as a metric, replacing that of a probe of
+// the server the binding previously used
+func recordProbeOutcome(binding *msiacrpullv1beta2.AcrPullBinding, outcome *probeOutcome) {
+	forgetProbeOutcome(binding.Namespace, binding.Name)
+	value := 0.0
+	if outcome.result == msiacrpullv1beta2.ProbeResultSucceeded {
+		value = 1
+	}
+	probeSucceeded.WithLabelValues(binding.Namespace, binding.Name, binding.Spec.ACR.Server).Set(value)
+}
+
+// forgetProbeOutcome drops the probe metric of a binding that is no longer probed or no longer exists
+func forgetProbeOutcome(namespace, name string) {
+	probeSucceeded.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "name": name})
+}
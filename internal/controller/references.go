@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+)
+
+//+kubebuilder:rbac:groups=acrpull.microsoft.com,resources=azurecloudprofiles,verbs=get;list;watch
+//+kubebuilder:rbac:groups=acrpull.microsoft.com,resources=acrregistries,verbs=get;list;watch
+//+kubebuilder:rbac:groups=acrpull.microsoft.com,resources=azureidentities;clusterazureidentities,verbs=get;list;watch
+
+const (
+	cloudProfileField         = ".spec.acr.cloudProfileRef"
+	registryField             = ".spec.acr.registryRef"
+	registryCloudProfileField = ".spec.cloudProfileRef"
+	// identityField indexes bindings by the kind and name of the identity they refer to, as <kind>/<name>
+	identityField = ".spec.auth.identityRef"
+)
+
+const (
+	azureIdentityKind        = "AzureIdentity"
+	clusterAzureIdentityKind = "ClusterAzureIdentity"
+)
+
+// bindingReferences holds the cluster resources a pull binding refers to by name, resolved before it is reconciled
+type bindingReferences struct {
+	// registry is the AcrRegistry the binding refers to, if any
+	registry *msiacrpullv1beta2.AcrRegistry
+	// cloudProfile is the AzureCloudProfile the binding, or its registry, refers to, if any
+	cloudProfile *msiacrpullv1beta2.AzureCloudProfile
+	// identity is the AzureIdentity or ClusterAzureIdentity the binding refers to, if any
+	identity *referencedIdentity
+
+	// missing describes a resource the binding refers to that does not exist, if any; no credential is issued for the
+	// binding until it is created
+	missing error
+}
+
+// referencedIdentity is an AzureIdentity or ClusterAzureIdentity, as resolved for a binding
+type referencedIdentity struct {
+	kind, name string
+	spec       msiacrpullv1beta2.AzureIdentitySpec
+
+	// forbidden explains why the namespace of the binding may not use the identity, if it may not
+	forbidden error
+}
+
+// resolveV1beta2References fetches the cluster resources a v1beta2 pull binding refers to. Resources that do not exist
+// are recorded as missing rather than failing, so that the binding can still be cleaned up.
+func resolveV1beta2References(ctx context.Context, client crclient.Reader, binding *msiacrpullv1beta2.AcrPullBinding) (*bindingReferences, error) {
+	references := &bindingReferences{}
+	if name := binding.Spec.ACR.RegistryRef; name != "" {
+		registry := &msiacrpullv1beta2.AcrRegistry{}
+		if err := client.Get(ctx, crclient.ObjectKey{Namespace: binding.Namespace, Name: name}, registry); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("failed to get registry: %w", err)
+			}
+			references.missing = fmt.Errorf("registry %q not found", name)
+			return references, nil
+		}
+		references.registry = registry
+	}
+	if name := withReferences(binding, references).Spec.ACR.CloudProfileRef; name != "" {
+		profile := &msiacrpullv1beta2.AzureCloudProfile{}
+		if err := client.Get(ctx, crclient.ObjectKey{Name: name}, profile); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("failed to get cloud profile: %w", err)
+			}
+			references.missing = fmt.Errorf("cloud profile %q not found", name)
+		} else {
+			references.cloudProfile = profile
+		}
+	}
+	if ref := binding.Spec.Auth.IdentityRef; ref != nil {
+		identity, err := resolveIdentity(ctx, client, binding.Namespace, *ref)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("failed to get identity: %w", err)
+			}
+			references.missing = fmt.Errorf("%s %q not found", identityKind(*ref), ref.Name)
+		} else {
+			references.identity = identity
+		}
+	}
+	return references, nil
+}
+
+func identityKind(ref msiacrpullv1beta2.IdentityReference) string {
+	if ref.Kind == "" {
+		return azureIdentityKind
+	}
+	return ref.Kind
+}
+
+// resolveIdentity fetches the identity a binding in the namespace refers to, and determines if the namespace may use it:
+// an AzureIdentity may only be used in its own namespace, and a ClusterAzureIdentity in the namespaces it selects
+func resolveIdentity(ctx context.Context, client crclient.Reader, namespace string, ref msiacrpullv1beta2.IdentityReference) (*referencedIdentity, error) {
+	identity := &referencedIdentity{kind: identityKind(ref), name: ref.Name}
+	if identity.kind != clusterAzureIdentityKind {
+		azureIdentity := &msiacrpullv1beta2.AzureIdentity{}
+		if err := client.Get(ctx, crclient.ObjectKey{Namespace: namespace, Name: ref.Name}, azureIdentity); err != nil {
+			return nil, err
+		}
+		identity.spec = azureIdentity.Spec
+		return identity, nil
+	}
+
+	clusterIdentity := &msiacrpullv1beta2.ClusterAzureIdentity{}
+	if err := client.Get(ctx, crclient.ObjectKey{Name: ref.Name}, clusterIdentity); err != nil {
+		return nil, err
+	}
+	identity.spec = msiacrpullv1beta2.AzureIdentitySpec{
+		ManagedIdentity:  clusterIdentity.Spec.ManagedIdentity,
+		WorkloadIdentity: clusterIdentity.Spec.WorkloadIdentity,
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&clusterIdentity.Spec.NamespaceSelector)
+	if err != nil {
+		// an invalid selector can't select anything, but we should not let it open up access
+		identity.forbidden = fmt.Errorf("%s %q has an invalid namespace selector: %w", clusterAzureIdentityKind, ref.Name, err)
+		return identity, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := client.Get(ctx, crclient.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("failed to get namespace: %w", err)
+	}
+	if !selector.Matches(labels.Set(ns.Labels)) {
+		identity.forbidden = fmt.Errorf("%s %q does not select namespace %q", clusterAzureIdentityKind, ref.Name, namespace)
+	}
+	return identity, nil
+}
+
+// withReferences returns the binding with the settings it takes from the AcrRegistry and identity it refers to filled
+// in, for the reconciler to act on; the result must never be written back
+func withReferences(binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences) *msiacrpullv1beta2.AcrPullBinding {
+	if references == nil || (references.registry == nil && references.identity == nil) {
+		return binding
+	}
+	resolved := binding.DeepCopy()
+	if references.registry != nil {
+		registry := references.registry.Spec
+		resolved.Spec.ACR.Server = registry.Server
+		resolved.Spec.ACR.AdditionalHosts = registry.AdditionalHosts
+		resolved.Spec.ACR.Environment = registry.Environment
+		resolved.Spec.ACR.CloudConfig = registry.CloudConfig
+		resolved.Spec.ACR.CloudProfileRef = registry.CloudProfileRef
+		if resolved.Spec.ACR.Scope == "" {
+			resolved.Spec.ACR.Scope = registry.DefaultScope
+		}
+	}
+	if references.identity != nil {
+		identity := references.identity.spec
+		switch {
+		case identity.ManagedIdentity != nil:
+			resolved.Spec.Auth.ManagedIdentity = identity.ManagedIdentity.DeepCopy()
+		case identity.WorkloadIdentity != nil && resolved.Spec.Auth.WorkloadIdentity != nil:
+			resolved.Spec.Auth.WorkloadIdentity.ClientID = identity.WorkloadIdentity.ClientID
+			resolved.Spec.Auth.WorkloadIdentity.TenantID = identity.WorkloadIdentity.TenantID
+		}
+	}
+	return resolved
+}
+
+// validateIdentity ensures that the binding may use the identity it refers to, and names a federated service account
+// if and only if that identity is a workload identity
+func validateIdentity(binding *msiacrpullv1beta2.AcrPullBinding, references *bindingReferences) error {
+	if references == nil || references.identity == nil {
+		return nil
+	}
+	identity := references.identity
+	if identity.forbidden != nil {
+		return identity.forbidden
+	}
+	switch {
+	case identity.spec.ManagedIdentity != nil && binding.Spec.Auth.WorkloadIdentity != nil:
+		return fmt.Errorf("%s %q is a managed identity, so the binding must not set a workloadIdentity", identity.kind, identity.name)
+	case identity.spec.WorkloadIdentity != nil && binding.Spec.Auth.WorkloadIdentity == nil:
+		return fmt.Errorf("%s %q is a workload identity, so the binding must name the federated service account in workloadIdentity.serviceAccountRef", identity.kind, identity.name)
+	}
+	return nil
+}
+
+func indexV1beta2PullBindingByCloudProfile(object crclient.Object) []string {
+	acrPullBinding, ok := object.(*msiacrpullv1beta2.AcrPullBinding)
+	if !ok || acrPullBinding.Spec.ACR.CloudProfileRef == "" {
+		return nil
+	}
+	return []string{acrPullBinding.Spec.ACR.CloudProfileRef}
+}
+
+func indexV1beta2PullBindingByRegistry(object crclient.Object) []string {
+	acrPullBinding, ok := object.(*msiacrpullv1beta2.AcrPullBinding)
+	if !ok || acrPullBinding.Spec.ACR.RegistryRef == "" {
+		return nil
+	}
+	return []string{acrPullBinding.Spec.ACR.RegistryRef}
+}
+
+func indexV1beta2PullBindingByIdentity(object crclient.Object) []string {
+	acrPullBinding, ok := object.(*msiacrpullv1beta2.AcrPullBinding)
+	if !ok || acrPullBinding.Spec.Auth.IdentityRef == nil {
+		return nil
+	}
+	return []string{identityKind(*acrPullBinding.Spec.Auth.IdentityRef) + "/" + acrPullBinding.Spec.Auth.IdentityRef.Name}
+}
+
+func indexRegistryByCloudProfile(object crclient.Object) []string {
+	registry, ok := object.(*msiacrpullv1beta2.AcrRegistry)
+	if !ok || registry.Spec.CloudProfileRef == "" {
+		return nil
+	}
+	return []string{registry.Spec.CloudProfileRef}
+}
+
+// enqueueV1beta2PullBindingsForCloudProfile enqueues the bindings referring to a cloud profile, directly or through
+// their registry
+func enqueueV1beta2PullBindingsForCloudProfile(mgr ctrl.Manager) func(ctx context.Context, object crclient.Object) []reconcile.Request {
+	return func(ctx context.Context, object crclient.Object) []reconcile.Request {
+		requests := enqueuePullBindings(ctx, mgr.GetClient(), &msiacrpullv1beta2.AcrPullBindingList{}, crclient.MatchingFields{cloudProfileField: object.GetName()})
+		registries := &msiacrpullv1beta2.AcrRegistryList{}
+		if err := mgr.GetClient().List(ctx, registries, crclient.MatchingFields{registryCloudProfileField: object.GetName()}); err != nil {
+			return requests
+		}
+		for i := range registries.Items {
+			requests = append(requests, enqueueV1beta2PullBindingsForRegistry(mgr)(ctx, &registries.Items[i])...)
+		}
+		return requests
+	}
+}
+
+func enqueueV1beta2PullBindingsForRegistry(mgr ctrl.Manager) func(ctx context.Context, object crclient.Object) []reconcile.Request {
+	return func(ctx context.Context, object crclient.Object) []reconcile.Request {
+		return enqueuePullBindings(ctx, mgr.GetClient(), &msiacrpullv1beta2.AcrPullBindingList{}, crclient.InNamespace(object.GetNamespace()), crclient.MatchingFields{registryField: object.GetName()})
+	}
+}
+
+// cloudForBinding determines the cloud a v1beta2 pull binding authenticates in, from its cloud profile if it refers to
+// one
+func cloudForBinding(spec msiacrpullv1beta2.AcrConfiguration, references *bindingReferences) (cloud.Configuration, error) {
+	if references != nil && references.cloudProfile != nil {
+		return authorizer.CloudForProfile(references.cloudProfile.Spec), nil
+	}
+	return authorizer.CloudForEnvironment(spec.Environment, spec.CloudConfig)
+}
+
+func enqueueV1beta2PullBindingsForIdentity(mgr ctrl.Manager) func(ctx context.Context, object crclient.Object) []reconcile.Request {
+	return func(ctx context.Context, object crclient.Object) []reconcile.Request {
+		return enqueuePullBindings(ctx, mgr.GetClient(), &msiacrpullv1beta2.AcrPullBindingList{}, crclient.InNamespace(object.GetNamespace()), crclient.MatchingFields{identityField: azureIdentityKind + "/" + object.GetName()})
+	}
+}
+
+func enqueueV1beta2PullBindingsForClusterIdentity(mgr ctrl.Manager) func(ctx context.Context, object crclient.Object) []reconcile.Request {
+	return func(ctx context.Context, object crclient.Object) []reconcile.Request {
+		return enqueuePullBindings(ctx, mgr.GetClient(), &msiacrpullv1beta2.AcrPullBindingList{}, crclient.MatchingFields{identityField: clusterAzureIdentityKind + "/" + object.GetName()})
+	}
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+)
+
+// scopeFullyGrantedCondition compares the scope the registry granted with the one the binding requested
+func scopeFullyGrantedCondition(requested, granted string, generation int64, now func() time.Time) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               msiacrpullv1beta2.ConditionTypeScopeFullyGranted,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		LastTransitionTime: metav1.NewTime(now()),
+		Reason:             msiacrpullv1beta2.ConditionReasonScopeFullyGranted,
+		Message:            "registry granted the requested scope",
+	}
+	if missing := authorizer.MissingScope(requested, granted); missing != "" {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = msiacrpullv1beta2.ConditionReasonScopePartiallyGranted
+		condition.Message = fmt.Sprintf("registry did not grant %q of the requested scope; grant the identity a role on the registry that allows these actions", missing)
+	}
+	return condition
+}
+
+// partialGrantWarning determines if recording the conditions newly reports a partially granted scope, which we warn
+// about with an event, as pulls relying on the missing actions will fail
+func (r *genericReconciler[O]) partialGrantWarning(acrBinding O, conditions []metav1.Condition) *warningEvent {
+	if r.GetConditions == nil {
+		return nil
+	}
+	updated := apimeta.FindStatusCondition(conditions, msiacrpullv1beta2.ConditionTypeScopeFullyGranted)
+	if updated == nil || updated.Status != metav1.ConditionFalse {
+		return nil
+	}
+	current := apimeta.FindStatusCondition(*r.GetConditions(acrBinding), msiacrpullv1beta2.ConditionTypeScopeFullyGranted)
+	if current != nil && current.Status == updated.Status && current.Message == updated.Message {
+		return nil
+	}
+	return &warningEvent{Reason: updated.Reason, Message: updated.Message}
+}
+
+// setGrantedScope records the granted scope in the status of the binding, which must already be a copy we're free to
+// mutate.
+func (r *genericReconciler[O]) setGrantedScope(acrBinding O, grantedScope string) O {
+	if r.GetGrantedScope == nil {
+		return acrBinding
+	}
+	*r.GetGrantedScope(acrBinding) = grantedScope
+	return acrBinding
+}
+
+// grantedScopeChanged determines if recording the granted scope would change the status of the binding
+func (r *genericReconciler[O]) grantedScopeChanged(acrBinding O, grantedScope string) bool {
+	if r.GetGrantedScope == nil {
+		return false
+	}
+	return *r.GetGrantedScope(acrBinding) != grantedScope
+}
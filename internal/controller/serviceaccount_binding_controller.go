@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+)
+
+const (
+	// registryAnnotation on a ServiceAccount requests a pull binding for the registry server it holds
+	registryAnnotation = "acr.microsoft.com/registry"
+	// scopeAnnotation on a ServiceAccount holds the scope of the pull binding requested with registryAnnotation
+	scopeAnnotation = "acr.microsoft.com/scope"
+	// environmentAnnotation on a ServiceAccount holds the Azure environment of the registry, defaulting to PublicCloud
+	environmentAnnotation = "acr.microsoft.com/environment"
+	// cloudProfileAnnotation on a ServiceAccount names the AzureCloudProfile of the air-gapped cloud the registry is in
+	cloudProfileAnnotation = "acr.microsoft.com/cloud-profile"
+)
+
+// ServiceAccountBindingController creates, updates and deletes the v1beta2 pull binding requested by the annotations
+// of each ServiceAccount. The binding is named after the ServiceAccount, authenticates with the workload identity of
+// the ServiceAccount and is owned by it.
+type ServiceAccountBindingController struct {
+	Client crclient.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+
+	// Recorder records events on ServiceAccounts, if set
+	Recorder record.EventRecorder
+
+	// OwnsNamespace determines whether this replica reconciles ServiceAccounts in a namespace when sharding is enabled;
+	// if unset, ServiceAccounts in every namespace are reconciled
+	OwnsNamespace func(namespace string) bool
+}
+
+func (c *ServiceAccountBindingController) SetupWithManager(_ context.Context, mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("service-account-binding").
+		For(&corev1.ServiceAccount{}).
+		Owns(&msiacrpullv1beta2.AcrPullBinding{}).
+		Complete(c)
+}
+
+// Reconcile keeps the pull binding for a ServiceAccount in line with its annotations.
+func (c *ServiceAccountBindingController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := c.Log.WithValues("serviceaccount", req.NamespacedName)
+
+	if c.OwnsNamespace != nil && !c.OwnsNamespace(req.Namespace) {
+		log.V(4).Info("skipping reconcile: namespace is not in a shard owned by this replica")
+		return ctrl.Result{}, nil
+	}
+
+	serviceAccount := &corev1.ServiceAccount{}
+	if err := c.Client.Get(ctx, req.NamespacedName, serviceAccount); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to fetch service account")
+			return ctrl.Result{}, err
+		}
+		// the garbage collector deletes the pull bindings of deleted service accounts
+		return ctrl.Result{}, nil
+	}
+
+	binding := &msiacrpullv1beta2.AcrPullBinding{}
+	if err := c.Client.Get(ctx, req.NamespacedName, binding); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to fetch pull binding")
+			return ctrl.Result{}, err
+		}
+		binding = nil
+	}
+
+	action, err := c.reconcile(serviceAccount, binding)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return c.execute(ctx, log, serviceAccount, action)
+}
+
+func (c *ServiceAccountBindingController) reconcile(serviceAccount *corev1.ServiceAccount, binding *msiacrpullv1beta2.AcrPullBinding) (*serviceAccountBindingAction, error) {
+	if serviceAccount.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	owned := binding != nil && metav1.IsControlledBy(binding, serviceAccount)
+
+	server := strings.TrimSpace(serviceAccount.Annotations[registryAnnotation])
+	if server == "" {
+		if owned && binding.DeletionTimestamp == nil {
+			return &serviceAccountBindingAction{deleteBinding: binding}, nil
+		}
+		return nil, nil
+	}
+	scope := strings.TrimSpace(serviceAccount.Annotations[scopeAnnotation])
+	if scope == "" {
+		return &serviceAccountBindingAction{warning: &warningEvent{
+			Reason:  "MissingScope",
+			Message: fmt.Sprintf("The %s annotation is required with the %s annotation to create a pull binding.", scopeAnnotation, registryAnnotation),
+		}}, nil
+	}
+	if binding != nil && !owned {
+		return &serviceAccountBindingAction{warning: &warningEvent{
+			Reason:  "BindingConflict",
+			Message: fmt.Sprintf("The pull binding %s already exists and is not owned by this service account.", binding.Name),
+		}}, nil
+	}
+
+	// the cloud is resolved from the environment or cloud profile by the pull binding controller, as for any binding
+	environment, cloudProfile, warning := cloudForAnnotations(serviceAccount.Annotations)
+	if warning != nil {
+		return &serviceAccountBindingAction{warning: warning}, nil
+	}
+
+	desired := msiacrpullv1beta2.AcrPullBindingSpec{
+		ACR: msiacrpullv1beta2.AcrConfiguration{
+			Server:          server,
+			Scope:           scope,
+			Environment:     environment,
+			CloudProfileRef: cloudProfile,
+		},
+		Auth: msiacrpullv1beta2.AuthenticationMethod{
+			WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{ServiceAccountName: serviceAccount.Name},
+		},
+		ServiceAccountName: serviceAccount.Name,
+	}
+
+	if binding == nil {
+		created := &msiacrpullv1beta2.AcrPullBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: serviceAccount.Namespace,
+				Name:      serviceAccount.Name,
+			},
+			Spec: desired,
+		}
+		if err := controllerutil.SetControllerReference(serviceAccount, created, c.Scheme); err != nil {
+			return nil, fmt.Errorf("failed to set owner reference on pull binding: %w", err)
+		}
+		return &serviceAccountBindingAction{createBinding: created}, nil
+	}
+
+	// the rest of the spec, such as probes, is left to the user
+	current := msiacrpullv1beta2.AcrPullBindingSpec{
+		ACR: msiacrpullv1beta2.AcrConfiguration{
+			Server:          binding.Spec.ACR.Server,
+			Scope:           binding.Spec.ACR.Scope,
+			Environment:     binding.Spec.ACR.Environment,
+			CloudConfig:     binding.Spec.ACR.CloudConfig,
+			CloudProfileRef: binding.Spec.ACR.CloudProfileRef,
+		},
+		Auth:               binding.Spec.Auth,
+		ServiceAccountName: binding.Spec.ServiceAccountName,
+	}
+	if apiequality.Semantic.DeepEqual(current, desired) {
+		return nil, nil
+	}
+	updated := binding.DeepCopy()
+	updated.Spec.ACR.Server = desired.ACR.Server
+	updated.Spec.ACR.Scope = desired.ACR.Scope
+	updated.Spec.ACR.Environment = desired.ACR.Environment
+	updated.Spec.ACR.CloudConfig = desired.ACR.CloudConfig
+	updated.Spec.ACR.CloudProfileRef = desired.ACR.CloudProfileRef
+	updated.Spec.Auth = desired.Auth
+	updated.Spec.ServiceAccountName = desired.ServiceAccountName
+	return &serviceAccountBindingAction{updateBinding: updated}, nil
+}
+
+func (c *ServiceAccountBindingController) execute(ctx context.Context, log logr.Logger, serviceAccount *corev1.ServiceAccount, action *serviceAccountBindingAction) (ctrl.Result, error) {
+	if action == nil {
+		return ctrl.Result{}, nil
+	}
+	action.validate()
+	switch {
+	case action.createBinding != nil:
+		log.Info("creating pull binding from service account annotations")
+		return ctrl.Result{}, c.Client.Create(ctx, action.createBinding)
+	case action.updateBinding != nil:
+		log.Info("updating pull binding from service account annotations")
+		return ctrl.Result{}, c.Client.Update(ctx, action.updateBinding)
+	case action.deleteBinding != nil:
+		log.Info("deleting pull binding as service account annotations were removed")
+		return ctrl.Result{}, crclient.IgnoreNotFound(c.Client.Delete(ctx, action.deleteBinding))
+	case action.warning != nil:
+		log.Info("not creating pull binding", "reason", action.warning.Reason)
+		if c.Recorder != nil {
+			c.Recorder.Event(serviceAccount, corev1.EventTypeWarning, action.warning.Reason, action.warning.Message)
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+type serviceAccountBindingAction struct {
+	createBinding *msiacrpullv1beta2.AcrPullBinding
+	updateBinding *msiacrpullv1beta2.AcrPullBinding
+	deleteBinding *msiacrpullv1beta2.AcrPullBinding
+	warning       *warningEvent
+}
+
+func (a *serviceAccountBindingAction) validate() {
+	var present int
+	for _, set := range []bool{a.createBinding != nil, a.updateBinding != nil, a.deleteBinding != nil, a.warning != nil} {
+		if set {
+			present++
+		}
+	}
+	if present > 1 {
+		panic("programmer error: more than one action specified in reconciliation loop")
+	}
+}
+
+// cloudForAnnotations determines the environment and cloud profile of the pull binding requested by a ServiceAccount
+func cloudForAnnotations(annotations map[string]string) (msiacrpullv1beta2.AzureEnvironmentType, string, *warningEvent) {
+	environment := msiacrpullv1beta2.AzureEnvironmentType(strings.TrimSpace(annotations[environmentAnnotation]))
+	cloudProfile := strings.TrimSpace(annotations[cloudProfileAnnotation])
+	if cloudProfile != "" {
+		if environment != "" && environment != msiacrpullv1beta2.AzureEnvironmentAirgappedCloud {
+			return "", "", &warningEvent{
+				Reason:  "InvalidEnvironment",
+				Message: fmt.Sprintf("The %s annotation may only be combined with the %s environment.", cloudProfileAnnotation, msiacrpullv1beta2.AzureEnvironmentAirgappedCloud),
+			}
+		}
+		return msiacrpullv1beta2.AzureEnvironmentAirgappedCloud, cloudProfile, nil
+	}
+	switch environment {
+	case "":
+		return msiacrpullv1beta2.AzureEnvironmentPublicCloud, "", nil
+	case msiacrpullv1beta2.AzureEnvironmentPublicCloud, msiacrpullv1beta2.AzureEnvironmentUSGovernmentCloud, msiacrpullv1beta2.AzureEnvironmentChinaCloud:
+		return environment, "", nil
+	case msiacrpullv1beta2.AzureEnvironmentAirgappedCloud:
+		return "", "", &warningEvent{
+			Reason:  "InvalidEnvironment",
+			Message: fmt.Sprintf("The %s annotation is required for the %s environment.", cloudProfileAnnotation, msiacrpullv1beta2.AzureEnvironmentAirgappedCloud),
+		}
+	default:
+		return "", "", &warningEvent{
+			Reason:  "InvalidEnvironment",
+			Message: fmt.Sprintf("The %s annotation must be one of %s, %s or %s, not %q.", environmentAnnotation, msiacrpullv1beta2.AzureEnvironmentPublicCloud, msiacrpullv1beta2.AzureEnvironmentUSGovernmentCloud, msiacrpullv1beta2.AzureEnvironmentChinaCloud, environment),
+		}
+	}
+}
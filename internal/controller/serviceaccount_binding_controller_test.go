@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+)
+
+func Test_ServiceAccountBindingController_reconcile(t *testing.T) {
+	if err := msiacrpullv1beta2.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("failed to set up scheme: %v", err)
+	}
+
+	serviceAccount := func(annotations map[string]string) *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "team-a",
+				Name:        "builder",
+				UID:         types.UID("builder-uid"),
+				Annotations: annotations,
+			},
+		}
+	}
+	ownerReferences := []metav1.OwnerReference{{
+		APIVersion:         "v1",
+		Kind:               "ServiceAccount",
+		Name:               "builder",
+		UID:                types.UID("builder-uid"),
+		Controller:         ptr.To(true),
+		BlockOwnerDeletion: ptr.To(true),
+	}}
+	binding := func(server, scope string, environment msiacrpullv1beta2.AzureEnvironmentType) *msiacrpullv1beta2.AcrPullBinding {
+		return &msiacrpullv1beta2.AcrPullBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "team-a",
+				Name:            "builder",
+				OwnerReferences: ownerReferences,
+			},
+			Spec: msiacrpullv1beta2.AcrPullBindingSpec{
+				ACR: msiacrpullv1beta2.AcrConfiguration{
+					Server:      server,
+					Scope:       scope,
+					Environment: environment,
+				},
+				Auth: msiacrpullv1beta2.AuthenticationMethod{
+					WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{ServiceAccountName: "builder"},
+				},
+				ServiceAccountName: "builder",
+			},
+		}
+	}
+	annotated := map[string]string{
+		registryAnnotation: "myacr.azurecr.io",
+		scopeAnnotation:    "repository:app:pull",
+	}
+	probed := binding("myacr.azurecr.io", "repository:old:pull", msiacrpullv1beta2.AzureEnvironmentPublicCloud)
+	probed.Spec.Probe = &msiacrpullv1beta2.ProbeConfiguration{Repository: "app"}
+	reprobed := probed.DeepCopy()
+	reprobed.Spec.ACR.Scope = "repository:app:pull"
+	unowned := binding("other.azurecr.io", "repository:other:pull", msiacrpullv1beta2.AzureEnvironmentPublicCloud)
+	unowned.OwnerReferences = nil
+	deleting := binding("myacr.azurecr.io", "repository:app:pull", msiacrpullv1beta2.AzureEnvironmentPublicCloud)
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	airgapped := binding("myacr.azurecr.airgap.example", "repository:app:pull", msiacrpullv1beta2.AzureEnvironmentAirgappedCloud)
+	airgapped.Spec.ACR.CloudProfileRef = "airgap"
+
+	for _, testCase := range []struct {
+		name           string
+		serviceAccount *corev1.ServiceAccount
+		binding        *msiacrpullv1beta2.AcrPullBinding
+		want           *serviceAccountBindingAction
+	}{
+		{
+			name:           "no annotations, no binding",
+			serviceAccount: serviceAccount(nil),
+		},
+		{
+			name:           "annotations create a binding",
+			serviceAccount: serviceAccount(annotated),
+			want:           &serviceAccountBindingAction{createBinding: binding("myacr.azurecr.io", "repository:app:pull", msiacrpullv1beta2.AzureEnvironmentPublicCloud)},
+		},
+		{
+			name: "environment annotation sets the environment",
+			serviceAccount: serviceAccount(map[string]string{
+				registryAnnotation:    "myacr.azurecr.us",
+				scopeAnnotation:       "repository:app:pull",
+				environmentAnnotation: "USGovernmentCloud",
+			}),
+			want: &serviceAccountBindingAction{createBinding: binding("myacr.azurecr.us", "repository:app:pull", msiacrpullv1beta2.AzureEnvironmentUSGovernmentCloud)},
+		},
+		{
+			name: "environment is not guessed from the registry domain",
+			serviceAccount: serviceAccount(map[string]string{
+				registryAnnotation: "myacr.azurecr.us",
+				scopeAnnotation:    "repository:app:pull",
+			}),
+			want: &serviceAccountBindingAction{createBinding: binding("myacr.azurecr.us", "repository:app:pull", msiacrpullv1beta2.AzureEnvironmentPublicCloud)},
+		},
+		{
+			name: "cloud profile annotation refers to the profile",
+			serviceAccount: serviceAccount(map[string]string{
+				registryAnnotation:     "myacr.azurecr.airgap.example",
+				scopeAnnotation:        "repository:app:pull",
+				cloudProfileAnnotation: "airgap",
+			}),
+			want: &serviceAccountBindingAction{createBinding: airgapped},
+		},
+		{
+			name: "unknown environment",
+			serviceAccount: serviceAccount(map[string]string{
+				registryAnnotation:    "myacr.azurecr.io",
+				scopeAnnotation:       "repository:app:pull",
+				environmentAnnotation: "MarsCloud",
+			}),
+			want: &serviceAccountBindingAction{warning: &warningEvent{
+				Reason:  "InvalidEnvironment",
+				Message: `The acr.microsoft.com/environment annotation must be one of PublicCloud, USGovernmentCloud or ChinaCloud, not "MarsCloud".`,
+			}},
+		},
+		{
+			name: "air-gapped environment without a cloud profile",
+			serviceAccount: serviceAccount(map[string]string{
+				registryAnnotation:    "myacr.azurecr.airgap.example",
+				scopeAnnotation:       "repository:app:pull",
+				environmentAnnotation: "AirgappedCloud",
+			}),
+			want: &serviceAccountBindingAction{warning: &warningEvent{
+				Reason:  "InvalidEnvironment",
+				Message: "The acr.microsoft.com/cloud-profile annotation is required for the AirgappedCloud environment.",
+			}},
+		},
+		{
+			name:           "binding matches annotations",
+			serviceAccount: serviceAccount(annotated),
+			binding:        binding("myacr.azurecr.io", "repository:app:pull", msiacrpullv1beta2.AzureEnvironmentPublicCloud),
+		},
+		{
+			name:           "changed annotations update the binding, keeping the rest of its spec",
+			serviceAccount: serviceAccount(annotated),
+			binding:        probed,
+			want:           &serviceAccountBindingAction{updateBinding: reprobed},
+		},
+		{
+			name:           "removed annotations delete the binding",
+			serviceAccount: serviceAccount(nil),
+			binding:        binding("myacr.azurecr.io", "repository:app:pull", msiacrpullv1beta2.AzureEnvironmentPublicCloud),
+			want:           &serviceAccountBindingAction{deleteBinding: binding("myacr.azurecr.io", "repository:app:pull", msiacrpullv1beta2.AzureEnvironmentPublicCloud)},
+		},
+		{
+			name:           "binding already being deleted",
+			serviceAccount: serviceAccount(nil),
+			binding:        deleting,
+		},
+		{
+			name:           "bindings not owned by the service account are left alone",
+			serviceAccount: serviceAccount(nil),
+			binding:        unowned,
+		},
+		{
+			name:           "bindings not owned by the service account conflict",
+			serviceAccount: serviceAccount(annotated),
+			binding:        unowned,
+			want: &serviceAccountBindingAction{warning: &warningEvent{
+				Reason:  "BindingConflict",
+				Message: "The pull binding builder already exists and is not owned by this service account.",
+			}},
+		},
+		{
+			name:           "registry without scope",
+			serviceAccount: serviceAccount(map[string]string{registryAnnotation: "myacr.azurecr.io"}),
+			want: &serviceAccountBindingAction{warning: &warningEvent{
+				Reason:  "MissingScope",
+				Message: "The acr.microsoft.com/scope annotation is required with the acr.microsoft.com/registry annotation to create a pull binding.",
+			}},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			controller := &ServiceAccountBindingController{
+				Log:    testr.New(t),
+				Scheme: scheme.Scheme,
+			}
+			got, err := controller.reconcile(testCase.serviceAccount, testCase.binding)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(testCase.want, got, cmp.AllowUnexported(serviceAccountBindingAction{})); diff != "" {
+				t.Errorf("unexpected action (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
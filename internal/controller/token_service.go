@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+)
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+const (
+	// serviceAccountUsernamePrefix prefixes the user names of ServiceAccounts, as system:serviceaccount:<namespace>:<name>
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+	// tokenServiceShutdownTimeout bounds how long the token service waits for requests in flight on shutdown
+	tokenServiceShutdownTimeout = 5 * time.Second
+)
+
+// TokenServiceOpts configures the token service
+type TokenServiceOpts struct {
+	// BindAddress is the address the token service listens on
+	BindAddress string
+	// CertDir holds the tls.crt and tls.key to serve with; it is required unless Insecure is set
+	CertDir string
+	// Insecure allows the token service to serve plain HTTP when no CertDir is given, exposing pull credentials and the
+	// tokens of callers to anyone on the network path
+	Insecure bool
+	// Audience is the audience the ServiceAccount tokens of callers must be issued for
+	Audience string
+
+	// Client creates TokenReviews to authenticate callers
+	Client crclient.Client
+	// Reader reads pull bindings and their pull secrets; it should be backed by an informer cache, as every request
+	// lists the pull bindings in the caller's namespace
+	Reader crclient.Reader
+	Logger logr.Logger
+
+	now func() time.Time
+}
+
+// TokenService serves the pull credentials of the v1beta2 pull bindings for a ServiceAccount to clients presenting a
+// token for it, so that build tools can fetch registry credentials at runtime without reading Secrets. Every replica
+// serves, regardless of leader election.
+type TokenService struct {
+	opts TokenServiceOpts
+	mux  *http.ServeMux
+}
+
+// NewTokenService returns a token service serving /v1/dockerconfig, with a docker config holding every credential
+// for the caller, and /v1/credentials?serverURL=<registry>, with a docker credential helper response for one registry
+func NewTokenService(opts TokenServiceOpts) *TokenService {
+	if opts.now == nil {
+		opts.now = time.Now
+	}
+	s := &TokenService{opts: opts, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/v1/dockerconfig", s.serveDockerConfig)
+	s.mux.HandleFunc("/v1/credentials", s.serveCredentialHelper)
+	return s
+}
+
+// NeedLeaderElection allows every replica to serve tokens
+func (s *TokenService) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves tokens until the context is cancelled
+func (s *TokenService) Start(ctx context.Context) error {
+	if s.opts.CertDir == "" && !s.opts.Insecure {
+		return errors.New("refusing to serve tokens over plain HTTP without a serving certificate")
+	}
+	listener, err := net.Listen("tcp", s.opts.BindAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen for the token service: %w", err)
+	}
+	server := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tokenServiceShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.opts.Logger.Error(err, "failed to shut down the token service")
+		}
+	}()
+
+	s.opts.Logger.Info("serving tokens", "address", listener.Addr().String(), "tls", s.opts.CertDir != "")
+	if s.opts.CertDir != "" {
+		err = server.ServeTLS(listener, filepath.Join(s.opts.CertDir, corev1.TLSCertKey), filepath.Join(s.opts.CertDir, corev1.TLSPrivateKeyKey))
+	} else {
+		err = server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *TokenService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// dockerConfigJSON is the format of the pull credentials we store in Secrets, and serve as docker configs
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+type dockerConfigAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth"`
+}
+
+// credentialHelperResponse is the response of a docker credential helper to the get command
+type credentialHelperResponse struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+func (s *TokenService) serveDockerConfig(w http.ResponseWriter, r *http.Request) {
+	auths, ok := s.authorizedCredentials(w, r)
+	if !ok {
+		return
+	}
+	writeTokenServiceJSON(w, dockerConfigJSON{Auths: auths})
+}
+
+func (s *TokenService) serveCredentialHelper(w http.ResponseWriter, r *http.Request) {
+	server := registryHost(r.URL.Query().Get("serverURL"))
+	if server == "" {
+		http.Error(w, "the serverURL query parameter is required", http.StatusBadRequest)
+		return
+	}
+	auths, ok := s.authorizedCredentials(w, r)
+	if !ok {
+		return
+	}
+	auth, found := auths[server]
+	if !found {
+		// docker credential helpers report a miss with this message
+		http.Error(w, "credentials not found in native keychain", http.StatusNotFound)
+		return
+	}
+	writeTokenServiceJSON(w, credentialHelperResponse{ServerURL: server, Username: auth.Username, Secret: auth.Password})
+}
+
+// authorizedCredentials authenticates the caller and collects the credentials of its ServiceAccount, writing an error
+// response if either fails
+func (s *TokenService) authorizedCredentials(w http.ResponseWriter, r *http.Request) (map[string]dockerConfigAuth, bool) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	namespace, name, err := s.authenticate(r)
+	if err != nil {
+		s.opts.Logger.V(4).Info("rejected token service request", "reason", err.Error())
+		// the reason may include details of the TokenReview or the API server, which callers have no business seeing
+		w.Header().Set("WWW-Authenticate", `Bearer realm="acrpull"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	auths, err := s.credentialsFor(r.Context(), namespace, name)
+	if err != nil {
+		s.opts.Logger.Error(err, "failed to look up pull credentials", "namespace", namespace, "serviceAccount", name)
+		http.Error(w, "failed to look up pull credentials", http.StatusInternalServerError)
+		return nil, false
+	}
+	return auths, true
+}
+
+// authenticate determines the ServiceAccount the bearer token of the request is for, using a TokenReview
+func (s *TokenService) authenticate(r *http.Request) (string, string, error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return "", "", errors.New("a bearer token is required")
+	}
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: []string{s.opts.Audience},
+		},
+	}
+	if err := s.opts.Client.Create(r.Context(), review); err != nil {
+		return "", "", fmt.Errorf("failed to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return "", "", fmt.Errorf("token is not valid: %s", review.Status.Error)
+	}
+	if !slices.Contains(review.Status.Audiences, s.opts.Audience) {
+		return "", "", fmt.Errorf("token is not valid for audience %q", s.opts.Audience)
+	}
+	serviceAccount, isServiceAccount := strings.CutPrefix(review.Status.User.Username, serviceAccountUsernamePrefix)
+	namespace, name, found := strings.Cut(serviceAccount, ":")
+	if !isServiceAccount || !found {
+		return "", "", fmt.Errorf("user %q is not a ServiceAccount", review.Status.User.Username)
+	}
+	return namespace, name, nil
+}
+
+// credentialsFor collects the unexpired pull credentials of the pull bindings for the ServiceAccount by registry; when
+// more than one binding is for a registry, the first by name wins
+func (s *TokenService) credentialsFor(ctx context.Context, namespace, serviceAccountName string) (map[string]dockerConfigAuth, error) {
+	var bindings msiacrpullv1beta2.AcrPullBindingList
+	if err := s.opts.Reader.List(ctx, &bindings, crclient.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list pull bindings: %w", err)
+	}
+	slices.SortFunc(bindings.Items, func(a, b msiacrpullv1beta2.AcrPullBinding) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	auths := map[string]dockerConfigAuth{}
+	for _, binding := range bindings.Items {
+		if binding.Spec.ServiceAccountName != serviceAccountName || binding.DeletionTimestamp != nil {
+			continue
+		}
+		var pullSecret corev1.Secret
+		if err := s.opts.Reader.Get(ctx, crclient.ObjectKey{Namespace: namespace, Name: pullSecretName(binding.Name)}, &pullSecret); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get pull secret for %s: %w", binding.Name, err)
+		}
+		if !pullSecretExpiry(s.opts.Logger, &pullSecret).After(s.opts.now()) {
+			continue
+		}
+		var config dockerConfigJSON
+		if err := json.Unmarshal(pullSecret.Data[dockerConfigKey], &config); err != nil {
+			return nil, fmt.Errorf("failed to parse pull secret for %s: %w", binding.Name, err)
+		}
+		for server, auth := range config.Auths {
+			server = strings.ToLower(server)
+			if _, seen := auths[server]; !seen {
+				auths[server] = auth
+			}
+		}
+	}
+	return auths, nil
+}
+
+// registryHost reduces the server URL a docker credential helper is asked about to the registry host
+func registryHost(serverURL string) string {
+	serverURL = strings.TrimPrefix(strings.TrimPrefix(serverURL, "https://"), "http://")
+	host, _, _ := strings.Cut(serverURL, "/")
+	return strings.ToLower(host)
+}
+
+func writeTokenServiceJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
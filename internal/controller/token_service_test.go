@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-cmp/cmp"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func Test_TokenService(t *testing.T) {
+	if err := msiacrpullv1beta2.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("failed to set up scheme: %v", err)
+	}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	binding := func(name, serviceAccountName string) *msiacrpullv1beta2.AcrPullBinding {
+		return &msiacrpullv1beta2.AcrPullBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name},
+			Spec:       msiacrpullv1beta2.AcrPullBindingSpec{ServiceAccountName: serviceAccountName},
+		}
+	}
+	pullSecret := func(bindingName, server, password string, expiry time.Time) *corev1.Secret {
+		config, err := json.Marshal(dockerConfigJSON{Auths: map[string]dockerConfigAuth{
+			server: {Username: "00000000-0000-0000-0000-000000000000", Password: password},
+		}})
+		if err != nil {
+			t.Fatalf("failed to encode docker config: %v", err)
+		}
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "team-a",
+				Name:        pullSecretName(bindingName),
+				Annotations: map[string]string{tokenExpiryAnnotation: expiry.Format(time.RFC3339)},
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{dockerConfigKey: config},
+		}
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		binding("apps", "builder"),
+		pullSecret("apps", "Apps.azurecr.io", "apps-token", now.Add(time.Hour)),
+		binding("base", "builder"),
+		pullSecret("base", "base.azurecr.io", "base-token", now.Add(time.Hour)),
+		binding("duplicate", "builder"),
+		pullSecret("duplicate", "apps.azurecr.io", "duplicate-token", now.Add(time.Hour)),
+		binding("expired", "builder"),
+		pullSecret("expired", "expired.azurecr.io", "expired-token", now.Add(-time.Minute)),
+		binding("pending", "builder"),
+		binding("other", "deployer"),
+		pullSecret("other", "other.azurecr.io", "other-token", now.Add(time.Hour)),
+	).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, client crclient.WithWatch, obj crclient.Object, opts ...crclient.CreateOption) error {
+			review, ok := obj.(*authenticationv1.TokenReview)
+			if !ok {
+				return client.Create(ctx, obj, opts...)
+			}
+			// tokens are "<user>|<audience>" for the purposes of the test
+			user, audience, _ := strings.Cut(review.Spec.Token, "|")
+			switch user {
+			case "invalid":
+				review.Status = authenticationv1.TokenReviewStatus{Error: "token has expired"}
+				return nil
+			case "unreviewable":
+				return errors.New("connection to the API server at 10.0.0.1:443 refused")
+			}
+			review.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: user},
+				Audiences:     []string{audience},
+			}
+			return nil
+		},
+	}).Build()
+
+	service := NewTokenService(TokenServiceOpts{
+		Audience: "acrpull-token-service",
+		Client:   client,
+		Reader:   client,
+		Logger:   testr.New(t),
+		now:      func() time.Time { return now },
+	})
+
+	for _, testCase := range []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+		wantBody   any
+		wantError  string
+	}{
+		{
+			name:       "docker config with the unexpired credentials of the ServiceAccount",
+			path:       "/v1/dockerconfig",
+			token:      "system:serviceaccount:team-a:builder|acrpull-token-service",
+			wantStatus: http.StatusOK,
+			wantBody: &dockerConfigJSON{Auths: map[string]dockerConfigAuth{
+				"apps.azurecr.io": {Username: "00000000-0000-0000-0000-000000000000", Password: "apps-token"},
+				"base.azurecr.io": {Username: "00000000-0000-0000-0000-000000000000", Password: "base-token"},
+			}},
+		},
+		{
+			name:       "credential helper response for a registry URL",
+			path:       "/v1/credentials?serverURL=https://base.azurecr.io/v2/",
+			token:      "system:serviceaccount:team-a:builder|acrpull-token-service",
+			wantStatus: http.StatusOK,
+			wantBody: &credentialHelperResponse{
+				ServerURL: "base.azurecr.io",
+				Username:  "00000000-0000-0000-0000-000000000000",
+				Secret:    "base-token",
+			},
+		},
+		{
+			name:       "credential helper miss for an expired credential",
+			path:       "/v1/credentials?serverURL=expired.azurecr.io",
+			token:      "system:serviceaccount:team-a:builder|acrpull-token-service",
+			wantStatus: http.StatusNotFound,
+			wantError:  "credentials not found in native keychain",
+		},
+		{
+			name:       "credential helper miss for another ServiceAccount's credential",
+			path:       "/v1/credentials?serverURL=other.azurecr.io",
+			token:      "system:serviceaccount:team-a:builder|acrpull-token-service",
+			wantStatus: http.StatusNotFound,
+			wantError:  "credentials not found in native keychain",
+		},
+		{
+			name:       "credential helper without a server",
+			path:       "/v1/credentials",
+			token:      "system:serviceaccount:team-a:builder|acrpull-token-service",
+			wantStatus: http.StatusBadRequest,
+			wantError:  "the serverURL query parameter is required",
+		},
+		{
+			name:       "ServiceAccount without bindings",
+			path:       "/v1/dockerconfig",
+			token:      "system:serviceaccount:team-b:builder|acrpull-token-service",
+			wantStatus: http.StatusOK,
+			wantBody:   &dockerConfigJSON{Auths: map[string]dockerConfigAuth{}},
+		},
+		{
+			name:       "missing token",
+			path:       "/v1/dockerconfig",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "unauthorized",
+		},
+		{
+			name:       "invalid token",
+			path:       "/v1/dockerconfig",
+			token:      "invalid",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "unauthorized",
+		},
+		{
+			name:       "failed token review",
+			path:       "/v1/dockerconfig",
+			token:      "unreviewable|acrpull-token-service",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "unauthorized",
+		},
+		{
+			name:       "token for another audience",
+			path:       "/v1/dockerconfig",
+			token:      "system:serviceaccount:team-a:builder|https://kubernetes.default.svc",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "unauthorized",
+		},
+		{
+			name:       "token for a user",
+			path:       "/v1/dockerconfig",
+			token:      "alice|acrpull-token-service",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "unauthorized",
+		},
+		{
+			name:       "unsupported method",
+			method:     http.MethodPost,
+			path:       "/v1/dockerconfig",
+			token:      "system:serviceaccount:team-a:builder|acrpull-token-service",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantError:  "method not allowed",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			method := testCase.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			request := httptest.NewRequest(method, testCase.path, nil)
+			if testCase.token != "" {
+				request.Header.Set("Authorization", "Bearer "+testCase.token)
+			}
+			recorder := httptest.NewRecorder()
+			service.ServeHTTP(recorder, request)
+
+			if recorder.Code != testCase.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", testCase.wantStatus, recorder.Code, recorder.Body.String())
+			}
+			if testCase.wantError != "" {
+				if got := strings.TrimSpace(recorder.Body.String()); got != testCase.wantError {
+					t.Errorf("expected error %q, got %q", testCase.wantError, got)
+				}
+				return
+			}
+			var got any
+			switch testCase.wantBody.(type) {
+			case *dockerConfigJSON:
+				got = &dockerConfigJSON{}
+			case *credentialHelperResponse:
+				got = &credentialHelperResponse{}
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(testCase.wantBody, got); diff != "" {
+				t.Errorf("unexpected response (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_TokenService_requiresTLS(t *testing.T) {
+	service := NewTokenService(TokenServiceOpts{BindAddress: "127.0.0.1:0", Logger: testr.New(t)})
+	if err := service.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "plain HTTP") {
+		t.Errorf("expected the token service to refuse to serve plain HTTP, got %v", err)
+	}
+}
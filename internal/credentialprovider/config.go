@@ -0,0 +1,84 @@
+// Package credentialprovider implements a kubelet image credential provider issuing ACR credentials for the managed
+// identities assigned to the node.
+package credentialprovider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+)
+
+// Config maps registries to the managed identities the node pulls from them as.
+type Config struct {
+	// Registries lists the registries credentials are issued for
+	Registries []Registry `json:"registries"`
+}
+
+// Registry configures the credentials issued for a registry.
+type Registry struct {
+	// Server is the host name of the registry, or a wildcard like *.azurecr.io matching any host under a domain
+	Server string `json:"server"`
+	// ClientID identifies the managed identity to pull as
+	ClientID string `json:"clientID,omitempty"`
+	// ResourceID identifies the managed identity to pull as, when no client ID is given; without either, the
+	// system-assigned identity of the node is used
+	ResourceID string `json:"resourceID,omitempty"`
+	// Scope is the repository access requested for every image pulled from the registry; if empty, each image is
+	// pulled with a credential scoped to pulling its repository
+	Scope string `json:"scope,omitempty"`
+	// Environment is the Azure cloud the registry is in, defaulting to the public cloud
+	Environment msiacrpullv1beta2.AzureEnvironmentType `json:"environment,omitempty"`
+	// CloudConfig holds the endpoints of an air-gapped cloud
+	CloudConfig *msiacrpullv1beta2.AirgappedCloudConfiguration `json:"cloudConfig,omitempty"`
+}
+
+// LoadConfig reads the configuration from a YAML or JSON file.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(raw, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	for i := range config.Registries {
+		registry := &config.Registries[i]
+		if registry.Server == "" {
+			return nil, fmt.Errorf("registries[%d]: server is required", i)
+		}
+		if registry.ClientID != "" && registry.ResourceID != "" {
+			return nil, fmt.Errorf("registries[%d]: only one of clientID or resourceID may be set", i)
+		}
+		if registry.Environment == "" {
+			registry.Environment = msiacrpullv1beta2.AzureEnvironmentPublicCloud
+		}
+		if (registry.Environment == msiacrpullv1beta2.AzureEnvironmentAirgappedCloud) != (registry.CloudConfig != nil) {
+			return nil, fmt.Errorf("registries[%d]: cloudConfig is required for, and only allowed with, the %s environment", i, msiacrpullv1beta2.AzureEnvironmentAirgappedCloud)
+		}
+		if registry.CloudConfig != nil && registry.CloudConfig.CABundleRef != nil {
+			return nil, fmt.Errorf("registries[%d]: cloudConfig.caBundleRef is not supported on nodes, pass the CA bundle with --ca-bundle instead", i)
+		}
+	}
+	return &config, nil
+}
+
+// registryFor finds the registry configured for a host, preferring an exact match over wildcards
+func (c *Config) registryFor(host string) (*Registry, bool) {
+	var wildcard *Registry
+	for i := range c.Registries {
+		registry := &c.Registries[i]
+		server := strings.ToLower(registry.Server)
+		if server == host {
+			return registry, true
+		}
+		if suffix, ok := strings.CutPrefix(server, "*."); ok && wildcard == nil && strings.HasSuffix(host, "."+suffix) {
+			wildcard = registry
+		}
+	}
+	return wildcard, wildcard != nil
+}
@@ -0,0 +1,125 @@
+package credentialprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	credentialproviderv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/Azure/msi-acrpull/internal/acrserver"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+)
+
+// cacheExpiryBuffer is how long before a credential expires the kubelet stops using it from its cache
+const cacheExpiryBuffer = 5 * time.Minute
+
+// Provider answers kubelet credential provider requests with ACR credentials.
+type Provider struct {
+	Config *Config
+	// AllowedACRServerSuffixes restricts the registries credentials are issued for; if empty, any registry in the
+	// configuration is allowed
+	AllowedACRServerSuffixes []string
+	// Credentials issues registry credentials, defaulting to managed identity for ACR
+	Credentials authorizer.CredentialProvider
+
+	now func() time.Time
+}
+
+// NewProvider returns a provider issuing credentials for the registries in the configuration.
+func NewProvider(config *Config, allowedACRServerSuffixes []string) *Provider {
+	return &Provider{
+		Config:                   config,
+		AllowedACRServerSuffixes: allowedACRServerSuffixes,
+		Credentials:              authorizer.NewProvider(),
+		now:                      time.Now,
+	}
+}
+
+// Serve reads a request from the kubelet and writes the response.
+func (p *Provider) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	var request credentialproviderv1.CredentialProviderRequest
+	if err := json.NewDecoder(in).Decode(&request); err != nil {
+		return fmt.Errorf("failed to decode request: %w", err)
+	}
+	if request.APIVersion != credentialproviderv1.SchemeGroupVersion.String() || request.Kind != "CredentialProviderRequest" {
+		return fmt.Errorf("unsupported request %s, %s", request.APIVersion, request.Kind)
+	}
+	response, err := p.Provide(ctx, &request)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(out).Encode(response)
+}
+
+// Provide issues a credential for the registry of the image in the request.
+func (p *Provider) Provide(ctx context.Context, request *credentialproviderv1.CredentialProviderRequest) (*credentialproviderv1.CredentialProviderResponse, error) {
+	host, repository, err := parseImage(request.Image)
+	if err != nil {
+		return nil, err
+	}
+	if err := acrserver.ValidateSuffix(host, p.AllowedACRServerSuffixes); err != nil {
+		return nil, err
+	}
+	registry, ok := p.Config.registryFor(host)
+	if !ok {
+		return nil, fmt.Errorf("no identity is configured for registry %s", host)
+	}
+
+	// without a configured scope, we scope the credential to the repository, so the kubelet must cache it per image
+	scope, cacheKeyType, authKey := registry.Scope, credentialproviderv1.RegistryPluginCacheKeyType, host
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", repository)
+		cacheKeyType, authKey = credentialproviderv1.ImagePluginCacheKeyType, host+"/"+repository
+	}
+	cloud, err := authorizer.CloudForEnvironment(registry.Environment, registry.CloudConfig)
+	if err != nil {
+		return nil, fmt.Errorf("registry %s: %w", host, err)
+	}
+	credential, err := p.Credentials.Credential(ctx, &authorizer.CredentialRequest{
+		Method:     authorizer.AuthMethodManagedIdentity,
+		ClientID:   registry.ClientID,
+		ResourceID: registry.ResourceID,
+		Cloud:      cloud,
+		Registry:   host,
+		Scope:      scope,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve ACR credential for %s: %w", request.Image, err)
+	}
+
+	response := &credentialproviderv1.CredentialProviderResponse{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: credentialproviderv1.SchemeGroupVersion.String(),
+			Kind:       "CredentialProviderResponse",
+		},
+		CacheKeyType: cacheKeyType,
+		Auth: map[string]credentialproviderv1.AuthConfig{
+			authKey: {Username: credential.Username(), Password: credential.Token.Token},
+		},
+	}
+	// the kubelet does not cache a credential with no cache duration, which we return for one too close to expiry
+	cacheDuration := max(credential.Token.ExpiresOn.Sub(p.now())-cacheExpiryBuffer, 0)
+	response.CacheDuration = &metav1.Duration{Duration: cacheDuration.Truncate(time.Second)}
+	return response, nil
+}
+
+// parseImage splits an image reference into the host of its registry and its repository
+func parseImage(image string) (string, string, error) {
+	host, remainder, found := strings.Cut(image, "/")
+	if !found || !(strings.ContainsAny(host, ".:") || host == "localhost") {
+		return "", "", fmt.Errorf("image %q does not name a registry", image)
+	}
+	repository, _, _ := strings.Cut(remainder, "@")
+	if separator := strings.LastIndex(repository, ":"); separator > strings.LastIndex(repository, "/") {
+		repository = repository[:separator]
+	}
+	if repository == "" {
+		return "", "", fmt.Errorf("image %q does not name a repository", image)
+	}
+	return strings.ToLower(host), repository, nil
+}
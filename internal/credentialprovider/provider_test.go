@@ -0,0 +1,245 @@
+package credentialprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/mock/gomock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	credentialproviderv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+	"github.com/Azure/msi-acrpull/pkg/authorizer/mock_authorizer"
+)
+
+func TestProvider(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	token := azcore.AccessToken{Token: "acr-token", ExpiresOn: now.Add(3 * time.Hour)}
+	config := &Config{Registries: []Registry{
+		{Server: "team.azurecr.io", ClientID: "team", Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud},
+		{Server: "*.azurecr.io", ResourceID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/fallback", Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud},
+		{Server: "shared.azurecr.us", ClientID: "shared", Scope: "repository:*:pull", Environment: msiacrpullv1beta2.AzureEnvironmentUSGovernmentCloud},
+	}}
+
+	for _, testCase := range []struct {
+		name            string
+		request         string
+		allowedSuffixes []string
+		expect          func(*mock_authorizer.MockCredentialProvider)
+		want            *credentialproviderv1.CredentialProviderResponse
+		wantErr         string
+	}{
+		{
+			name:    "repository-scoped credential for an exactly configured registry",
+			request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"Team.azurecr.io/apps/web:v1"}`,
+			expect: func(mock *mock_authorizer.MockCredentialProvider) {
+				mock.EXPECT().Credential(gomock.Any(), gomock.Eq(&authorizer.CredentialRequest{
+					Method:   authorizer.AuthMethodManagedIdentity,
+					ClientID: "team",
+					Cloud:    cloud.AzurePublic,
+					Registry: "team.azurecr.io",
+					Scope:    "repository:apps/web:pull",
+				})).Return(&authorizer.Credential{Token: token, Registry: "team.azurecr.io"}, nil)
+			},
+			want: &credentialproviderv1.CredentialProviderResponse{
+				TypeMeta:      metav1.TypeMeta{APIVersion: "credentialprovider.kubelet.k8s.io/v1", Kind: "CredentialProviderResponse"},
+				CacheKeyType:  credentialproviderv1.ImagePluginCacheKeyType,
+				CacheDuration: &metav1.Duration{Duration: 3*time.Hour - cacheExpiryBuffer},
+				Auth: map[string]credentialproviderv1.AuthConfig{
+					"team.azurecr.io/apps/web": {Username: "00000000-0000-0000-0000-000000000000", Password: "acr-token"},
+				},
+			},
+		},
+		{
+			name:    "wildcard registry pulled by digest",
+			request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"other.azurecr.io/base@sha256:abc"}`,
+			expect: func(mock *mock_authorizer.MockCredentialProvider) {
+				mock.EXPECT().Credential(gomock.Any(), gomock.Eq(&authorizer.CredentialRequest{
+					Method:     authorizer.AuthMethodManagedIdentity,
+					ResourceID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/fallback",
+					Cloud:      cloud.AzurePublic,
+					Registry:   "other.azurecr.io",
+					Scope:      "repository:base:pull",
+				})).Return(&authorizer.Credential{Token: token, Registry: "other.azurecr.io"}, nil)
+			},
+			want: &credentialproviderv1.CredentialProviderResponse{
+				TypeMeta:      metav1.TypeMeta{APIVersion: "credentialprovider.kubelet.k8s.io/v1", Kind: "CredentialProviderResponse"},
+				CacheKeyType:  credentialproviderv1.ImagePluginCacheKeyType,
+				CacheDuration: &metav1.Duration{Duration: 3*time.Hour - cacheExpiryBuffer},
+				Auth: map[string]credentialproviderv1.AuthConfig{
+					"other.azurecr.io/base": {Username: "00000000-0000-0000-0000-000000000000", Password: "acr-token"},
+				},
+			},
+		},
+		{
+			name:    "configured scope is cached per registry",
+			request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"shared.azurecr.us/tools/cli"}`,
+			expect: func(mock *mock_authorizer.MockCredentialProvider) {
+				mock.EXPECT().Credential(gomock.Any(), gomock.Eq(&authorizer.CredentialRequest{
+					Method:   authorizer.AuthMethodManagedIdentity,
+					ClientID: "shared",
+					Cloud:    cloud.AzureGovernment,
+					Registry: "shared.azurecr.us",
+					Scope:    "repository:*:pull",
+				})).Return(&authorizer.Credential{Token: azcore.AccessToken{Token: "acr-token", ExpiresOn: now.Add(time.Minute)}, Registry: "shared.azurecr.us"}, nil)
+			},
+			want: &credentialproviderv1.CredentialProviderResponse{
+				TypeMeta:      metav1.TypeMeta{APIVersion: "credentialprovider.kubelet.k8s.io/v1", Kind: "CredentialProviderResponse"},
+				CacheKeyType:  credentialproviderv1.RegistryPluginCacheKeyType,
+				CacheDuration: &metav1.Duration{},
+				Auth: map[string]credentialproviderv1.AuthConfig{
+					"shared.azurecr.us": {Username: "00000000-0000-0000-0000-000000000000", Password: "acr-token"},
+				},
+			},
+		},
+		{
+			name:            "registry outside the allowed suffixes",
+			request:         `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"shared.azurecr.us/tools/cli"}`,
+			allowedSuffixes: []string{"azurecr.io"},
+			wantErr:         `ACR server "shared.azurecr.us" is not in the allowed ACR server suffixes: azurecr.io`,
+		},
+		{
+			name:    "registry without an identity",
+			request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"registry.example.com/apps/web"}`,
+			wantErr: "no identity is configured for registry registry.example.com",
+		},
+		{
+			name:    "image without a registry",
+			request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"library/nginx"}`,
+			wantErr: `image "library/nginx" does not name a registry`,
+		},
+		{
+			name:    "unsupported request version",
+			request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1alpha1","kind":"CredentialProviderRequest","image":"team.azurecr.io/apps/web"}`,
+			wantErr: "unsupported request credentialprovider.kubelet.k8s.io/v1alpha1, CredentialProviderRequest",
+		},
+		{
+			name:    "credential failure",
+			request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"team.azurecr.io/apps/web"}`,
+			expect: func(mock *mock_authorizer.MockCredentialProvider) {
+				mock.EXPECT().Credential(gomock.Any(), gomock.Any()).Return(nil, errors.New("oops"))
+			},
+			wantErr: "failed to retrieve ACR credential for team.azurecr.io/apps/web: oops",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			credentials := mock_authorizer.NewMockCredentialProvider(gomock.NewController(t))
+			if testCase.expect != nil {
+				testCase.expect(credentials)
+			}
+			provider := &Provider{
+				Config:                   config,
+				AllowedACRServerSuffixes: testCase.allowedSuffixes,
+				Credentials:              credentials,
+				now:                      func() time.Time { return now },
+			}
+
+			var out bytes.Buffer
+			err := provider.Serve(context.Background(), strings.NewReader(testCase.request), &out)
+			if testCase.wantErr != "" {
+				if err == nil || err.Error() != testCase.wantErr {
+					t.Fatalf("expected error %q, got %v", testCase.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got credentialproviderv1.CredentialProviderResponse
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(testCase.want, &got); diff != "" {
+				t.Errorf("unexpected response (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, testCase := range []struct {
+		name    string
+		config  string
+		want    *Config
+		wantErr string
+	}{
+		{
+			name: "environment defaults to the public cloud",
+			config: `registries:
+- server: team.azurecr.io
+  clientID: team
+- server: "*.azurecr.io"
+`,
+			want: &Config{Registries: []Registry{
+				{Server: "team.azurecr.io", ClientID: "team", Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud},
+				{Server: "*.azurecr.io", Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud},
+			}},
+		},
+		{
+			name: "air-gapped cloud",
+			config: `registries:
+- server: team.azurecr.airgap
+  environment: AirgappedCloud
+  cloudConfig:
+    entraAuthorityHost: https://login.airgap
+    resourceManagerAudience: https://management.airgap
+`,
+			want: &Config{Registries: []Registry{{
+				Server:      "team.azurecr.airgap",
+				Environment: msiacrpullv1beta2.AzureEnvironmentAirgappedCloud,
+				CloudConfig: &msiacrpullv1beta2.AirgappedCloudConfiguration{EntraAuthorityHost: "https://login.airgap", ResourceManagerAudience: "https://management.airgap"},
+			}}},
+		},
+		{
+			name:    "air-gapped cloud without endpoints",
+			config:  "registries:\n- server: team.azurecr.airgap\n  environment: AirgappedCloud\n",
+			wantErr: "registries[0]: cloudConfig is required for, and only allowed with, the AirgappedCloud environment",
+		},
+		{
+			name:    "air-gapped cloud with a CA bundle config map",
+			config:  "registries:\n- server: team.azurecr.airgap\n  environment: AirgappedCloud\n  cloudConfig:\n    entraAuthorityHost: https://login.airgap\n    resourceManagerAudience: https://management.airgap\n    caBundleRef:\n      name: airgap-ca\n",
+			wantErr: "registries[0]: cloudConfig.caBundleRef is not supported on nodes, pass the CA bundle with --ca-bundle instead",
+		},
+		{
+			name:    "both identities",
+			config:  "registries:\n- server: team.azurecr.io\n  clientID: team\n  resourceID: other\n",
+			wantErr: "registries[0]: only one of clientID or resourceID may be set",
+		},
+		{
+			name:    "missing server",
+			config:  "registries:\n- clientID: team\n",
+			wantErr: "registries[0]: server is required",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(testCase.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadConfig(path)
+			if testCase.wantErr != "" {
+				if err == nil || err.Error() != testCase.wantErr {
+					t.Fatalf("expected error %q, got %v", testCase.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(testCase.want, got); diff != "" {
+				t.Errorf("unexpected config (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,648 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// NewCache returns a cache.NewCacheFunc for the manager that only watches namespaced objects in the namespaces whose
+// shards the coordinator owns, so each replica only holds its share of the watched objects in memory. Without a
+// coordinator, every namespace is owned. Only namespaces whose labels match the selector are watched, if one is given.
+// Cluster-scoped objects are watched as usual. As shards are acquired and released and namespaces come to match the
+// selector or stop matching it, a cache is started or stopped for each of the namespaces, and the event handlers
+// registered by controllers are attached to the informers in each, so controllers see objects in newly-watched
+// namespaces as additions. In exchange, a replica opens one watch per kind for every namespace it watches, rather than
+// one per kind for the whole cluster.
+func NewCache(coordinator *Coordinator, selector labels.Selector, logger logr.Logger) cache.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		base, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		newNamespaceCache := func(namespace string) (cache.Cache, error) {
+			namespaceOpts := opts
+			namespaceOpts.DefaultNamespaces = map[string]cache.Config{namespace: opts.DefaultNamespaces[namespace]}
+			return cache.New(config, namespaceOpts)
+		}
+		var owner namespaceOwner = everyNamespace{}
+		if coordinator != nil {
+			owner = coordinator
+		}
+		return newShardedCache(logger, owner, base, opts.Scheme, opts.Mapper, sets.KeySet(opts.DefaultNamespaces), selector, newNamespaceCache), nil
+	}
+}
+
+// UnshardedReader returns a reader for objects in any watched namespace, for callers that serve requests for any
+// namespace rather than reconcile them: objects in the namespaces of the shards this replica owns are read from the
+// cache, and those in namespaces that would be watched were their shards ours are read from the API server
+func UnshardedReader(c cache.Cache, apiReader client.Reader) client.Reader {
+	if sharded, ok := c.(*shardedCache); ok {
+		return &unshardedReader{cache: sharded, apiReader: apiReader}
+	}
+	return c
+}
+
+type unshardedReader struct {
+	cache     *shardedCache
+	apiReader client.Reader
+}
+
+// readsFromAPI determines whether objects in the namespace are read from the API server, as the namespace is watched by
+// the replica owning its shard rather than by us
+func (r *unshardedReader) readsFromAPI(ctx context.Context, namespace string) bool {
+	if r.cache.namespaceCache(namespace) != nil {
+		return false
+	}
+	var ns corev1.Namespace
+	return r.cache.Cache.Get(ctx, client.ObjectKey{Name: namespace}, &ns) == nil && r.cache.selects(&ns)
+}
+
+func (r *unshardedReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	_, namespaced, err := r.cache.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+	if namespaced && r.readsFromAPI(ctx, key.Namespace) {
+		return r.apiReader.Get(ctx, key, obj, opts...)
+	}
+	return r.cache.Get(ctx, key, obj, opts...)
+}
+
+func (r *unshardedReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	_, namespaced, err := r.cache.gvkFor(list)
+	if err != nil {
+		return err
+	}
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if !namespaced || (listOpts.Namespace != "" && !r.readsFromAPI(ctx, listOpts.Namespace)) {
+		return r.cache.List(ctx, list, opts...)
+	}
+	if err := r.apiReader.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	if listOpts.Namespace != "" {
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	watched := items[:0]
+	for _, item := range items {
+		object, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		if r.cache.namespaceCache(object.GetNamespace()) != nil || r.readsFromAPI(ctx, object.GetNamespace()) {
+			watched = append(watched, item)
+		}
+	}
+	return meta.SetList(list, watched)
+}
+
+// namespaceOwner decides which namespaces this replica watches, and notifies subscribers when that changes
+type namespaceOwner interface {
+	OwnsNamespace(namespace string) bool
+	Subscribe(callback func())
+}
+
+// everyNamespace owns every namespace, for watching the namespaces matching a selector without sharding
+type everyNamespace struct{}
+
+func (everyNamespace) OwnsNamespace(string) bool { return true }
+
+func (everyNamespace) Subscribe(func()) {}
+
+type namespaceCache struct {
+	cache.Cache
+	cancel context.CancelFunc
+}
+
+type fieldIndex struct {
+	object       client.Object
+	field        string
+	extractValue client.IndexerFunc
+}
+
+// shardedCache serves cluster-scoped objects from the base cache and namespaced objects from a cache per owned namespace
+type shardedCache struct {
+	cache.Cache
+	logger            logr.Logger
+	owner             namespaceOwner
+	scheme            *runtime.Scheme
+	mapper            meta.RESTMapper
+	allowed           sets.Set[string]
+	selector          labels.Selector
+	newNamespaceCache func(namespace string) (cache.Cache, error)
+	trigger           chan struct{}
+
+	lock       sync.RWMutex
+	ctx        context.Context
+	namespaces map[string]*namespaceCache
+	informers  map[schema.GroupVersionKind]*shardedInformer
+	indexes    []fieldIndex
+}
+
+func newShardedCache(logger logr.Logger, owner namespaceOwner, base cache.Cache, scheme *runtime.Scheme, mapper meta.RESTMapper, allowed sets.Set[string], selector labels.Selector, newNamespaceCache func(string) (cache.Cache, error)) *shardedCache {
+	if selector == nil {
+		selector = labels.Everything()
+	}
+	c := &shardedCache{
+		Cache:             base,
+		logger:            logger,
+		owner:             owner,
+		scheme:            scheme,
+		mapper:            mapper,
+		allowed:           allowed,
+		selector:          selector,
+		newNamespaceCache: newNamespaceCache,
+		trigger:           make(chan struct{}, 1),
+		namespaces:        map[string]*namespaceCache{},
+		informers:         map[schema.GroupVersionKind]*shardedInformer{},
+	}
+	owner.Subscribe(c.requestRebalance)
+	return c
+}
+
+// gvkFor determines the kind of an object or of the items in a list, and whether that kind is namespaced
+func (c *shardedCache) gvkFor(obj runtime.Object) (schema.GroupVersionKind, bool, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return schema.GroupVersionKind{}, false, err
+	}
+	if meta.IsListType(obj) {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	namespaced, err := apiutil.IsGVKNamespaced(gvk, c.mapper)
+	return gvk, namespaced, err
+}
+
+func (c *shardedCache) namespaceCache(namespace string) *namespaceCache {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.namespaces[namespace]
+}
+
+func (c *shardedCache) namespaceCaches() map[string]*namespaceCache {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	caches := make(map[string]*namespaceCache, len(c.namespaces))
+	for namespace, namespaceCache := range c.namespaces {
+		caches[namespace] = namespaceCache
+	}
+	return caches
+}
+
+func (c *shardedCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	_, namespaced, err := c.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+	if !namespaced {
+		return c.Cache.Get(ctx, key, obj, opts...)
+	}
+	namespaceCache := c.namespaceCache(key.Namespace)
+	if namespaceCache == nil {
+		return fmt.Errorf("namespace %s is not in a shard owned by this replica", key.Namespace)
+	}
+	return namespaceCache.Get(ctx, key, obj, opts...)
+}
+
+func (c *shardedCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	_, namespaced, err := c.gvkFor(list)
+	if err != nil {
+		return err
+	}
+	if !namespaced {
+		return c.Cache.List(ctx, list, opts...)
+	}
+
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	caches := c.namespaceCaches()
+	if listOpts.Namespace != "" {
+		if namespaceCache, owned := caches[listOpts.Namespace]; owned {
+			return namespaceCache.List(ctx, list, opts...)
+		}
+		return meta.SetList(list, nil)
+	}
+
+	namespaces := make([]string, 0, len(caches))
+	for namespace := range caches {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	var items []runtime.Object
+	for _, namespace := range namespaces {
+		namespacedList := list.DeepCopyObject().(client.ObjectList)
+		if err := caches[namespace].List(ctx, namespacedList, opts...); err != nil {
+			return err
+		}
+		namespacedItems, err := meta.ExtractList(namespacedList)
+		if err != nil {
+			return err
+		}
+		items = append(items, namespacedItems...)
+	}
+	return meta.SetList(list, items)
+}
+
+func (c *shardedCache) GetInformer(ctx context.Context, obj client.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	gvk, namespaced, err := c.gvkFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if !namespaced {
+		return c.Cache.GetInformer(ctx, obj, opts...)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if informer, exists := c.informers[gvk]; exists {
+		return informer, nil
+	}
+	informer := &shardedInformer{prototype: obj.DeepCopyObject().(client.Object), informers: map[string]cache.Informer{}}
+	for namespace, namespaceCache := range c.namespaces {
+		namespaceInformer, err := namespaceCache.GetInformer(ctx, informer.prototype, cache.BlockUntilSynced(false))
+		if err != nil {
+			return nil, err
+		}
+		if err := informer.attach(namespace, namespaceInformer); err != nil {
+			return nil, err
+		}
+	}
+	c.informers[gvk] = informer
+	return informer, nil
+}
+
+func (c *shardedCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	obj, err := c.scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := obj.(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a client.Object", gvk)
+	}
+	return c.GetInformer(ctx, object, opts...)
+}
+
+func (c *shardedCache) RemoveInformer(ctx context.Context, obj client.Object) error {
+	gvk, namespaced, err := c.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+	if !namespaced {
+		return c.Cache.RemoveInformer(ctx, obj)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.informers, gvk)
+	for _, namespaceCache := range c.namespaces {
+		if err := namespaceCache.RemoveInformer(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *shardedCache) IndexField(ctx context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	_, namespaced, err := c.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+	if !namespaced {
+		return c.Cache.IndexField(ctx, obj, field, extractValue)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.indexes = append(c.indexes, fieldIndex{object: obj, field: field, extractValue: extractValue})
+	for _, namespaceCache := range c.namespaces {
+		if err := namespaceCache.IndexField(ctx, obj, field, extractValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *shardedCache) Start(ctx context.Context) error {
+	// namespaces coming and going may change which of them fall into our shards, and relabelling them may change which
+	// of them match the selector
+	namespaces, err := c.Cache.GetInformer(ctx, &corev1.Namespace{}, cache.BlockUntilSynced(false))
+	if err != nil {
+		return err
+	}
+	if _, err := namespaces.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { c.requestRebalance() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNamespace, oldOK := oldObj.(*corev1.Namespace)
+			newNamespace, newOK := newObj.(*corev1.Namespace)
+			if !oldOK || !newOK || !labels.Equals(oldNamespace.Labels, newNamespace.Labels) {
+				c.requestRebalance()
+			}
+		},
+		DeleteFunc: func(interface{}) { c.requestRebalance() },
+	}); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.ctx = ctx
+	c.lock.Unlock()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.trigger:
+				if err := c.rebalance(ctx); err != nil {
+					c.logger.Error(err, "failed to rebalance namespace caches")
+				}
+			}
+		}
+	}()
+	c.requestRebalance()
+	return c.Cache.Start(ctx)
+}
+
+func (c *shardedCache) WaitForCacheSync(ctx context.Context) bool {
+	if !c.Cache.WaitForCacheSync(ctx) {
+		return false
+	}
+	for _, namespaceCache := range c.namespaceCaches() {
+		if !namespaceCache.WaitForCacheSync(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *shardedCache) requestRebalance() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// selects determines whether the namespace is to be watched by the replica owning its shard
+func (c *shardedCache) selects(namespace *corev1.Namespace) bool {
+	if c.allowed.Len() > 0 && !c.allowed.Has(namespace.Name) {
+		return false
+	}
+	return c.selector.Matches(labels.Set(namespace.Labels))
+}
+
+// rebalance starts caches for selected namespaces in our shards that we do not yet watch, and stops those for
+// namespaces that are no longer ours or no longer selected
+func (c *shardedCache) rebalance(ctx context.Context) error {
+	var namespaceList corev1.NamespaceList
+	if err := c.Cache.List(ctx, &namespaceList); err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	desired := sets.New[string]()
+	for i := range namespaceList.Items {
+		namespace := &namespaceList.Items[i]
+		if !c.selects(namespace) {
+			continue
+		}
+		if c.owner.OwnsNamespace(namespace.Name) {
+			desired.Insert(namespace.Name)
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for namespace, namespaceCache := range c.namespaces {
+		if desired.Has(namespace) {
+			continue
+		}
+		c.logger.Info("stopped watching namespace", "namespace", namespace)
+		namespaceCache.cancel()
+		for _, informer := range c.informers {
+			informer.detach(namespace)
+		}
+		delete(c.namespaces, namespace)
+	}
+	for _, namespace := range sets.List(desired) {
+		if _, exists := c.namespaces[namespace]; exists {
+			continue
+		}
+		if err := c.watchNamespace(namespace); err != nil {
+			return fmt.Errorf("failed to watch namespace %s: %w", namespace, err)
+		}
+		c.logger.Info("started watching namespace", "namespace", namespace)
+	}
+	return nil
+}
+
+// watchNamespace starts a cache for the namespace with the indices and informers requested so far; callers must hold the lock
+func (c *shardedCache) watchNamespace(namespace string) error {
+	delegate, err := c.newNamespaceCache(namespace)
+	if err != nil {
+		return err
+	}
+	for _, index := range c.indexes {
+		if err := delegate.IndexField(c.ctx, index.object, index.field, index.extractValue); err != nil {
+			return err
+		}
+	}
+	namespaceInformers := map[schema.GroupVersionKind]cache.Informer{}
+	for gvk, informer := range c.informers {
+		namespaceInformer, err := delegate.GetInformer(c.ctx, informer.prototype, cache.BlockUntilSynced(false))
+		if err != nil {
+			return err
+		}
+		namespaceInformers[gvk] = namespaceInformer
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.namespaces[namespace] = &namespaceCache{Cache: delegate, cancel: cancel}
+	for gvk, namespaceInformer := range namespaceInformers {
+		if err := c.informers[gvk].attach(namespace, namespaceInformer); err != nil {
+			c.logger.Error(err, "failed to register event handlers", "namespace", namespace, "kind", gvk.Kind)
+		}
+	}
+	go func() {
+		if err := delegate.Start(ctx); err != nil {
+			c.logger.Error(err, "namespace cache failed", "namespace", namespace)
+		}
+	}()
+	return nil
+}
+
+// shardedInformer fans the event handlers and indexers registered for a kind out to its informer in every owned
+// namespace, including those acquired after registration
+type shardedInformer struct {
+	prototype client.Object
+
+	lock      sync.Mutex
+	informers map[string]cache.Informer
+	// registrations are tracked by pointer, as the handlers themselves may not be comparable
+	registrations []*shardedRegistration
+	indexers      []toolscache.Indexers
+}
+
+// shardedRegistration tracks the registrations of an event handler with each namespace's informer
+type shardedRegistration struct {
+	handler       toolscache.ResourceEventHandler
+	resyncPeriod  *time.Duration
+	informer      *shardedInformer
+	registrations map[string]toolscache.ResourceEventHandlerRegistration
+}
+
+func (r *shardedRegistration) register(namespace string, informer cache.Informer) error {
+	var registration toolscache.ResourceEventHandlerRegistration
+	var err error
+	if r.resyncPeriod != nil {
+		registration, err = informer.AddEventHandlerWithResyncPeriod(r.handler, *r.resyncPeriod)
+	} else {
+		registration, err = informer.AddEventHandler(r.handler)
+	}
+	if err != nil {
+		return err
+	}
+	r.registrations[namespace] = registration
+	return nil
+}
+
+// HasSynced is true once the handler has seen the initial state of every owned namespace
+func (r *shardedRegistration) HasSynced() bool {
+	r.informer.lock.Lock()
+	defer r.informer.lock.Unlock()
+	for _, registration := range r.registrations {
+		if registration != nil && !registration.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *shardedInformer) attach(namespace string, informer cache.Informer) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.informers[namespace] = informer
+	for _, indexers := range i.indexers {
+		if err := informer.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	for _, registration := range i.registrations {
+		if err := registration.register(namespace, informer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *shardedInformer) detach(namespace string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	delete(i.informers, namespace)
+	for _, registration := range i.registrations {
+		delete(registration.registrations, namespace)
+	}
+}
+
+func (i *shardedInformer) addEventHandler(handler toolscache.ResourceEventHandler, resyncPeriod *time.Duration) (toolscache.ResourceEventHandlerRegistration, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	registration := &shardedRegistration{
+		handler:       handler,
+		resyncPeriod:  resyncPeriod,
+		informer:      i,
+		registrations: map[string]toolscache.ResourceEventHandlerRegistration{},
+	}
+	for namespace, informer := range i.informers {
+		if err := registration.register(namespace, informer); err != nil {
+			return nil, err
+		}
+	}
+	i.registrations = append(i.registrations, registration)
+	return registration, nil
+}
+
+func (i *shardedInformer) AddEventHandler(handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error) {
+	return i.addEventHandler(handler, nil)
+}
+
+func (i *shardedInformer) AddEventHandlerWithResyncPeriod(handler toolscache.ResourceEventHandler, resyncPeriod time.Duration) (toolscache.ResourceEventHandlerRegistration, error) {
+	return i.addEventHandler(handler, &resyncPeriod)
+}
+
+func (i *shardedInformer) RemoveEventHandler(handle toolscache.ResourceEventHandlerRegistration) error {
+	registration, ok := handle.(*shardedRegistration)
+	if !ok {
+		return fmt.Errorf("registration %T was not returned by this informer", handle)
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for namespace, namespaceRegistration := range registration.registrations {
+		if informer, exists := i.informers[namespace]; exists {
+			if err := informer.RemoveEventHandler(namespaceRegistration); err != nil {
+				return err
+			}
+		}
+	}
+	for index, existing := range i.registrations {
+		if existing == registration {
+			i.registrations = append(i.registrations[:index], i.registrations[index+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (i *shardedInformer) AddIndexers(indexers toolscache.Indexers) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.indexers = append(i.indexers, indexers)
+	for _, informer := range i.informers {
+		if err := informer.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *shardedInformer) HasSynced() bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for _, informer := range i.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// IsStopped is true once the informer in any owned namespace has stopped
+func (i *shardedInformer) IsStopped() bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for _, informer := range i.informers {
+		if informer.IsStopped() {
+			return true
+		}
+	}
+	return false
+}
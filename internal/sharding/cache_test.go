@@ -0,0 +1,272 @@
+package sharding
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeCache serves reads from a fake client and records the fields indexed and whether it is running
+type fakeCache struct {
+	*informertest.FakeInformers
+	reader  crclient.Reader
+	indexed []string
+	stopped chan struct{}
+}
+
+func newFakeCache(objects ...crclient.Object) *fakeCache {
+	return &fakeCache{
+		FakeInformers: &informertest.FakeInformers{},
+		reader:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build(),
+		stopped:       make(chan struct{}),
+	}
+}
+
+func (c *fakeCache) Get(ctx context.Context, key crclient.ObjectKey, obj crclient.Object, opts ...crclient.GetOption) error {
+	return c.reader.Get(ctx, key, obj, opts...)
+}
+
+func (c *fakeCache) List(ctx context.Context, list crclient.ObjectList, opts ...crclient.ListOption) error {
+	return c.reader.List(ctx, list, opts...)
+}
+
+func (c *fakeCache) IndexField(_ context.Context, _ crclient.Object, field string, _ crclient.IndexerFunc) error {
+	c.indexed = append(c.indexed, field)
+	return nil
+}
+
+func (c *fakeCache) Start(ctx context.Context) error {
+	<-ctx.Done()
+	close(c.stopped)
+	return nil
+}
+
+type fakeOwner struct {
+	namespaces sets.Set[string]
+}
+
+func (o *fakeOwner) OwnsNamespace(namespace string) bool {
+	return o.namespaces.Has(namespace)
+}
+
+func (o *fakeOwner) Subscribe(func()) {}
+
+func TestShardedCache(t *testing.T) {
+	namespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	secret := func(namespace string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "pull-secret"}}
+	}
+	base := newFakeCache(namespace("a"), namespace("b"), namespace("c"))
+	namespaceCaches := map[string]*fakeCache{}
+	newNamespaceCache := func(namespace string) (cache.Cache, error) {
+		namespaceCaches[namespace] = newFakeCache(secret(namespace))
+		return namespaceCaches[namespace], nil
+	}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+	owner := &fakeOwner{namespaces: sets.New[string]()}
+	// namespace c is not watched at all, so is never ours
+	c := newShardedCache(logr.Discard(), owner, base, scheme.Scheme, mapper, sets.New[string]("a", "b"), nil, newNamespaceCache)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.ctx = ctx
+
+	// controllers register their informers and indices before any shards are owned
+	informer, err := c.GetInformer(ctx, &corev1.Secret{})
+	if err != nil {
+		t.Fatalf("failed to get informer: %v", err)
+	}
+	var added []string
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			added = append(added, obj.(*corev1.Secret).Namespace)
+		},
+	}); err != nil {
+		t.Fatalf("failed to add event handler: %v", err)
+	}
+	if err := c.IndexField(ctx, &corev1.Secret{}, "field", func(crclient.Object) []string { return nil }); err != nil {
+		t.Fatalf("failed to index secrets: %v", err)
+	}
+
+	secretNamespaces := func() []string {
+		t.Helper()
+		var secrets corev1.SecretList
+		if err := c.List(ctx, &secrets); err != nil {
+			t.Fatalf("failed to list secrets: %v", err)
+		}
+		var namespaces []string
+		for _, secret := range secrets.Items {
+			namespaces = append(namespaces, secret.Namespace)
+		}
+		return namespaces
+	}
+	rebalance := func(owned ...string) {
+		t.Helper()
+		owner.namespaces = sets.New[string](owned...)
+		if err := c.rebalance(ctx); err != nil {
+			t.Fatalf("failed to rebalance: %v", err)
+		}
+	}
+
+	rebalance("a", "c")
+	if diff := cmp.Diff([]string{"a"}, sets.List(sets.KeySet(c.namespaceCaches()))); diff != "" {
+		t.Errorf("unexpected namespaces watched (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"field"}, namespaceCaches["a"].indexed); diff != "" {
+		t.Errorf("expected indices to be added to the new namespace cache (-want, +got):\n%s", diff)
+	}
+	namespaceInformer, err := namespaceCaches["a"].FakeInformerFor(ctx, &corev1.Secret{})
+	if err != nil {
+		t.Fatalf("failed to get namespace informer: %v", err)
+	}
+	namespaceInformer.Add(secret("a"))
+	if diff := cmp.Diff([]string{"a"}, added); diff != "" {
+		t.Errorf("expected event handlers to be registered with the new namespace cache (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a"}, secretNamespaces()); diff != "" {
+		t.Errorf("unexpected secrets listed (-want, +got):\n%s", diff)
+	}
+	if err := c.Get(ctx, crclient.ObjectKeyFromObject(secret("b")), &corev1.Secret{}); err == nil {
+		t.Errorf("expected an error getting a secret outside of our shards")
+	}
+	if err := c.Get(ctx, crclient.ObjectKey{Name: "b"}, &corev1.Namespace{}); err != nil {
+		t.Errorf("expected cluster-scoped objects to be served from the base cache: %v", err)
+	}
+	unsharded := UnshardedReader(c, fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret("b")).Build())
+	if err := unsharded.Get(ctx, crclient.ObjectKeyFromObject(secret("b")), &corev1.Secret{}); err != nil {
+		t.Errorf("expected the unsharded reader to read secrets outside of our shards from the API server: %v", err)
+	}
+	if err := unsharded.Get(ctx, crclient.ObjectKeyFromObject(secret("a")), &corev1.Secret{}); err != nil {
+		t.Errorf("expected the unsharded reader to read secrets in our shards from the cache: %v", err)
+	}
+
+	rebalance("b")
+	select {
+	case <-namespaceCaches["a"].stopped:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected the cache for a namespace no longer ours to stop")
+	}
+	if diff := cmp.Diff([]string{"b"}, secretNamespaces()); diff != "" {
+		t.Errorf("unexpected secrets listed after rebalancing (-want, +got):\n%s", diff)
+	}
+	var secrets corev1.SecretList
+	if err := c.List(ctx, &secrets, crclient.InNamespace("a")); err != nil || len(secrets.Items) != 0 {
+		t.Errorf("expected no secrets listed in a namespace no longer ours, got %d: %v", len(secrets.Items), err)
+	}
+}
+
+func TestShardedInformer_RemoveEventHandler(t *testing.T) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "pull-secret"}}
+	base := newFakeCache(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+	namespaceCaches := map[string]*fakeCache{}
+	newNamespaceCache := func(namespace string) (cache.Cache, error) {
+		namespaceCaches[namespace] = newFakeCache()
+		return namespaceCaches[namespace], nil
+	}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+	c := newShardedCache(logr.Discard(), &fakeOwner{namespaces: sets.New[string]("a")}, base, scheme.Scheme, mapper, nil, nil, newNamespaceCache)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.ctx = ctx
+
+	informer, err := c.GetInformer(ctx, &corev1.Secret{})
+	if err != nil {
+		t.Fatalf("failed to get informer: %v", err)
+	}
+	// controllers register handlers as ResourceEventHandlerFuncs, which are not comparable
+	var removed, kept int
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { removed++ },
+	})
+	if err != nil {
+		t.Fatalf("failed to add event handler: %v", err)
+	}
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { kept++ },
+	}); err != nil {
+		t.Fatalf("failed to add event handler: %v", err)
+	}
+	if err := informer.RemoveEventHandler(registration); err != nil {
+		t.Fatalf("failed to remove event handler: %v", err)
+	}
+
+	// only the handlers still registered are attached to the informers of namespaces acquired later
+	if err := c.rebalance(ctx); err != nil {
+		t.Fatalf("failed to rebalance: %v", err)
+	}
+	namespaceInformer, err := namespaceCaches["a"].FakeInformerFor(ctx, &corev1.Secret{})
+	if err != nil {
+		t.Fatalf("failed to get namespace informer: %v", err)
+	}
+	namespaceInformer.Add(secret)
+	if removed != 0 || kept != 1 {
+		t.Errorf("expected only the remaining handler to see the secret, got %d events for the removed handler and %d for the remaining one", removed, kept)
+	}
+}
+
+func TestShardedCache_namespaceSelector(t *testing.T) {
+	base := newFakeCache(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"tenant": "team-a"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+	)
+	newNamespaceCache := func(namespace string) (cache.Cache, error) {
+		return newFakeCache(), nil
+	}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+	selector, err := labels.Parse("tenant=team-a")
+	if err != nil {
+		t.Fatalf("failed to parse selector: %v", err)
+	}
+	c := newShardedCache(logr.Discard(), everyNamespace{}, base, scheme.Scheme, mapper, nil, selector, newNamespaceCache)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.ctx = ctx
+
+	if err := c.rebalance(ctx); err != nil {
+		t.Fatalf("failed to rebalance: %v", err)
+	}
+	if diff := cmp.Diff([]string{"a"}, sets.List(sets.KeySet(c.namespaceCaches()))); diff != "" {
+		t.Errorf("unexpected namespaces watched (-want, +got):\n%s", diff)
+	}
+
+	// namespaces labelled to match the selector after we start are watched from then on
+	namespace := &corev1.Namespace{}
+	if err := base.Get(ctx, crclient.ObjectKey{Name: "b"}, namespace); err != nil {
+		t.Fatalf("failed to get namespace: %v", err)
+	}
+	namespace.Labels = map[string]string{"tenant": "team-a"}
+	if err := base.reader.(crclient.Client).Update(ctx, namespace); err != nil {
+		t.Fatalf("failed to label namespace: %v", err)
+	}
+	if err := c.rebalance(ctx); err != nil {
+		t.Fatalf("failed to rebalance: %v", err)
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, sets.List(sets.KeySet(c.namespaceCaches()))); diff != "" {
+		t.Errorf("unexpected namespaces watched after labelling (-want, +got):\n%s", diff)
+	}
+}
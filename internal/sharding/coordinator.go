@@ -0,0 +1,338 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// LeaseLabel marks the Leases used to coordinate sharding, with a value of either "member" or "shard"
+	LeaseLabel = "acrpull.microsoft.com/sharding"
+
+	memberLeaseValue  = "member"
+	shardLeaseValue   = "shard"
+	memberLeasePrefix = "acrpull-member-"
+	shardLeasePrefix  = "acrpull-shard-"
+
+	defaultLeaseDuration = 30 * time.Second
+	defaultRenewInterval = 10 * time.Second
+	releaseTimeout       = 5 * time.Second
+)
+
+//+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;create;update;delete
+
+// ShardForNamespace determines the shard that objects in the namespace belong to
+func ShardForNamespace(namespace string, shards int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(namespace))
+	return int(hash.Sum32() % uint32(shards))
+}
+
+// Coordinator claims a fair share of shards for this replica through Leases. Every replica holds a member Lease to
+// announce itself; each shard is owned by whichever replica holds the shard's Lease. Replicas compute the same fair
+// share from the live members, so when a replica joins, others release shards for it to acquire, and when a replica
+// goes away, the shards it held are acquired by others once their Leases expire.
+type Coordinator struct {
+	Client crclient.Client
+	Logger logr.Logger
+
+	// Namespace holds the Leases
+	Namespace string
+	// Identity uniquely identifies this replica, e.g. the pod name
+	Identity string
+	// Shards is the number of shards that namespaces are hashed into
+	Shards int
+	// LeaseDuration is how long a Lease is valid for without being renewed
+	LeaseDuration time.Duration
+	// RenewInterval is how often Leases are renewed and shards rebalanced
+	RenewInterval time.Duration
+
+	lock        sync.RWMutex
+	owned       map[int]time.Time
+	subscribers []func()
+
+	now func() time.Time
+}
+
+// NeedLeaderElection is false, as every replica must claim shards
+func (c *Coordinator) NeedLeaderElection() bool {
+	return false
+}
+
+// OwnsNamespace determines whether this replica currently owns the shard the namespace hashes into
+func (c *Coordinator) OwnsNamespace(namespace string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, owned := c.owned[ShardForNamespace(namespace, c.Shards)]
+	return owned
+}
+
+// OwnedShards lists the shards this replica currently owns
+func (c *Coordinator) OwnedShards() []int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return sets.List(sets.KeySet(c.owned))
+}
+
+// Subscribe registers a callback for when the set of shards this replica owns changes
+func (c *Coordinator) Subscribe(callback func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.subscribers = append(c.subscribers, callback)
+}
+
+// Start claims shards until the context is cancelled, then releases them for other replicas
+func (c *Coordinator) Start(ctx context.Context) error {
+	if c.Shards < 1 {
+		return fmt.Errorf("at least one shard is required, got %d", c.Shards)
+	}
+	if c.LeaseDuration == 0 {
+		c.LeaseDuration = defaultLeaseDuration
+	}
+	if c.RenewInterval == 0 {
+		c.RenewInterval = defaultRenewInterval
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+
+	ticker := time.NewTicker(c.RenewInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.sync(ctx); err != nil {
+			c.Logger.Error(err, "failed to coordinate shards")
+		}
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+			defer cancel()
+			c.release(releaseCtx)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync renews our membership, releases shards beyond our fair share, renews the rest and acquires free shards until
+// we hold our fair share
+func (c *Coordinator) sync(ctx context.Context) error {
+	now := c.now()
+	// shards we have not managed to renew in time are no longer ours, whatever happens next
+	c.expire(now)
+
+	if err := c.renewMember(ctx, now); err != nil {
+		return err
+	}
+
+	var leases coordinationv1.LeaseList
+	if err := c.Client.List(ctx, &leases, crclient.InNamespace(c.Namespace), crclient.HasLabels{LeaseLabel}); err != nil {
+		return fmt.Errorf("failed to list leases: %w", err)
+	}
+	members := sets.New[string](c.Identity)
+	shardLeases := map[int]*coordinationv1.Lease{}
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		switch lease.Labels[LeaseLabel] {
+		case memberLeaseValue:
+			if live(lease, now) {
+				members.Insert(*lease.Spec.HolderIdentity)
+			}
+		case shardLeaseValue:
+			shard, err := strconv.Atoi(strings.TrimPrefix(lease.Name, shardLeasePrefix))
+			if err != nil || shard < 0 || shard >= c.Shards {
+				continue
+			}
+			shardLeases[shard] = lease
+		}
+	}
+	target := fairShare(c.Identity, sets.List(members), c.Shards)
+
+	var held, free []int
+	for shard := 0; shard < c.Shards; shard++ {
+		lease, exists := shardLeases[shard]
+		switch {
+		case exists && live(lease, now) && *lease.Spec.HolderIdentity == c.Identity:
+			held = append(held, shard)
+		case !exists || !live(lease, now):
+			free = append(free, shard)
+		}
+	}
+
+	for len(held) > target {
+		shard := held[len(held)-1]
+		held = held[:len(held)-1]
+		c.disown(shard)
+		if err := c.releaseShard(ctx, shardLeases[shard]); err != nil {
+			c.Logger.Error(err, "failed to release shard", "shard", shard)
+		}
+	}
+	for _, shard := range held {
+		if err := c.claim(ctx, shard, shardLeases[shard], now); err != nil {
+			c.disown(shard)
+			c.Logger.Error(err, "failed to renew shard", "shard", shard)
+			continue
+		}
+		c.own(shard, now)
+	}
+	for _, shard := range free {
+		if len(c.OwnedShards()) >= target {
+			break
+		}
+		if err := c.claim(ctx, shard, shardLeases[shard], now); err != nil {
+			if !apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err) {
+				c.Logger.Error(err, "failed to acquire shard", "shard", shard)
+			}
+			continue
+		}
+		c.own(shard, now)
+	}
+	return nil
+}
+
+// fairShare spreads shards evenly over members; members are ordered so that every replica agrees on which receive
+// the remainder
+func fairShare(identity string, members []string, shards int) int {
+	share := shards / len(members)
+	if index := sort.SearchStrings(members, identity); index < shards%len(members) {
+		share++
+	}
+	return share
+}
+
+func live(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	return now.Before(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+func (c *Coordinator) renewMember(ctx context.Context, now time.Time) error {
+	var lease coordinationv1.Lease
+	err := c.Client.Get(ctx, crclient.ObjectKey{Namespace: c.Namespace, Name: memberLeasePrefix + c.Identity}, &lease)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get member lease: %w", err)
+	}
+	if apierrors.IsNotFound(err) {
+		return c.claim(ctx, -1, nil, now)
+	}
+	return c.claim(ctx, -1, &lease, now)
+}
+
+// claim creates or updates a Lease to be held by us; the member Lease is identified by a negative shard
+func (c *Coordinator) claim(ctx context.Context, shard int, existing *coordinationv1.Lease, now time.Time) error {
+	name, value := memberLeasePrefix+c.Identity, memberLeaseValue
+	if shard >= 0 {
+		name, value = fmt.Sprintf("%s%d", shardLeasePrefix, shard), shardLeaseValue
+	}
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       ptr.To(c.Identity),
+		LeaseDurationSeconds: ptr.To(int32(c.LeaseDuration / time.Second)),
+		AcquireTime:          ptr.To(metav1.NewMicroTime(now)),
+		RenewTime:            ptr.To(metav1.NewMicroTime(now)),
+	}
+	if existing == nil {
+		return c.Client.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: c.Namespace, Name: name, Labels: map[string]string{LeaseLabel: value}},
+			Spec:       spec,
+		})
+	}
+	updated := existing.DeepCopy()
+	if existing.Spec.HolderIdentity != nil && *existing.Spec.HolderIdentity == c.Identity {
+		spec.AcquireTime = existing.Spec.AcquireTime
+		spec.LeaseTransitions = existing.Spec.LeaseTransitions
+	} else {
+		spec.LeaseTransitions = ptr.To(ptr.Deref(existing.Spec.LeaseTransitions, 0) + 1)
+	}
+	updated.Spec = spec
+	return c.Client.Update(ctx, updated)
+}
+
+func (c *Coordinator) releaseShard(ctx context.Context, lease *coordinationv1.Lease) error {
+	released := lease.DeepCopy()
+	released.Spec.HolderIdentity = nil
+	return c.Client.Update(ctx, released)
+}
+
+// release hands our shards back and withdraws our membership, so other replicas need not wait for our Leases to expire
+func (c *Coordinator) release(ctx context.Context) {
+	for _, shard := range c.OwnedShards() {
+		c.disown(shard)
+		var lease coordinationv1.Lease
+		if err := c.Client.Get(ctx, crclient.ObjectKey{Namespace: c.Namespace, Name: fmt.Sprintf("%s%d", shardLeasePrefix, shard)}, &lease); err != nil {
+			c.Logger.Error(err, "failed to get shard lease", "shard", shard)
+			continue
+		}
+		if ptr.Deref(lease.Spec.HolderIdentity, "") != c.Identity {
+			continue
+		}
+		if err := c.releaseShard(ctx, &lease); err != nil {
+			c.Logger.Error(err, "failed to release shard", "shard", shard)
+		}
+	}
+	member := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: c.Namespace, Name: memberLeasePrefix + c.Identity}}
+	if err := c.Client.Delete(ctx, member); crclient.IgnoreNotFound(err) != nil {
+		c.Logger.Error(err, "failed to delete member lease")
+	}
+}
+
+func (c *Coordinator) own(shard int, now time.Time) {
+	c.lock.Lock()
+	_, alreadyOwned := c.owned[shard]
+	if c.owned == nil {
+		c.owned = map[int]time.Time{}
+	}
+	c.owned[shard] = now
+	c.lock.Unlock()
+	if !alreadyOwned {
+		c.Logger.Info("acquired shard", "shard", shard)
+		c.notify()
+	}
+}
+
+func (c *Coordinator) disown(shard int) {
+	c.lock.Lock()
+	_, owned := c.owned[shard]
+	delete(c.owned, shard)
+	c.lock.Unlock()
+	if owned {
+		c.Logger.Info("released shard", "shard", shard)
+		c.notify()
+	}
+}
+
+func (c *Coordinator) expire(now time.Time) {
+	c.lock.RLock()
+	var expired []int
+	for shard, renewed := range c.owned {
+		if !now.Before(renewed.Add(c.LeaseDuration)) {
+			expired = append(expired, shard)
+		}
+	}
+	c.lock.RUnlock()
+	for _, shard := range expired {
+		c.disown(shard)
+	}
+}
+
+func (c *Coordinator) notify() {
+	c.lock.RLock()
+	subscribers := c.subscribers
+	c.lock.RUnlock()
+	for _, subscriber := range subscribers {
+		subscriber()
+	}
+}
@@ -0,0 +1,139 @@
+package sharding
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestShardForNamespace(t *testing.T) {
+	seen := map[int]bool{}
+	for _, namespace := range []string{"default", "kube-system", "team-a", "team-b", "team-c", "team-d", "team-e", "team-f"} {
+		shard := ShardForNamespace(namespace, 4)
+		if shard < 0 || shard >= 4 {
+			t.Fatalf("namespace %s hashed into shard %d, outside of [0, 4)", namespace, shard)
+		}
+		if again := ShardForNamespace(namespace, 4); again != shard {
+			t.Errorf("namespace %s hashed into shard %d, then %d", namespace, shard, again)
+		}
+		seen[shard] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("expected namespaces to be spread over shards, got %v", seen)
+	}
+}
+
+func TestFairShare(t *testing.T) {
+	for _, testCase := range []struct {
+		identity string
+		members  []string
+		shards   int
+		expected int
+	}{
+		{identity: "a", members: []string{"a"}, shards: 4, expected: 4},
+		{identity: "a", members: []string{"a", "b"}, shards: 4, expected: 2},
+		{identity: "a", members: []string{"a", "b", "c"}, shards: 4, expected: 2},
+		{identity: "b", members: []string{"a", "b", "c"}, shards: 4, expected: 1},
+		{identity: "c", members: []string{"a", "b", "c"}, shards: 4, expected: 1},
+		{identity: "c", members: []string{"a", "b", "c"}, shards: 2, expected: 0},
+	} {
+		if got := fairShare(testCase.identity, testCase.members, testCase.shards); got != testCase.expected {
+			t.Errorf("%s of %v over %d shards: expected %d, got %d", testCase.identity, testCase.members, testCase.shards, testCase.expected, got)
+		}
+	}
+}
+
+func TestCoordinator(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	newCoordinator := func(identity string) (*Coordinator, *int) {
+		notified := 0
+		c := &Coordinator{
+			Client:        client,
+			Logger:        logr.Discard(),
+			Namespace:     "acrpull",
+			Identity:      identity,
+			Shards:        4,
+			LeaseDuration: 30 * time.Second,
+			RenewInterval: 10 * time.Second,
+			now:           clock,
+		}
+		c.Subscribe(func() { notified++ })
+		return c, &notified
+	}
+	sync := func(c *Coordinator) {
+		t.Helper()
+		if err := c.sync(ctx); err != nil {
+			t.Fatalf("%s failed to sync: %v", c.Identity, err)
+		}
+	}
+	expectShards := func(c *Coordinator, expected []int) {
+		t.Helper()
+		if diff := cmp.Diff(expected, c.OwnedShards()); diff != "" {
+			t.Errorf("%s owns unexpected shards (-want, +got):\n%s", c.Identity, diff)
+		}
+	}
+
+	a, notifiedA := newCoordinator("a")
+	sync(a)
+	expectShards(a, []int{0, 1, 2, 3})
+	if *notifiedA != 4 {
+		t.Errorf("expected a subscriber notification for each shard acquired, got %d", *notifiedA)
+	}
+	for _, namespace := range []string{"default", "team-a", "team-b"} {
+		if !a.OwnsNamespace(namespace) {
+			t.Errorf("expected the only replica to own namespace %s", namespace)
+		}
+	}
+
+	// a second replica joins: it must wait for the first to release its share
+	b, _ := newCoordinator("b")
+	sync(b)
+	expectShards(b, []int{})
+	now = now.Add(10 * time.Second)
+	sync(a)
+	expectShards(a, []int{0, 1})
+	sync(b)
+	expectShards(b, []int{2, 3})
+
+	// renewals keep ownership stable
+	now = now.Add(10 * time.Second)
+	sync(a)
+	sync(b)
+	expectShards(a, []int{0, 1})
+	expectShards(b, []int{2, 3})
+
+	// the second replica goes away without releasing its shards, which the first acquires once they expire
+	now = now.Add(40 * time.Second)
+	sync(a)
+	expectShards(a, []int{0, 1, 2, 3})
+	sync(b)
+	expectShards(b, []int{})
+
+	// a replica shutting down releases its shards and withdraws its membership for others to take over immediately
+	a.release(ctx)
+	expectShards(a, []int{})
+	var leases coordinationv1.LeaseList
+	if err := client.List(ctx, &leases, crclient.InNamespace("acrpull")); err != nil {
+		t.Fatalf("failed to list leases: %v", err)
+	}
+	for _, lease := range leases.Items {
+		if lease.Labels[LeaseLabel] == memberLeaseValue && lease.Name == memberLeasePrefix+"a" {
+			t.Errorf("expected the member lease to be deleted")
+		}
+		if lease.Labels[LeaseLabel] == shardLeaseValue && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == "a" {
+			t.Errorf("expected shard lease %s to be released", lease.Name)
+		}
+	}
+	sync(b)
+	expectShards(b, []int{0, 1, 2, 3})
+}
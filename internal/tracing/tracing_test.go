@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup(t *testing.T) {
+	for _, opts := range []Opts{
+		{Endpoint: "collector:4318", SampleRatio: 1},
+		{Endpoint: "grpc://collector:4317", SampleRatio: 1},
+		{Endpoint: "http://collector:4318/v1/traces", SampleRatio: 2},
+	} {
+		if _, err := Setup(context.Background(), opts); err == nil {
+			t.Errorf("expected an error for %#v", opts)
+		}
+	}
+
+	var exported atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		exported.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	shutdown, err := Setup(context.Background(), Opts{Endpoint: server.URL + "/v1/traces", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("failed to set up tracing: %v", err)
+	}
+	ctx, span := otel.Tracer("test").Start(context.Background(), "test")
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if carrier.Get("traceparent") == "" {
+		t.Errorf("expected the trace context to be propagated")
+	}
+	End(span, errors.New("oops"))
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shut down tracing: %v", err)
+	}
+	if exported.Load() == 0 {
+		t.Errorf("expected spans to be exported on shutdown")
+	}
+}
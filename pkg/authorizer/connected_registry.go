@@ -0,0 +1,138 @@
+package authorizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+)
+
+// RegistryForSpec returns the host images are pulled through for the registry of a v1beta2 pull binding, including the
+// port of a connected registry, and the base URL of the registry's API.
+func RegistryForSpec(spec msiacrpullv1beta2.AcrConfiguration) (string, string) {
+	host, scheme := spec.Server, "https"
+	if spec.ConnectedRegistry != nil {
+		if spec.ConnectedRegistry.Port != 0 {
+			host = fmt.Sprintf("%s:%d", spec.Server, spec.ConnectedRegistry.Port)
+		}
+		if spec.ConnectedRegistry.AllowInsecureHTTP {
+			scheme = "http"
+		}
+	}
+	return host, scheme + "://" + host
+}
+
+// FetchClientToken authenticates with a registry client token, which is presented to the registry as it is; the
+// password of the token is the subject token of the request.
+func FetchClientToken(_ context.Context, request *CredentialRequest, password string) (azcore.AccessToken, error) {
+	if request.TokenName == "" || password == "" {
+		return azcore.AccessToken{}, errors.New("the name and password of the client token are required")
+	}
+	return azcore.AccessToken{Token: password}, nil
+}
+
+// connectedRegistryTokenResponse is the response of a registry token service to a token request
+type connectedRegistryTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Token       string `json:"token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// ExchangeConnectedRegistryToken exchanges the password of a client token for an access token for the scope in the
+// request, with the token service of an ACR connected registry.
+func ExchangeConnectedRegistryToken(ctx context.Context, password azcore.AccessToken, request *CredentialRequest) (azcore.AccessToken, error) {
+	endpoint, service, err := authEndpoint(request)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	options := clientOptions(registryLimiter, request.Registry)
+	pipeline := runtime.NewPipeline("acrpull", "v1", runtime.PipelineOptions{}, &options)
+	query := url.Values{"service": []string{service}}
+	if request.Scope != "" {
+		query.Set("scope", request.Scope)
+	}
+	req, err := runtime.NewRequest(ctx, http.MethodGet, endpoint+"/oauth2/token?"+query.Encode())
+	if err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Raw().SetBasicAuth(request.TokenName, password.Token)
+	resp, err := pipeline.Do(req)
+	if err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to exchange client token for access token: %w", classifyRegistryError(err, request.Registry, request.Scope))
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if runtime.HasStatusCode(resp, http.StatusUnauthorized) {
+		// token services drop the actions a client token may not take rather than refusing the request, so this is
+		// always a bad token rather than a scope the token may not pull
+		return azcore.AccessToken{}, fmt.Errorf("failed to exchange client token for access token: %w", &Error{
+			Kind: ErrRegistryUnauthorized,
+			Hint: fmt.Sprintf("Check the name and password of the client token %s, and that it is enabled on the connected registry %s.", request.TokenName, request.Registry),
+			Err:  runtime.NewResponseError(resp),
+		})
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return azcore.AccessToken{}, fmt.Errorf("failed to exchange client token for access token: %w", classifyRegistryError(runtime.NewResponseError(resp), request.Registry, request.Scope))
+	}
+
+	var response connectedRegistryTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	accessToken := response.AccessToken
+	if accessToken == "" {
+		accessToken = response.Token
+	}
+	if accessToken == "" {
+		return azcore.AccessToken{}, errors.New("got an empty response when exchanging client token for access token")
+	}
+
+	expiry, err := tokenExpiry(accessToken)
+	if err != nil {
+		// registries are free to issue opaque tokens, whose lifetime is only given in the response
+		if response.ExpiresIn <= 0 {
+			return azcore.AccessToken{}, fmt.Errorf("failed to determine access token expiration: %w", err)
+		}
+		expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+	return azcore.AccessToken{Token: accessToken, ExpiresOn: expiry}, nil
+}
+
+// authEndpoint determines the base URL of the token service for the request, and the service name tokens are
+// requested for
+func authEndpoint(request *CredentialRequest) (string, string, error) {
+	endpoint := request.AuthEndpoint
+	if endpoint == "" {
+		endpoint = request.Endpoint
+	}
+	if endpoint == "" {
+		endpoint = "https://" + request.Registry
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse auth endpoint: %w", err)
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return "", "", fmt.Errorf("auth endpoint %s must be an http or https URL", endpoint)
+	}
+	// credentials are sent to this endpoint, so it must be exactly the host that callers validated
+	if parsed.Hostname() == "" || parsed.User != nil || parsed.RawQuery != "" || parsed.Fragment != "" || (parsed.Path != "" && parsed.Path != "/") {
+		return "", "", fmt.Errorf("auth endpoint %s must be a base URL without credentials, path, query, or fragment", endpoint)
+	}
+	// tokens are issued for the registry by its host name, without any port it listens on
+	service := request.Registry
+	if registry, err := url.Parse("https://" + request.Registry); err == nil && registry.Hostname() != "" {
+		service = registry.Hostname()
+	}
+	return parsed.Scheme + "://" + parsed.Host, service, nil
+}
@@ -0,0 +1,201 @@
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// These classify the failures to acquire a token; use errors.Is to test for them.
+var (
+	// ErrIdentityNotFound means Entra or IMDS does not know the identity
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrFederationMismatch means no federated identity credential on the identity trusts the service account token
+	ErrFederationMismatch = errors.New("no matching federated identity credential")
+	// ErrRegistryUnauthorized means the registry refused to issue a token to the identity
+	ErrRegistryUnauthorized = errors.New("identity not authorized by registry")
+	// ErrScopeDenied means the registry refused to issue a token for the scope requested
+	ErrScopeDenied = errors.New("scope denied by registry")
+	// ErrRegistryNotFound means the registry does not exist or could not be resolved
+	ErrRegistryNotFound = errors.New("registry not found")
+	// ErrThrottled means Entra, IMDS or the registry asked us to slow down
+	ErrThrottled = errors.New("throttled")
+	// ErrTransient means the request failed in a way that is likely to succeed when retried
+	ErrTransient = errors.New("transient failure")
+)
+
+// Error is a classified failure to acquire a token, along with a hint at how to fix it, if the user can
+type Error struct {
+	// Kind is one of the Err* classifications
+	Kind error
+	// Hint describes how to remediate the failure
+	Hint string
+	// Err is the underlying failure
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Hint returns the remediation hint for a classified error, if it has one
+func Hint(err error) string {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Hint
+	}
+	return ""
+}
+
+// Retryable determines if an error is likely to resolve itself, without the user having to act
+func Retryable(err error) bool {
+	return errors.Is(err, ErrThrottled) || errors.Is(err, ErrTransient)
+}
+
+// Classified determines if an error has been classified
+func Classified(err error) bool {
+	var classified *Error
+	return errors.As(err, &classified)
+}
+
+var entraErrorCode = regexp.MustCompile(`AADSTS(\d+)`)
+
+// Entra error codes, see https://learn.microsoft.com/en-us/entra/identity-platform/reference-error-codes
+const (
+	entraTenantNotFound             = "90002"
+	entraApplicationNotFound        = "700016"
+	entraNoMatchingFederatedCred    = "70021"
+	entraFederatedTokenInvalid      = "700211"
+	entraFederatedTokenAudience     = "700212"
+	entraFederatedTokenSubject      = "700213"
+	entraAssertionExpired           = "700024"
+	entraRequestThrottled           = "50196"
+	entraServiceTemporarilyUnusable = "90033"
+)
+
+// classifyManagedIdentityError classifies a failure to fetch a token for a managed identity from IMDS
+func classifyManagedIdentityError(err error, id azidentity.ManagedIDKind) error {
+	if err == nil || Classified(err) {
+		return err
+	}
+	if kind := classifyTransport(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	var authErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authErr) && authErr.RawResponse != nil && authErr.RawResponse.StatusCode == http.StatusBadRequest {
+		return &Error{
+			Kind: ErrIdentityNotFound,
+			Hint: fmt.Sprintf("Assign the managed identity %s to the nodes running the controller, e.g. to the node pool's virtual machine scale set.", managedIdentityKey(id)),
+			Err:  err,
+		}
+	}
+	return err
+}
+
+// classifyWorkloadIdentityError classifies a failure to exchange a service account token for a token from Entra
+func classifyWorkloadIdentityError(err error, tenantID, clientID, serviceAccountToken string) error {
+	if err == nil || Classified(err) {
+		return err
+	}
+	if kind := classifyTransport(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	match := entraErrorCode.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	switch match[1] {
+	case entraTenantNotFound:
+		return &Error{Kind: ErrIdentityNotFound, Hint: fmt.Sprintf("Check the tenant ID %s.", tenantID), Err: err}
+	case entraApplicationNotFound:
+		return &Error{Kind: ErrIdentityNotFound, Hint: fmt.Sprintf("Check that the client ID %s belongs to an identity in tenant %s.", clientID, tenantID), Err: err}
+	case entraNoMatchingFederatedCred, entraFederatedTokenInvalid, entraFederatedTokenAudience, entraFederatedTokenSubject:
+		hint := fmt.Sprintf("Add a federated identity credential to the identity with client ID %s for the cluster's OIDC issuer", clientID)
+		if subject := tokenSubject(serviceAccountToken); subject != "" {
+			hint += fmt.Sprintf(" with subject %s", subject)
+		}
+		return &Error{Kind: ErrFederationMismatch, Hint: hint + ".", Err: err}
+	case entraAssertionExpired, entraServiceTemporarilyUnusable:
+		return &Error{Kind: ErrTransient, Err: err}
+	case entraRequestThrottled:
+		return &Error{Kind: ErrThrottled, Err: err}
+	}
+	return err
+}
+
+// classifyRegistryError classifies a failure to exchange tokens with ACR; an empty scope denotes the exchange for a
+// refresh token, which is not scoped
+func classifyRegistryError(err error, acrFQDN, scope string) error {
+	if err == nil || Classified(err) {
+		return err
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return &Error{Kind: ErrRegistryNotFound, Hint: fmt.Sprintf("Check the registry server %s.", acrFQDN), Err: err}
+	}
+	if kind := classifyTransport(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	switch respErr.StatusCode {
+	case http.StatusNotFound:
+		return &Error{Kind: ErrRegistryNotFound, Hint: fmt.Sprintf("Check the registry server %s.", acrFQDN), Err: err}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		if scope != "" {
+			return &Error{Kind: ErrScopeDenied, Hint: fmt.Sprintf("Check that the scope %q names repositories in %s that the identity may pull from.", scope, acrFQDN), Err: err}
+		}
+		return &Error{Kind: ErrRegistryUnauthorized, Hint: fmt.Sprintf("Grant the identity the AcrPull role on the registry %s, and check the registry's network rules.", acrFQDN), Err: err}
+	}
+	return err
+}
+
+// classifyTransport recognizes throttling, server errors and network failures, which are all worth retrying
+func classifyTransport(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTransient
+	}
+	var statusCode int
+	var respErr *azcore.ResponseError
+	var authErr *azidentity.AuthenticationFailedError
+	switch {
+	case errors.As(err, &respErr):
+		statusCode = respErr.StatusCode
+	case errors.As(err, &authErr) && authErr.RawResponse != nil:
+		statusCode = authErr.RawResponse.StatusCode
+	}
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrThrottled
+	case statusCode >= http.StatusInternalServerError:
+		return ErrTransient
+	}
+	var netErr net.Error
+	if statusCode == 0 && errors.As(err, &netErr) {
+		return ErrTransient
+	}
+	return nil
+}
+
+// tokenSubject returns the unverified sub claim of a JWT, for use in remediation hints
+func tokenSubject(token string) string {
+	parsed, _, err := jwt.NewParser(jwt.WithoutClaimsValidation()).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+	subject, _ := parsed.Claims.GetSubject()
+	return subject
+}
@@ -2,13 +2,9 @@ package authorizer
 
 import (
 	"context"
-
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 )
 
-//go:generate sh -c "$MOCKGEN github.com/Azure/msi-acrpull/pkg/authorizer Interface,ManagedIdentityTokenRetriever,ACRTokenExchanger > ./mock_$GOPACKAGE/interfaces.go"
-
-// Interface is the authorizer interface to acquire ACR access tokens.
-type Interface interface {
-	AcquireACRAccessToken(ctx context.Context, identityResourceID, clientID, acrFQDN, scope string) (azcore.AccessToken, error)
+// CredentialProvider issues registry credentials for normalized credential requests.
+type CredentialProvider interface {
+	Credential(ctx context.Context, request *CredentialRequest) (*Credential, error)
 }
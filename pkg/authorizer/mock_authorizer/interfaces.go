@@ -13,44 +13,44 @@ import (
 	context "context"
 	reflect "reflect"
 
-	azcore "github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	authorizer "github.com/Azure/msi-acrpull/pkg/authorizer"
 	gomock "go.uber.org/mock/gomock"
 )
 
-// MockInterface is a mock of Interface interface.
-type MockInterface struct {
+// MockCredentialProvider is a mock of CredentialProvider interface.
+type MockCredentialProvider struct {
 	ctrl     *gomock.Controller
-	recorder *MockInterfaceMockRecorder
+	recorder *MockCredentialProviderMockRecorder
 }
 
-// MockInterfaceMockRecorder is the mock recorder for MockInterface.
-type MockInterfaceMockRecorder struct {
-	mock *MockInterface
+// MockCredentialProviderMockRecorder is the mock recorder for MockCredentialProvider.
+type MockCredentialProviderMockRecorder struct {
+	mock *MockCredentialProvider
 }
 
-// NewMockInterface creates a new mock instance.
-func NewMockInterface(ctrl *gomock.Controller) *MockInterface {
-	mock := &MockInterface{ctrl: ctrl}
-	mock.recorder = &MockInterfaceMockRecorder{mock}
+// NewMockCredentialProvider creates a new mock instance.
+func NewMockCredentialProvider(ctrl *gomock.Controller) *MockCredentialProvider {
+	mock := &MockCredentialProvider{ctrl: ctrl}
+	mock.recorder = &MockCredentialProviderMockRecorder{mock}
 	return mock
 }
 
 // EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
+func (m *MockCredentialProvider) EXPECT() *MockCredentialProviderMockRecorder {
 	return m.recorder
 }
 
-// AcquireACRAccessToken mocks base method.
-func (m *MockInterface) AcquireACRAccessToken(ctx context.Context, identityResourceID, clientID, acrFQDN, scope string) (azcore.AccessToken, error) {
+// Credential mocks base method.
+func (m *MockCredentialProvider) Credential(ctx context.Context, request *authorizer.CredentialRequest) (*authorizer.Credential, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AcquireACRAccessToken", ctx, identityResourceID, clientID, acrFQDN, scope)
-	ret0, _ := ret[0].(azcore.AccessToken)
+	ret := m.ctrl.Call(m, "Credential", ctx, request)
+	ret0, _ := ret[0].(*authorizer.Credential)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// AcquireACRAccessToken indicates an expected call of AcquireACRAccessToken.
-func (mr *MockInterfaceMockRecorder) AcquireACRAccessToken(ctx, identityResourceID, clientID, acrFQDN, scope any) *gomock.Call {
+// Credential indicates an expected call of Credential.
+func (mr *MockCredentialProviderMockRecorder) Credential(ctx, request any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcquireACRAccessToken", reflect.TypeOf((*MockInterface)(nil).AcquireACRAccessToken), ctx, identityResourceID, clientID, acrFQDN, scope)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Credential", reflect.TypeOf((*MockCredentialProvider)(nil).Credential), ctx, request)
 }
@@ -0,0 +1,193 @@
+package authorizer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Azure/msi-acrpull/internal/tracing"
+)
+
+// AuthMethod names the way an identity authenticates to Entra.
+type AuthMethod string
+
+const (
+	// AuthMethodManagedIdentity authenticates as a managed identity assigned to the node, through IMDS
+	AuthMethodManagedIdentity AuthMethod = "managedIdentity"
+	// AuthMethodWorkloadIdentity authenticates as an Entra application federated with a service account, presenting
+	// a token for the service account as the client assertion
+	AuthMethodWorkloadIdentity AuthMethod = "workloadIdentity"
+	// AuthMethodClientToken authenticates with a client token issued by the registry itself, presenting its password
+	// as the subject token
+	AuthMethodClientToken AuthMethod = "clientToken"
+)
+
+// RegistryType names the kind of registry a credential is issued for.
+type RegistryType string
+
+const (
+	// RegistryTypeACR is an Azure Container Registry, which exchanges Entra tokens for its own
+	RegistryTypeACR RegistryType = "acr"
+	// RegistryTypeConnectedRegistry is an on-premises ACR connected registry, which exchanges client tokens for its
+	// own tokens
+	RegistryTypeConnectedRegistry RegistryType = "connectedRegistry"
+)
+
+// SubjectTokenSource returns the token an identity presents to Entra to prove who it is, if its auth method needs one.
+type SubjectTokenSource func(ctx context.Context) (string, error)
+
+// CredentialRequest describes a registry credential in terms independent of the resource that asked for it.
+type CredentialRequest struct {
+	// Method is the way the identity authenticates to Entra
+	Method AuthMethod
+	// ClientID identifies the managed identity or application to authenticate as
+	ClientID string
+	// ResourceID identifies the managed identity to authenticate as, when no client ID is given
+	ResourceID string
+	// TenantID is the tenant of the application, for workload identity
+	TenantID string
+	// TokenName is the name of the registry client token, for client token authentication
+	TokenName string
+	// SubjectToken provides the client assertion, for workload identity, or the password, for client tokens
+	SubjectToken SubjectTokenSource
+
+	// Cloud holds the Entra authority and the audience of the token exchanged with the registry
+	Cloud cloud.Configuration
+
+	// RegistryType is the kind of registry the credential is for, defaulting to ACR
+	RegistryType RegistryType
+	// Registry is the FQDN of the registry, with the port it listens on if not the default
+	Registry string
+	// Endpoint is the base URL of the registry's API, defaulting to https://<Registry>
+	Endpoint string
+	// AuthEndpoint is the base URL of the registry's token service, defaulting to the endpoint of the registry
+	AuthEndpoint string
+	// Scope is the repository access requested, or empty for an unscoped credential
+	Scope string
+}
+
+// Credential is a registry credential along with what is known about it.
+type Credential struct {
+	// Token is the access token the registry accepts
+	Token azcore.AccessToken
+	// Registry is the FQDN of the registry the token is for
+	Registry string
+	// GrantedScope is the repository access the registry recorded in the token, if it did
+	GrantedScope *string
+	// TokenID identifies the token in audit records without disclosing it
+	TokenID string
+}
+
+// Username is the user name the registry expects the token to be presented with.
+func (c *Credential) Username() string {
+	return acrUsername
+}
+
+// DockerConfig formats the credential as a docker config for the registry and any additional hosts that front it.
+func (c *Credential) DockerConfig(additionalHosts ...string) (string, error) {
+	return CreateACRDockerCfg(c.Registry, c.Token, additionalHosts...)
+}
+
+// IdentityTokenFetcher authenticates the identity in the request to Entra, returning a token for the audience the
+// registry accepts.
+type IdentityTokenFetcher func(ctx context.Context, request *CredentialRequest, subjectToken string) (azcore.AccessToken, error)
+
+// RegistryTokenExchanger exchanges a token for the identity for a registry access token.
+type RegistryTokenExchanger func(ctx context.Context, identityToken azcore.AccessToken, request *CredentialRequest) (azcore.AccessToken, error)
+
+// Provider issues registry credentials by authenticating with the fetcher registered for the auth method of a request,
+// then exchanging the token with the exchanger registered for its registry type. Registration is not safe to do
+// concurrently with issuing credentials.
+type Provider struct {
+	fetchers   map[AuthMethod]IdentityTokenFetcher
+	exchangers map[RegistryType]RegistryTokenExchanger
+}
+
+var _ CredentialProvider = (*Provider)(nil)
+
+// NewProvider returns a provider supporting managed and workload identity for ACR, and client tokens for ACR connected
+// registries.
+func NewProvider() *Provider {
+	p := &Provider{
+		fetchers:   map[AuthMethod]IdentityTokenFetcher{},
+		exchangers: map[RegistryType]RegistryTokenExchanger{},
+	}
+	p.RegisterAuthMethod(AuthMethodManagedIdentity, FetchManagedIdentityToken)
+	p.RegisterAuthMethod(AuthMethodWorkloadIdentity, FetchWorkloadIdentityToken)
+	p.RegisterAuthMethod(AuthMethodClientToken, FetchClientToken)
+	p.RegisterRegistryType(RegistryTypeACR, ExchangeACRAccessTokenForRequest)
+	p.RegisterRegistryType(RegistryTypeConnectedRegistry, ExchangeConnectedRegistryToken)
+	return p
+}
+
+// RegisterAuthMethod adds or replaces the fetcher for an auth method.
+func (p *Provider) RegisterAuthMethod(method AuthMethod, fetcher IdentityTokenFetcher) {
+	p.fetchers[method] = fetcher
+}
+
+// RegisterRegistryType adds or replaces the exchanger for a registry type.
+func (p *Provider) RegisterRegistryType(registryType RegistryType, exchanger RegistryTokenExchanger) {
+	p.exchangers[registryType] = exchanger
+}
+
+// Credential issues a registry credential for the request.
+func (p *Provider) Credential(ctx context.Context, request *CredentialRequest) (*Credential, error) {
+	fetch, ok := p.fetchers[request.Method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported auth method %q", request.Method)
+	}
+	registryType := request.RegistryType
+	if registryType == "" {
+		registryType = RegistryTypeACR
+	}
+	exchange, ok := p.exchangers[registryType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported registry type %q", registryType)
+	}
+
+	var subjectToken string
+	if request.SubjectToken != nil {
+		var err error
+		if subjectToken, err = request.SubjectToken(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	spans := spanTracer(ctx)
+	identityCtx, identitySpan := spans.Start(ctx, "FetchARMToken", trace.WithAttributes(attribute.String("auth.method", string(request.Method))))
+	identityToken, err := fetch(identityCtx, request, subjectToken)
+	tracing.End(identitySpan, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve ARM token: %w", err)
+	}
+
+	registryCtx, registrySpan := spans.Start(ctx, "ExchangeACRToken", trace.WithAttributes(attribute.String("acr.server", request.Registry), attribute.String("acr.scope", request.Scope)))
+	registryToken, err := exchange(registryCtx, identityToken, request)
+	tracing.End(registrySpan, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve ACR token: %w", err)
+	}
+
+	credential := &Credential{
+		Token:    registryToken,
+		Registry: request.Registry,
+		TokenID:  TokenID(registryToken.Token),
+	}
+	if grantedScope, recorded := GrantedScope(registryToken.Token); recorded {
+		credential.GrantedScope = &grantedScope
+	}
+	return credential, nil
+}
+
+// spanTracer records spans with the tracer provider of the caller's span, so they land alongside it, falling back to
+// the globally registered provider
+func spanTracer(ctx context.Context) trace.Tracer {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider().Tracer("github.com/Azure/msi-acrpull/pkg/authorizer")
+	}
+	return tracer
+}
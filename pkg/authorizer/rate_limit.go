@@ -0,0 +1,143 @@
+package authorizer
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"golang.org/x/time/rate"
+)
+
+// defaultThrottleBackoff is how long we hold off requests after being throttled without being told for how long
+const defaultThrottleBackoff = time.Second
+
+// RateLimits configures client-side token-bucket limits on the token requests we make. A zero rate disables the limit.
+type RateLimits struct {
+	// RegistryQPS is the sustained rate of token exchanges allowed with each ACR registry
+	RegistryQPS float64
+	// RegistryBurst is the number of token exchanges allowed with each ACR registry in a burst
+	RegistryBurst int
+	// IdentityQPS is the sustained rate of token requests allowed from Entra or IMDS for each identity
+	IdentityQPS float64
+	// IdentityBurst is the number of token requests allowed from Entra or IMDS for each identity in a burst
+	IdentityBurst int
+}
+
+var (
+	registryLimiter = newKeyedLimiter(0, 0)
+	identityLimiter = newKeyedLimiter(0, 0)
+)
+
+// SetRateLimits configures the limits applied to token requests from now on. Callers over a limit wait for their turn,
+// and all callers wait out any Retry-After the registry or identity provider responds with.
+func SetRateLimits(limits RateLimits) {
+	registryLimiter.configure(limits.RegistryQPS, limits.RegistryBurst)
+	identityLimiter.configure(limits.IdentityQPS, limits.IdentityBurst)
+}
+
+// keyedLimiter holds a token bucket for every key, along with the time until which the key has been throttled
+type keyedLimiter struct {
+	lock         sync.Mutex
+	limit        rate.Limit
+	burst        int
+	limiters     map[string]*rate.Limiter
+	blockedUntil map[string]time.Time
+}
+
+func newKeyedLimiter(qps float64, burst int) *keyedLimiter {
+	l := &keyedLimiter{}
+	l.configure(qps, burst)
+	return l
+}
+
+func (l *keyedLimiter) configure(qps float64, burst int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.limit = rate.Inf
+	if qps > 0 {
+		l.limit = rate.Limit(qps)
+	}
+	l.burst = max(burst, 1)
+	l.limiters = map[string]*rate.Limiter{}
+	l.blockedUntil = map[string]time.Time{}
+}
+
+// Wait blocks until a request for the key is allowed or the context is done
+func (l *keyedLimiter) Wait(ctx context.Context, key string) error {
+	l.lock.Lock()
+	limiter, exists := l.limiters[key]
+	if !exists {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[key] = limiter
+	}
+	blockedUntil := l.blockedUntil[key]
+	l.lock.Unlock()
+
+	if wait := time.Until(blockedUntil); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return limiter.Wait(ctx)
+}
+
+// Throttle holds off requests for the key until the time given
+func (l *keyedLimiter) Throttle(key string, until time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if until.After(l.blockedUntil[key]) {
+		l.blockedUntil[key] = until
+	}
+}
+
+// rateLimitPolicy waits for the limiter before every attempt at a request, and feeds throttling responses back to it
+type rateLimitPolicy struct {
+	limiter *keyedLimiter
+	key     string
+}
+
+func (p rateLimitPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if err := p.limiter.Wait(req.Raw().Context(), p.key); err != nil {
+		return nil, err
+	}
+	resp, err := req.Next()
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		backoff, ok := retryAfter(resp, time.Now())
+		if !ok && resp.StatusCode == http.StatusTooManyRequests {
+			backoff = defaultThrottleBackoff
+		}
+		if backoff > 0 {
+			p.limiter.Throttle(p.key, time.Now().Add(backoff))
+		}
+	}
+	return resp, err
+}
+
+// retryAfter determines how long the response asks us to wait before retrying, if it says
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	for _, header := range []string{"retry-after-ms", "x-ms-retry-after-ms"} {
+		if value := resp.Header.Get(header); value != "" {
+			if milliseconds, err := strconv.Atoi(value); err == nil && milliseconds >= 0 {
+				return time.Duration(milliseconds) * time.Millisecond, true
+			}
+		}
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,67 @@
+package authorizer
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// accessClaims holds the access ACR granted in a token; ACR capitalizes the fields, which encoding/json matches
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Access *[]accessEntry `json:"access"`
+}
+
+type accessEntry struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+// GrantedScope reads the access granted by an ACR access token, formatted as a scope like the one requested for it.
+// ACR silently drops the actions an identity may not take from the access it grants, so this may be narrower than the
+// scope requested. Tokens without an access claim, like refresh tokens, report false.
+func GrantedScope(token string) (string, bool) {
+	claims := &accessClaims{}
+	if _, _, err := jwt.NewParser(jwt.WithoutClaimsValidation()).ParseUnverified(token, claims); err != nil || claims.Access == nil {
+		return "", false
+	}
+	var scopes []string
+	for _, entry := range *claims.Access {
+		scopes = append(scopes, strings.Join([]string{entry.Type, entry.Name, strings.Join(entry.Actions, ",")}, ":"))
+	}
+	return strings.Join(scopes, " "), true
+}
+
+// MissingScope determines which of the actions in the requested scope were not granted, formatted as a scope.
+func MissingScope(requested, granted string) string {
+	grantedActions := map[string][]string{}
+	for _, scope := range strings.Fields(granted) {
+		resource, actions := splitScope(scope)
+		grantedActions[resource] = append(grantedActions[resource], actions...)
+	}
+	var missing []string
+	for _, scope := range strings.Fields(requested) {
+		resource, actions := splitScope(scope)
+		if slices.Contains(grantedActions[resource], "*") {
+			continue
+		}
+		actions = slices.DeleteFunc(actions, func(action string) bool {
+			return slices.Contains(grantedActions[resource], action)
+		})
+		if len(actions) > 0 {
+			missing = append(missing, resource+":"+strings.Join(actions, ","))
+		}
+	}
+	return strings.Join(missing, " ")
+}
+
+// splitScope splits a scope like repository:name:pull,push into the resource it names and the actions on it
+func splitScope(scope string) (string, []string) {
+	index := strings.LastIndex(scope, ":")
+	if index < 0 {
+		return scope, nil
+	}
+	return scope[:index], strings.Split(scope[index+1:], ",")
+}
@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
-	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/internal/tracing"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/utils/ptr"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
@@ -22,16 +25,36 @@ func ExchangeACRAccessToken(ctx context.Context, armToken azcore.AccessToken, ac
 	if err != nil {
 		return azcore.AccessToken{}, fmt.Errorf("failed to parse ACR endpoint: %w", err)
 	}
+	return exchangeACRAccessToken(ctx, armToken, endpoint.String(), endpoint.Hostname(), acrFQDN, scope)
+}
+
+// ExchangeACRAccessTokenForRequest exchanges an ARM access token for an ACR access token for the registry and scope in
+// the request, with the auth endpoint of the request if it has one.
+func ExchangeACRAccessTokenForRequest(ctx context.Context, armToken azcore.AccessToken, request *CredentialRequest) (azcore.AccessToken, error) {
+	endpoint, service, err := authEndpoint(request)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	if !strings.HasPrefix(endpoint, "https://") {
+		return azcore.AccessToken{}, fmt.Errorf("refusing to send an Entra token to %s over plain HTTP", endpoint)
+	}
+	return exchangeACRAccessToken(ctx, armToken, endpoint, service, request.Registry, request.Scope)
+}
 
-	client, err := azcontainerregistry.NewAuthenticationClient(endpoint.String(), nil)
+func exchangeACRAccessToken(ctx context.Context, armToken azcore.AccessToken, endpoint, service, acrFQDN, scope string) (azcore.AccessToken, error) {
+	client, err := azcontainerregistry.NewAuthenticationClient(endpoint, &azcontainerregistry.AuthenticationClientOptions{
+		ClientOptions: clientOptions(registryLimiter, acrFQDN),
+	})
 	if err != nil {
 		return azcore.AccessToken{}, fmt.Errorf("failed to create ACR authentication client: %w", err)
 	}
-	refreshResponse, err := client.ExchangeAADAccessTokenForACRRefreshToken(ctx, azcontainerregistry.PostContentSchemaGrantTypeAccessToken, endpoint.Hostname(), &azcontainerregistry.AuthenticationClientExchangeAADAccessTokenForACRRefreshTokenOptions{
+	refreshCtx, refreshSpan := tracer.Start(ctx, "ExchangeAADAccessTokenForACRRefreshToken", trace.WithAttributes(attribute.String("acr.server", acrFQDN)))
+	refreshResponse, err := client.ExchangeAADAccessTokenForACRRefreshToken(refreshCtx, azcontainerregistry.PostContentSchemaGrantTypeAccessToken, service, &azcontainerregistry.AuthenticationClientExchangeAADAccessTokenForACRRefreshTokenOptions{
 		AccessToken: ptr.To(armToken.Token),
 	})
+	tracing.End(refreshSpan, err)
 	if err != nil {
-		return azcore.AccessToken{}, fmt.Errorf("failed to exchange AAD access token for ACR refresh token: %w", err)
+		return azcore.AccessToken{}, fmt.Errorf("failed to exchange AAD access token for ACR refresh token: %w", classifyRegistryError(err, acrFQDN, ""))
 	}
 
 	if refreshResponse.RefreshToken == nil {
@@ -41,11 +64,13 @@ func ExchangeACRAccessToken(ctx context.Context, armToken azcore.AccessToken, ac
 	// for legacy compatibility, we allow exposing the unscoped refresh token
 	accessToken := *refreshResponse.RefreshToken
 	if scope != "" {
-		accessResponse, err := client.ExchangeACRRefreshTokenForACRAccessToken(ctx, acrFQDN, scope, *refreshResponse.RefreshToken, &azcontainerregistry.AuthenticationClientExchangeACRRefreshTokenForACRAccessTokenOptions{
+		accessCtx, accessSpan := tracer.Start(ctx, "ExchangeACRRefreshTokenForACRAccessToken", trace.WithAttributes(attribute.String("acr.server", acrFQDN), attribute.String("acr.scope", scope)))
+		accessResponse, err := client.ExchangeACRRefreshTokenForACRAccessToken(accessCtx, service, scope, *refreshResponse.RefreshToken, &azcontainerregistry.AuthenticationClientExchangeACRRefreshTokenForACRAccessTokenOptions{
 			GrantType: ptr.To(azcontainerregistry.TokenGrantTypeRefreshToken),
 		})
+		tracing.End(accessSpan, err)
 		if err != nil {
-			return azcore.AccessToken{}, fmt.Errorf("failed to exchange ACR refresh token for ACR access token: %w", err)
+			return azcore.AccessToken{}, fmt.Errorf("failed to exchange ACR refresh token for ACR access token: %w", classifyRegistryError(err, acrFQDN, scope))
 		}
 		if accessResponse.AccessToken == nil {
 			return azcore.AccessToken{}, errors.New("got an empty response when exchanging ACR refresh token for ACR access token")
@@ -53,33 +78,36 @@ func ExchangeACRAccessToken(ctx context.Context, armToken azcore.AccessToken, ac
 		accessToken = *accessResponse.AccessToken
 	}
 
+	expiry, err := tokenExpiry(accessToken)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	return azcore.AccessToken{
+		Token:     accessToken,
+		ExpiresOn: expiry,
+	}, nil
+}
+
+// tokenExpiry reads the unverified exp claim of an ACR access token
+func tokenExpiry(accessToken string) (time.Time, error) {
 	token, _, err := jwt.NewParser(jwt.WithoutClaimsValidation()).ParseUnverified(accessToken, jwt.MapClaims{})
 	if err != nil {
-		return azcore.AccessToken{}, fmt.Errorf("failed to parse ACR access token")
+		return time.Time{}, fmt.Errorf("failed to parse ACR access token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return azcore.AccessToken{}, fmt.Errorf("unexpected claim type from ACR access token")
+		return time.Time{}, fmt.Errorf("unexpected claim type from ACR access token")
 	}
 
-	var expiry time.Time
 	switch exp := claims["exp"].(type) {
 	case float64:
-		expiry = time.Unix(int64(exp), 0)
+		return time.Unix(int64(exp), 0), nil
 	case json.Number:
 		timestamp, _ := exp.Int64()
-		expiry = time.Unix(timestamp, 0)
+		return time.Unix(timestamp, 0), nil
 	default:
-		return azcore.AccessToken{}, fmt.Errorf("failed to parse ACR acess token expiration")
+		return time.Time{}, fmt.Errorf("failed to parse ACR acess token expiration")
 	}
-
-	return azcore.AccessToken{
-		Token:     accessToken,
-		ExpiresOn: expiry,
-	}, nil
-}
-
-func ExchangeACRAccessTokenForSpec(ctx context.Context, armToken azcore.AccessToken, spec msiacrpullv1beta2.AcrConfiguration) (azcore.AccessToken, error) {
-	return ExchangeACRAccessToken(ctx, armToken, spec.Server, spec.Scope)
 }
@@ -18,68 +18,109 @@ const (
 	customARMResourceEnvVar = "ARM_RESOURCE"
 )
 
-func AcquireARMToken(ctx context.Context, id azidentity.ManagedIDKind) (azcore.AccessToken, error) {
-	customARMResource := os.Getenv(customARMResourceEnvVar)
-	if customARMResource == "" {
-		customARMResource = defaultARMResource
-	}
+// ContainerRegistry is the cloud service for Azure Container Registry; when a cloud configures its audience, tokens
+// exchanged with registries are requested for it rather than for Resource Manager
+const ContainerRegistry cloud.ServiceName = "containerRegistry"
 
-	cred, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ID: id})
+func AcquireARMToken(ctx context.Context, id azidentity.ManagedIDKind) (azcore.AccessToken, error) {
+	cred, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions(identityLimiter, managedIdentityKey(id)), ID: id})
 	if err != nil {
 		return azcore.AccessToken{}, fmt.Errorf("failed to build managed identity credential: %w", err)
 	}
-	return cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{customARMResource}})
+	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{LegacyCloud().Services[cloud.ResourceManager].Audience}})
+	return token, classifyManagedIdentityError(err, id)
 }
 
-func ARMTokenForBinding(ctx context.Context, spec msiacrpullv1beta2.AcrPullBindingSpec, tenantId, clientId, serviceAccountToken string) (azcore.AccessToken, error) {
-	env := environment(spec.ACR.Environment, spec.ACR.CloudConfig)
+// FetchManagedIdentityToken authenticates as the managed identity in the request, by client ID if given or else by
+// resource ID, falling back to the system-assigned identity.
+func FetchManagedIdentityToken(ctx context.Context, request *CredentialRequest, _ string) (azcore.AccessToken, error) {
+	var id azidentity.ManagedIDKind
+	if request.ClientID != "" {
+		id = azidentity.ClientID(request.ClientID)
+	} else if request.ResourceID != "" {
+		id = azidentity.ResourceID(request.ResourceID)
+	}
+	credential, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions(identityLimiter, managedIdentityKey(id)), ID: id})
+	if err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to build credential: %w", err)
+	}
+	token, err := credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{exchangeScope(request.Cloud)}})
+	return token, classifyManagedIdentityError(err, id)
+}
 
-	var credential azcore.TokenCredential
-	var err error
-	switch {
-	case spec.Auth.ManagedIdentity != nil:
-		var id azidentity.ManagedIDKind
-		if spec.Auth.ManagedIdentity.ClientID != "" {
-			id = azidentity.ClientID(spec.Auth.ManagedIdentity.ClientID)
-		} else if spec.Auth.ManagedIdentity.ResourceID != "" {
-			id = azidentity.ResourceID(spec.Auth.ManagedIdentity.ResourceID)
-		}
-		credential, err = azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ID: id})
-	case spec.Auth.WorkloadIdentity != nil:
-		// n.b. the built-in azidentity.WorkloadIdentityCredential assumes we're loading a service account token
-		// from a file in a Pod, where the Kubernetes API server is rotating it, etc. Unfortunately that is not
-		// our use-case here, and we certainly don't want to centralize every service account token we ever mint
-		// in the filesystem of this controller, so we can use the lower-level client assertion credential instead.
-		credential, err = azidentity.NewClientAssertionCredential(tenantId, clientId, func(ctx context.Context) (string, error) {
-			return serviceAccountToken, nil
-		}, &azidentity.ClientAssertionCredentialOptions{
-			ClientOptions: azcore.ClientOptions{
-				Cloud: cloud.Configuration{
-					ActiveDirectoryAuthorityHost: env.ActiveDirectoryAuthorityHost,
-				},
-			},
-			DisableInstanceDiscovery: true,
-		})
+// FetchWorkloadIdentityToken authenticates as the application in the request, presenting the subject token as the
+// client assertion.
+func FetchWorkloadIdentityToken(ctx context.Context, request *CredentialRequest, subjectToken string) (azcore.AccessToken, error) {
+	// n.b. the built-in azidentity.WorkloadIdentityCredential assumes we're loading a service account token
+	// from a file in a Pod, where the Kubernetes API server is rotating it, etc. Unfortunately that is not
+	// our use-case here, and we certainly don't want to centralize every service account token we ever mint
+	// in the filesystem of this controller, so we can use the lower-level client assertion credential instead.
+	options := clientOptions(identityLimiter, request.TenantID+"/"+request.ClientID)
+	options.Cloud = cloud.Configuration{
+		ActiveDirectoryAuthorityHost: request.Cloud.ActiveDirectoryAuthorityHost,
 	}
+	credential, err := azidentity.NewClientAssertionCredential(request.TenantID, request.ClientID, func(ctx context.Context) (string, error) {
+		return subjectToken, nil
+	}, &azidentity.ClientAssertionCredentialOptions{
+		ClientOptions:            options,
+		DisableInstanceDiscovery: true,
+	})
 	if err != nil {
 		return azcore.AccessToken{}, fmt.Errorf("failed to build credential: %w", err)
 	}
-	if credential == nil {
-		// this should never happen with the validation we have on the CRD
-		panic(fmt.Errorf("programmer error: ACRPullBinding.Spec.Auth has no method: %#v", spec.Auth))
+	token, err := credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{exchangeScope(request.Cloud)}})
+	return token, classifyWorkloadIdentityError(err, request.TenantID, request.ClientID, subjectToken)
+}
+
+// exchangeScope is the scope of the token the registry exchanges, which must be for the registry itself if the cloud
+// configures its audience, or else for Resource Manager
+func exchangeScope(config cloud.Configuration) string {
+	if registry, ok := config.Services[ContainerRegistry]; ok && registry.Audience != "" {
+		return registry.Audience + "/.default"
+	}
+	return config.Services[cloud.ResourceManager].Audience + "/.default"
+}
+
+// managedIdentityKey identifies a managed identity to the rate limiter
+func managedIdentityKey(id azidentity.ManagedIDKind) string {
+	if id == nil {
+		return "system-assigned"
+	}
+	return id.String()
+}
+
+// LegacyCloud is the cloud v1beta1 pull bindings authenticate in, where Resource Manager is identified by the
+// $ARM_RESOURCE environment variable, defaulting to the public cloud.
+func LegacyCloud() cloud.Configuration {
+	armResource := os.Getenv(customARMResourceEnvVar)
+	if armResource == "" {
+		armResource = defaultARMResource
+	}
+	return cloud.Configuration{
+		ActiveDirectoryAuthorityHost: cloud.AzurePublic.ActiveDirectoryAuthorityHost,
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Audience: armResource,
+			},
+		},
 	}
-	return credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{env.Services[cloud.ResourceManager].Audience + "/.default"}})
 }
 
-func environment(input msiacrpullv1beta2.AzureEnvironmentType, config *msiacrpullv1beta2.AirgappedCloudConfiguration) cloud.Configuration {
+// CloudForEnvironment returns the cloud for an Azure environment, taking the endpoints of an air-gapped cloud from its
+// configuration. An unset environment is the public cloud.
+func CloudForEnvironment(input msiacrpullv1beta2.AzureEnvironmentType, config *msiacrpullv1beta2.AirgappedCloudConfiguration) (cloud.Configuration, error) {
 	switch input {
-	case msiacrpullv1beta2.AzureEnvironmentPublicCloud:
-		return cloud.AzurePublic
+	case "", msiacrpullv1beta2.AzureEnvironmentPublicCloud:
+		return cloud.AzurePublic, nil
 	case msiacrpullv1beta2.AzureEnvironmentUSGovernmentCloud:
-		return cloud.AzureGovernment
+		return cloud.AzureGovernment, nil
 	case msiacrpullv1beta2.AzureEnvironmentChinaCloud:
-		return cloud.AzureChina
+		return cloud.AzureChina, nil
 	case msiacrpullv1beta2.AzureEnvironmentAirgappedCloud:
+		// bindings stored before the cloud configuration was required for air-gapped clouds may not have one
+		if config == nil {
+			return cloud.Configuration{}, fmt.Errorf("environment %s requires a cloud configuration", input)
+		}
 		return cloud.Configuration{
 			ActiveDirectoryAuthorityHost: config.EntraAuthorityHost,
 			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
@@ -87,8 +128,24 @@ func environment(input msiacrpullv1beta2.AzureEnvironmentType, config *msiacrpul
 					Audience: config.ResourceManagerAudience,
 				},
 			},
-		}
+		}, nil
 	default:
-		panic(fmt.Errorf("unsupported msiacrpullv1beta2.AzureEnvironmentType: %s", input))
+		return cloud.Configuration{}, fmt.Errorf("unsupported environment %s", input)
+	}
+}
+
+// CloudForProfile returns the cloud described by an AzureCloudProfile.
+func CloudForProfile(spec msiacrpullv1beta2.AzureCloudProfileSpec) cloud.Configuration {
+	config := cloud.Configuration{
+		ActiveDirectoryAuthorityHost: spec.EntraAuthorityHost,
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Audience: spec.ResourceManagerAudience,
+			},
+		},
+	}
+	if spec.ACRAudience != "" {
+		config.Services[ContainerRegistry] = cloud.ServiceConfiguration{Audience: spec.ACRAudience}
 	}
+	return config
 }
@@ -0,0 +1,55 @@
+package authorizer
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Azure/msi-acrpull/internal/tracing"
+)
+
+// tracer records spans for the requests we make to Entra and ACR; spans are dropped unless a tracer provider is
+// registered globally
+var tracer = otel.Tracer("github.com/Azure/msi-acrpull/pkg/authorizer")
+
+// clientOptions configures the azcore HTTP pipeline to wait for the limiter before every attempt at a request, to
+// record a span for every attempt and to propagate the trace context to Entra and ACR, sending requests with the
+// configured transport
+func clientOptions(limiter *keyedLimiter, key string) azcore.ClientOptions {
+	return azcore.ClientOptions{
+		PerRetryPolicies: []policy.Policy{rateLimitPolicy{limiter: limiter, key: key}, tracingPolicy{}},
+		Transport:        currentTransport(),
+	}
+}
+
+type tracingPolicy struct{}
+
+func (tracingPolicy) Do(req *policy.Request) (*http.Response, error) {
+	raw := req.Raw()
+	ctx, span := tracer.Start(raw.Context(), fmt.Sprintf("HTTP %s", raw.Method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(raw.Method),
+			semconv.ServerAddress(raw.URL.Hostname()),
+			semconv.URLPath(raw.URL.Path),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(raw.Header))
+
+	resp, err := req.Next()
+	spanErr := err
+	if resp != nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		if err == nil && resp.StatusCode >= http.StatusBadRequest {
+			spanErr = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+	tracing.End(span, spanErr)
+	return resp, err
+}
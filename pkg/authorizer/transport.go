@@ -0,0 +1,178 @@
+package authorizer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"golang.org/x/net/http/httpproxy"
+	"k8s.io/utils/lru"
+)
+
+var (
+	transportLock sync.RWMutex
+	// transport sends every request we make to Entra, IMDS and ACR; nil selects the azcore default transport
+	transport policy.Transporter
+)
+
+// SetTransport configures the transport that sends requests to Entra, IMDS and ACR from now on, for instance to route
+// them to fake servers in tests. A nil transport restores the default.
+func SetTransport(t policy.Transporter) {
+	transportLock.Lock()
+	defer transportLock.Unlock()
+	transport = t
+}
+
+func currentTransport() policy.Transporter {
+	transportLock.RLock()
+	defer transportLock.RUnlock()
+	return transport
+}
+
+// HTTPTransport returns the transport requests to Entra, IMDS and ACR are sent with, for callers outside the azcore
+// pipeline.
+func HTTPTransport() policy.Transporter {
+	if t := currentTransport(); t != nil {
+		return t
+	}
+	return http.DefaultClient
+}
+
+// imdsHost is the link-local address of IMDS, which is only reachable from the node and never through a proxy
+const imdsHost = "169.254.169.254"
+
+// HTTPConfig configures how requests to Entra, IMDS and ACR leave the cluster.
+type HTTPConfig struct {
+	// ProxyURL is the proxy requests are sent through; if empty, the HTTPS_PROXY and HTTP_PROXY environment variables
+	// are honored
+	ProxyURL string
+	// NoProxy lists the hosts, domains and CIDRs reached without the proxy, in the format of NO_PROXY; if empty, the
+	// NO_PROXY environment variable is honored
+	NoProxy string
+	// CABundle holds PEM certificates to trust in addition to the system roots, such as that of a proxy intercepting
+	// TLS
+	CABundle []byte
+}
+
+// ConfigureHTTP sends requests to Entra, IMDS and ACR from now on through the proxy and trusting the certificates in
+// the configuration. Requests carrying a CA bundle in their context, added with WithCABundle, also trust that bundle.
+func ConfigureHTTP(config HTTPConfig) error {
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+		if !(proxyURL.Scheme == "http" || proxyURL.Scheme == "https" || proxyURL.Scheme == "socks5") || proxyURL.Host == "" {
+			return fmt.Errorf("proxy URL %s must be an http, https or socks5 URL", config.ProxyURL)
+		}
+	}
+	client, err := newHTTPClient(config, nil)
+	if err != nil {
+		return err
+	}
+	SetTransport(&caBundleTransport{
+		config:        config,
+		defaultClient: client,
+		clients: lru.NewWithEvictionFunc(maxCABundleClients, func(_ lru.Key, value interface{}) {
+			value.(*http.Client).CloseIdleConnections()
+		}),
+	})
+	return nil
+}
+
+// maxCABundleClients bounds the clients kept for CA bundles carried by requests, as bundles are read from objects that
+// may be edited or rotated at any time, and there is no end to the bundles we may see over the life of the process
+const maxCABundleClients = 32
+
+type caBundleKey struct{}
+
+// WithCABundle returns a context whose requests to Entra and ACR trust the PEM certificates in the bundle, in addition
+// to those configured with ConfigureHTTP. Bundles are only honored once ConfigureHTTP has been called.
+func WithCABundle(ctx context.Context, caBundle []byte) context.Context {
+	if len(caBundle) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, caBundleKey{}, caBundle)
+}
+
+// caBundleTransport sends requests with a client built from its configuration and the CA bundle in their context
+type caBundleTransport struct {
+	config HTTPConfig
+	// defaultClient sends requests without a CA bundle in their context
+	defaultClient *http.Client
+
+	lock sync.Mutex
+	// clients holds the clients built for the CA bundles seen most recently, so that connections are reused across
+	// requests; the idle connections of evicted clients are closed
+	clients *lru.Cache
+}
+
+func (t *caBundleTransport) Do(req *http.Request) (*http.Response, error) {
+	caBundle, _ := req.Context().Value(caBundleKey{}).([]byte)
+	client, err := t.clientFor(caBundle)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+func (t *caBundleTransport) clientFor(caBundle []byte) (*http.Client, error) {
+	if len(caBundle) == 0 {
+		return t.defaultClient, nil
+	}
+	// we hold the lock while building the client so that no two are built for a bundle, as the cache would drop the
+	// first without evicting it
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if client, cached := t.clients.Get(string(caBundle)); cached {
+		return client.(*http.Client), nil
+	}
+	client, err := newHTTPClient(t.config, caBundle)
+	if err != nil {
+		return nil, err
+	}
+	t.clients.Add(string(caBundle), client)
+	return client, nil
+}
+
+// newHTTPClient builds a client sending requests through the configured proxy, trusting the system roots along with
+// the configured CA bundle and the extra one
+func newHTTPClient(config HTTPConfig, extraCABundle []byte) (*http.Client, error) {
+	proxy := httpproxy.FromEnvironment()
+	if config.ProxyURL != "" {
+		proxy.HTTPProxy, proxy.HTTPSProxy = config.ProxyURL, config.ProxyURL
+	}
+	if config.NoProxy != "" {
+		proxy.NoProxy = config.NoProxy
+	}
+	if proxy.NoProxy == "" {
+		proxy.NoProxy = imdsHost
+	} else {
+		proxy.NoProxy += "," + imdsHost
+	}
+	proxyFunc := proxy.ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	if len(config.CABundle) > 0 || len(extraCABundle) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		for _, caBundle := range [][]byte{config.CABundle, extraCABundle} {
+			if len(caBundle) > 0 && !roots.AppendCertsFromPEM(caBundle) {
+				return nil, errors.New("the CA bundle holds no PEM certificates")
+			}
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return &http.Client{Transport: transport}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 const (
@@ -23,19 +24,52 @@ type auth struct {
 	Auth     string `json:"auth"`
 }
 
-// CreateACRDockerCfg creates an ACR docker config using given access token.
-func CreateACRDockerCfg(acrFQDN string, accessToken azcore.AccessToken) (string, error) {
+// CreateACRDockerCfg creates an ACR docker config using given access token, holding the credential for the registry
+// and for any additional hosts that front it.
+func CreateACRDockerCfg(acrFQDN string, accessToken azcore.AccessToken, additionalHosts ...string) (string, error) {
+	entry := auth{
+		Username: acrUsername,
+		Password: accessToken.Token,
+		Email:    "msi-acrpull@azurecr.io",
+		Auth:     base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", acrUsername, accessToken.Token))),
+	}
 	cfg := dockercfg{
 		Auths: map[string]auth{
-			acrFQDN: {
-				Username: acrUsername,
-				Password: accessToken.Token,
-				Email:    "msi-acrpull@azurecr.io",
-				Auth:     base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", acrUsername, accessToken.Token))),
-			},
+			acrFQDN: entry,
 		},
 	}
+	for _, host := range additionalHosts {
+		cfg.Auths[host] = entry
+	}
 
 	encoded, err := json.Marshal(cfg)
 	return string(encoded), err
 }
+
+// ACRTokenFromDockerCfg reads the access token for the registry back out of an ACR docker config.
+func ACRTokenFromDockerCfg(acrFQDN, dockerConfig string) (azcore.AccessToken, error) {
+	var cfg dockercfg
+	if err := json.Unmarshal([]byte(dockerConfig), &cfg); err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to parse docker config: %w", err)
+	}
+	entry, ok := cfg.Auths[acrFQDN]
+	if !ok || entry.Password == "" {
+		return azcore.AccessToken{}, fmt.Errorf("docker config holds no credential for %s", acrFQDN)
+	}
+	return azcore.AccessToken{Token: entry.Password}, nil
+}
+
+// TokenID returns the unverified jti claim of a JWT, or an empty string if the token has none. This must only be used
+// for informational purposes, such as auditing.
+func TokenID(token string) string {
+	parsed, _, err := jwt.NewParser(jwt.WithoutClaimsValidation()).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	id, _ := claims["jti"].(string)
+	return id
+}
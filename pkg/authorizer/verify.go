@@ -0,0 +1,131 @@
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+)
+
+var (
+	// ErrVerificationFailed means the registry did not accept a token it issued
+	ErrVerificationFailed = errors.New("credential verification failed")
+	// ErrManifestNotFound means the manifest fetched to verify a token does not exist
+	ErrManifestNotFound = errors.New("manifest not found")
+)
+
+// manifestAccept lists the manifest media types we accept when fetching the headers of a manifest, as registries
+// respond 404 to requests for manifests they cannot serve as any of the types accepted
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// RegistryVerifier checks that a registry accepts an access token it issued before the token is put to use.
+type RegistryVerifier struct {
+	// Transport sends requests to the registry, defaulting to the transport set with SetTransport
+	Transport policy.Transporter
+}
+
+// DefaultRegistryVerifier verifies tokens with the default transport
+var DefaultRegistryVerifier = &RegistryVerifier{}
+
+// Verify presents the access token to the registry, given by its FQDN or, when it is not served over HTTPS on the
+// default port, by the base URL of its API. When a manifest is given, as <repository>:<tag> or
+// <repository>@<digest>, the headers of the manifest are fetched, proving the token grants pull access to the
+// repository; otherwise, the registry's /v2/ endpoint is called, proving the registry accepts the token at all.
+func (v *RegistryVerifier) Verify(ctx context.Context, registry string, token azcore.AccessToken, manifest string) error {
+	endpoint, acrFQDN := "https://"+registry, registry
+	if scheme, host, found := strings.Cut(registry, "://"); found && (scheme == "http" || scheme == "https") {
+		endpoint, acrFQDN = registry, host
+	}
+
+	method, path := http.MethodGet, "/v2/"
+	if manifest != "" {
+		repository, reference, err := splitManifest(manifest)
+		if err != nil {
+			return err
+		}
+		method, path = http.MethodHead, fmt.Sprintf("/v2/%s/manifests/%s", repository, reference)
+	}
+
+	options := clientOptions(registryLimiter, acrFQDN)
+	if v.Transport != nil {
+		options.Transport = v.Transport
+	}
+	// failures are retried by re-queueing the binding, so we do not hold up reconciliation with retries here
+	options.Retry.MaxRetries = -1
+	pipeline := runtime.NewPipeline("acrpull", "v1", runtime.PipelineOptions{}, &options)
+
+	req, err := runtime.NewRequest(ctx, method, endpoint+path)
+	if err != nil {
+		return fmt.Errorf("failed to create verification request: %w", err)
+	}
+	req.Raw().Header.Set("Authorization", "Bearer "+token.Token)
+	if manifest != "" {
+		req.Raw().Header.Set("Accept", manifestAccept)
+	}
+	resp, err := pipeline.Do(req)
+	if err != nil {
+		return classifyVerificationError(err, acrFQDN, manifest)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return classifyVerificationError(runtime.NewResponseError(resp), acrFQDN, manifest)
+	}
+	return nil
+}
+
+// VerifyForSpec verifies an access token issued for a v1beta2 pull binding
+func (v *RegistryVerifier) VerifyForSpec(ctx context.Context, token azcore.AccessToken, spec msiacrpullv1beta2.AcrConfiguration) error {
+	_, endpoint := RegistryForSpec(spec)
+	return v.Verify(ctx, endpoint, token, spec.VerificationManifest)
+}
+
+// splitManifest splits a manifest reference like repository:tag or repository@sha256:digest
+func splitManifest(manifest string) (string, string, error) {
+	if index := strings.Index(manifest, "@"); index > 0 {
+		return manifest[:index], manifest[index+1:], nil
+	}
+	if index := strings.LastIndex(manifest, ":"); index > 0 && !strings.Contains(manifest[index:], "/") {
+		return manifest[:index], manifest[index+1:], nil
+	}
+	return "", "", fmt.Errorf("manifest %q must name a tag or digest, as <repository>:<tag> or <repository>@<digest>", manifest)
+}
+
+// classifyVerificationError classifies a failure to verify a token; throttling and transient failures are retried as
+// usual, while a refusal from the registry means the token is not fit for use
+func classifyVerificationError(err error, acrFQDN, manifest string) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return &Error{Kind: ErrRegistryNotFound, Hint: fmt.Sprintf("Check the registry server %s.", acrFQDN), Err: err}
+	}
+	if kind := classifyTransport(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	var respErr *azcore.ResponseError
+	if manifest != "" && errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return &Error{Kind: ErrManifestNotFound, Hint: fmt.Sprintf("Check that the manifest %s exists in %s.", manifest, acrFQDN), Err: err}
+	}
+	target := fmt.Sprintf("the registry %s", acrFQDN)
+	if manifest != "" {
+		target = fmt.Sprintf("the manifest %s in %s", manifest, acrFQDN)
+	}
+	return &Error{
+		Kind: ErrVerificationFailed,
+		Hint: fmt.Sprintf("Check that the identity may pull from %s, and that the scope includes it.", target),
+		Err:  err,
+	}
+}
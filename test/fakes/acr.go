@@ -0,0 +1,266 @@
+package fakes
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ACR stands in for an Azure Container Registry, exchanging tokens from Entra or IMDS for registry refresh tokens at
+// /oauth2/exchange, refresh tokens for scoped access tokens at /oauth2/token, and serving the headers of the manifests
+// pushed to it to clients presenting an access token with pull access. Like a connected registry, it also issues access
+// tokens at /oauth2/token to clients authenticating with the name and password of a client token.
+type ACR struct {
+	*httptest.Server
+
+	issuer *Issuer
+
+	lock sync.Mutex
+	// grants holds the actions each client ID may take on each repository, or on every repository under "*"
+	grants map[string]map[string][]string
+	// manifests holds the references pushed to each repository
+	manifests map[string][]string
+	// clientTokens holds the password of each client token by name
+	clientTokens map[string]string
+}
+
+// NewACR starts a fake registry accepting tokens signed by the issuer and signing the tokens it issues with it
+func NewACR(issuer *Issuer) *ACR {
+	acr := &ACR{issuer: issuer, grants: map[string]map[string][]string{}, manifests: map[string][]string{}, clientTokens: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth2/exchange", acr.serveExchange)
+	mux.HandleFunc("POST /oauth2/token", acr.serveToken)
+	mux.HandleFunc("GET /oauth2/token", acr.serveClientToken)
+	mux.HandleFunc("/v2/", acr.serveRegistry)
+	acr.Server = httptest.NewTLSServer(mux)
+	return acr
+}
+
+// Grant allows the identity with the client ID to take the actions on the repository, or on every repository if the
+// repository is "*", like a role assignment on the registry would
+func (a *ACR) Grant(clientID, repository string, actions ...string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.grants[clientID] == nil {
+		a.grants[clientID] = map[string][]string{}
+	}
+	a.grants[clientID][repository] = append(a.grants[clientID][repository], actions...)
+}
+
+// Revoke removes every grant for the identity with the client ID
+func (a *ACR) Revoke(clientID string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.grants, clientID)
+}
+
+// AddClientToken creates a client token with the name and password; the actions the token may take are granted to the
+// token name
+func (a *ACR) AddClientToken(name, password string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.clientTokens[name] = password
+}
+
+// Push records a manifest with the reference in the repository
+func (a *ACR) Push(repository, reference string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.manifests[repository] = append(a.manifests[repository], reference)
+}
+
+// accessEntry is an entry in the access claim of a registry access token
+type accessEntry struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+// granted determines which of the actions requested on the repository the identity may take
+func (a *ACR) granted(clientID, repository string, requested []string) []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	allowed := append(slices.Clone(a.grants[clientID][repository]), a.grants[clientID]["*"]...)
+	if slices.Contains(allowed, "*") {
+		return requested
+	}
+	return slices.DeleteFunc(slices.Clone(requested), func(action string) bool {
+		return !slices.Contains(allowed, action)
+	})
+}
+
+func (a *ACR) authorized(clientID string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return len(a.grants[clientID]) > 0
+}
+
+// service is the name of the registry a request was sent to
+func service(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+	return host
+}
+
+func (a *ACR) serveExchange(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeRegistryError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "access_token" || r.PostForm.Get("service") != service(r) {
+		writeRegistryError(w, http.StatusBadRequest, "BAD_REQUEST", "unsupported grant type or service")
+		return
+	}
+	claims, err := a.issuer.Validate(r.PostForm.Get("access_token"))
+	if err != nil {
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", fmt.Sprintf("invalid access token: %v", err))
+		return
+	}
+	clientID, _ := claims["appid"].(string)
+	if !a.authorized(clientID) {
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", fmt.Sprintf("identity %s is not authorized to access the registry", clientID))
+		return
+	}
+	token, _, err := a.issuer.Issue(jwt.MapClaims{
+		"iss":        "Azure Container Registry",
+		"aud":        service(r),
+		"sub":        clientID,
+		"grant_type": "refresh_token",
+		"tenant":     claims["tid"],
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"refresh_token": token})
+}
+
+func (a *ACR) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeRegistryError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("service") != service(r) {
+		writeRegistryError(w, http.StatusBadRequest, "BAD_REQUEST", "unsupported grant type or service")
+		return
+	}
+	claims, err := a.issuer.Validate(r.PostForm.Get("refresh_token"))
+	if err != nil || claims["grant_type"] != "refresh_token" || claims["aud"] != service(r) {
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid refresh token")
+		return
+	}
+	clientID, _ := claims.GetSubject()
+	a.issueAccessToken(w, r, clientID, r.PostForm.Get("scope"))
+}
+
+func (a *ACR) serveClientToken(w http.ResponseWriter, r *http.Request) {
+	name, password, ok := r.BasicAuth()
+	a.lock.Lock()
+	expected, known := a.clientTokens[name]
+	a.lock.Unlock()
+	if !ok || !known || password != expected {
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid client token")
+		return
+	}
+	if r.URL.Query().Get("service") != service(r) {
+		writeRegistryError(w, http.StatusBadRequest, "BAD_REQUEST", "unsupported service")
+		return
+	}
+	a.issueAccessToken(w, r, name, r.URL.Query().Get("scope"))
+}
+
+// issueAccessToken responds with an access token for the subject, holding the actions it may take of those requested in
+// the scopes
+func (a *ACR) issueAccessToken(w http.ResponseWriter, r *http.Request, subject, scopes string) {
+	access := []accessEntry{}
+	for _, scope := range strings.Fields(scopes) {
+		first, last := strings.Index(scope, ":"), strings.LastIndex(scope, ":")
+		if first < 0 || first == last {
+			writeRegistryError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("invalid scope %q", scope))
+			return
+		}
+		entry := accessEntry{Type: scope[:first], Name: scope[first+1 : last], Actions: []string{}}
+		if entry.Type == "repository" {
+			entry.Actions = a.granted(subject, entry.Name, strings.Split(scope[last+1:], ","))
+		}
+		access = append(access, entry)
+	}
+	token, _, err := a.issuer.Issue(jwt.MapClaims{
+		"iss":    "Azure Container Registry",
+		"aud":    service(r),
+		"sub":    subject,
+		"access": access,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": token})
+}
+
+func (a *ACR) serveRegistry(w http.ResponseWriter, r *http.Request) {
+	claims, err := a.issuer.Validate(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if err != nil || claims["aud"] != service(r) {
+		a.challenge(w, r)
+		return
+	}
+	if r.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	index := strings.LastIndex(path, "/manifests/")
+	if index <= 0 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "not found")
+		return
+	}
+	repository, reference := path[:index], path[index+len("/manifests/"):]
+	if !pullAllowed(claims, repository) {
+		a.challenge(w, r)
+		return
+	}
+	a.lock.Lock()
+	pushed := slices.Contains(a.manifests[repository], reference)
+	a.lock.Unlock()
+	if !pushed {
+		writeRegistryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest tagged by %q is not found", reference))
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+	w.WriteHeader(http.StatusOK)
+}
+
+// pullAllowed determines if the access claim of a token allows pulling from the repository
+func pullAllowed(claims jwt.MapClaims, repository string) bool {
+	access, _ := claims["access"].([]interface{})
+	for _, raw := range access {
+		entry, _ := raw.(map[string]interface{})
+		if entry["type"] != "repository" || entry["name"] != repository {
+			continue
+		}
+		actions, _ := entry["actions"].([]interface{})
+		if slices.Contains(actions, interface{}("pull")) || slices.Contains(actions, interface{}("*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ACR) challenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/oauth2/token",service="%s"`, r.Host, service(r)))
+	writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+}
+
+// writeRegistryError responds with an error in the format of the distribution API
+func writeRegistryError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string][]map[string]string{"errors": {{"code": code, "message": message}}})
+}
@@ -0,0 +1,33 @@
+package fakes
+
+// Cloud bundles a fake IMDS, Entra and registry sharing an issuer, along with a transport routing requests to them.
+type Cloud struct {
+	Issuer    *Issuer
+	IMDS      *IMDS
+	Entra     *Entra
+	ACR       *ACR
+	Transport *Transport
+}
+
+// NewCloud starts the fake services of a cloud, with the registry served at the registry host
+func NewCloud(registry string) *Cloud {
+	issuer := NewIssuer()
+	cloud := &Cloud{
+		Issuer:    issuer,
+		IMDS:      NewIMDS(issuer),
+		Entra:     NewEntra(issuer),
+		ACR:       NewACR(issuer),
+		Transport: NewTransport(),
+	}
+	cloud.Transport.Route(IMDSHost, cloud.IMDS.Server)
+	cloud.Transport.Route(EntraHost, cloud.Entra.Server)
+	cloud.Transport.Route(registry, cloud.ACR.Server)
+	return cloud
+}
+
+// Close shuts down the fake services
+func (c *Cloud) Close() {
+	c.IMDS.Close()
+	c.Entra.Close()
+	c.ACR.Close()
+}
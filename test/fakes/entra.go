@@ -0,0 +1,149 @@
+package fakes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EntraHost is the authority host of Entra in the public cloud
+const EntraHost = "login.microsoftonline.com"
+
+const (
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// defaultFederationAudience is the audience Entra expects of federated tokens unless configured otherwise
+	defaultFederationAudience = "api://AzureADTokenExchange"
+)
+
+// FederatedIdentity is an identity in Entra with a federated identity credential, which Entra will issue tokens for in
+// exchange for a token from the issuer with the subject.
+type FederatedIdentity struct {
+	TenantID    string
+	ClientID    string
+	PrincipalID string
+	// Issuer is the issuer federated tokens must come from; any issuer is trusted if unset
+	Issuer string
+	// Subject is the subject federated tokens must have
+	Subject string
+	// Audience is the audience federated tokens must have, defaulting to api://AzureADTokenExchange
+	Audience string
+}
+
+// Entra stands in for the token endpoints of Entra, issuing tokens for federated identities in exchange for client
+// assertions.
+type Entra struct {
+	*httptest.Server
+
+	issuer *Issuer
+
+	lock       sync.Mutex
+	identities []FederatedIdentity
+}
+
+// NewEntra starts a fake Entra serving tokens for the identities, signed by the issuer
+func NewEntra(issuer *Issuer, identities ...FederatedIdentity) *Entra {
+	entra := &Entra{issuer: issuer, identities: identities}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{tenant}/v2.0/.well-known/openid-configuration", entra.serveDiscovery)
+	mux.HandleFunc("POST /{tenant}/oauth2/v2.0/token", entra.serveToken)
+	entra.Server = httptest.NewTLSServer(mux)
+	return entra
+}
+
+// Federate adds another federated identity
+func (e *Entra) Federate(identity FederatedIdentity) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.identities = append(e.identities, identity)
+}
+
+func (e *Entra) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	authority := fmt.Sprintf("https://%s/%s", r.Host, r.PathValue("tenant"))
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 authority + "/v2.0",
+		"authorization_endpoint": authority + "/oauth2/v2.0/authorize",
+		"token_endpoint":         authority + "/oauth2/v2.0/token",
+	})
+}
+
+func (e *Entra) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_assertion_type") != clientAssertionType {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "AADSTS70003: The app requested an unsupported grant type.")
+		return
+	}
+	tenantID, clientID := r.PathValue("tenant"), r.PostForm.Get("client_id")
+
+	identity, status, code, description := e.authenticate(tenantID, clientID, r.PostForm.Get("client_assertion"))
+	if code != "" {
+		writeOAuthError(w, status, code, description)
+		return
+	}
+	audience := strings.TrimSuffix(r.PostForm.Get("scope"), "/.default")
+	token, _, err := e.issuer.Issue(jwt.MapClaims{
+		"aud":   audience,
+		"iss":   "https://sts.windows.net/" + identity.TenantID + "/",
+		"tid":   identity.TenantID,
+		"oid":   identity.PrincipalID,
+		"appid": identity.ClientID,
+		"sub":   identity.PrincipalID,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	lifetime := int(e.issuer.Lifetime.Seconds())
+	writeJSON(w, http.StatusOK, map[string]any{
+		"token_type":     "Bearer",
+		"expires_in":     lifetime,
+		"ext_expires_in": lifetime,
+		"access_token":   token,
+	})
+}
+
+// authenticate finds the identity a client assertion authenticates as, or the error Entra responds with if none does
+func (e *Entra) authenticate(tenantID, clientID, assertion string) (FederatedIdentity, int, string, string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !slices.ContainsFunc(e.identities, func(identity FederatedIdentity) bool {
+		return identity.TenantID == tenantID
+	}) {
+		return FederatedIdentity{}, http.StatusBadRequest, "invalid_request", fmt.Sprintf("AADSTS90002: Tenant '%s' not found.", tenantID)
+	}
+	candidates := slices.DeleteFunc(slices.Clone(e.identities), func(identity FederatedIdentity) bool {
+		return identity.TenantID != tenantID || identity.ClientID != clientID
+	})
+	if len(candidates) == 0 {
+		return FederatedIdentity{}, http.StatusBadRequest, "unauthorized_client", fmt.Sprintf("AADSTS700016: Application with identifier '%s' was not found in the directory '%s'.", clientID, tenantID)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+		return FederatedIdentity{}, http.StatusBadRequest, "invalid_client", "AADSTS700211: No matching federated identity record found for presented assertion issuer."
+	}
+	if expiry, err := claims.GetExpirationTime(); err != nil || expiry == nil || expiry.Before(time.Now()) {
+		return FederatedIdentity{}, http.StatusBadRequest, "invalid_client", "AADSTS700024: Client assertion is not within its valid time range."
+	}
+	issuer, _ := claims.GetIssuer()
+	subject, _ := claims.GetSubject()
+	audiences, _ := claims.GetAudience()
+	for _, candidate := range candidates {
+		audience := candidate.Audience
+		if audience == "" {
+			audience = defaultFederationAudience
+		}
+		if (candidate.Issuer == "" || candidate.Issuer == issuer) && candidate.Subject == subject && slices.Contains(audiences, audience) {
+			return candidate, 0, "", ""
+		}
+	}
+	return FederatedIdentity{}, http.StatusBadRequest, "invalid_client", fmt.Sprintf("AADSTS70021: No matching federated identity record found for presented assertion. Assertion Issuer: '%s'. Assertion Subject: '%s'.", issuer, subject)
+}
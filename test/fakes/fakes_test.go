@@ -0,0 +1,359 @@
+package fakes_test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+	"github.com/Azure/msi-acrpull/test/fakes"
+)
+
+const registry = "fake.azurecr.io"
+
+func TestAuthorizer(t *testing.T) {
+	cloud := fakes.NewCloud(registry)
+	defer cloud.Close()
+	authorizer.SetTransport(cloud.Transport)
+	defer authorizer.SetTransport(nil)
+
+	cloud.IMDS.Assign(fakes.ManagedIdentity{ClientID: "puller", ResourceID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/puller", PrincipalID: "puller-principal", TenantID: "tenant"})
+	cloud.IMDS.Assign(fakes.ManagedIdentity{ClientID: "stranger", PrincipalID: "stranger-principal", TenantID: "tenant"})
+	cloud.Entra.Federate(fakes.FederatedIdentity{TenantID: "tenant", ClientID: "federated", PrincipalID: "federated-principal", Subject: "system:serviceaccount:ns:sa"})
+	cloud.ACR.Grant("puller", "alice", "pull")
+	cloud.ACR.Grant("federated", "*", "pull")
+	cloud.ACR.Push("alice", "latest")
+
+	serviceAccountToken := func(subject string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss": "https://oidc.example.com",
+			"sub": subject,
+			"aud": []string{"api://AzureADTokenExchange"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte("service-account-key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for _, testCase := range []struct {
+		name                string
+		auth                msiacrpullv1beta2.AuthenticationMethod
+		tenantID, clientID  string
+		serviceAccountToken string
+		scope               string
+		wantErr             error
+		wantGranted         string
+		wantVerifyErr       error
+	}{
+		{
+			name:        "managed identity by client ID",
+			auth:        msiacrpullv1beta2.AuthenticationMethod{ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "puller"}},
+			scope:       "repository:alice:pull",
+			wantGranted: "repository:alice:pull",
+		},
+		{
+			name:        "managed identity by resource ID",
+			auth:        msiacrpullv1beta2.AuthenticationMethod{ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ResourceID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/puller"}},
+			scope:       "repository:alice:pull",
+			wantGranted: "repository:alice:pull",
+		},
+		{
+			name:        "registry drops actions the identity may not take",
+			auth:        msiacrpullv1beta2.AuthenticationMethod{ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "puller"}},
+			scope:       "repository:alice:pull,push repository:bob:pull",
+			wantGranted: "repository:alice:pull repository:bob:",
+		},
+		{
+			name:          "registry refuses tokens without access to the verified manifest",
+			auth:          msiacrpullv1beta2.AuthenticationMethod{ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "puller"}},
+			scope:         "repository:bob:pull",
+			wantGranted:   "repository:bob:",
+			wantVerifyErr: authorizer.ErrVerificationFailed,
+		},
+		{
+			name:    "managed identity not assigned to the node",
+			auth:    msiacrpullv1beta2.AuthenticationMethod{ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "missing"}},
+			scope:   "repository:alice:pull",
+			wantErr: authorizer.ErrIdentityNotFound,
+		},
+		{
+			name:    "managed identity without access to the registry",
+			auth:    msiacrpullv1beta2.AuthenticationMethod{ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "stranger"}},
+			scope:   "repository:alice:pull",
+			wantErr: authorizer.ErrRegistryUnauthorized,
+		},
+		{
+			name:                "workload identity",
+			auth:                msiacrpullv1beta2.AuthenticationMethod{WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{ServiceAccountName: "sa"}},
+			tenantID:            "tenant",
+			clientID:            "federated",
+			serviceAccountToken: serviceAccountToken("system:serviceaccount:ns:sa"),
+			scope:               "repository:alice:pull",
+			wantGranted:         "repository:alice:pull",
+		},
+		{
+			name:                "workload identity without a matching federated credential",
+			auth:                msiacrpullv1beta2.AuthenticationMethod{WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{ServiceAccountName: "other"}},
+			tenantID:            "tenant",
+			clientID:            "federated",
+			serviceAccountToken: serviceAccountToken("system:serviceaccount:ns:other"),
+			scope:               "repository:alice:pull",
+			wantErr:             authorizer.ErrFederationMismatch,
+		},
+		{
+			name:                "workload identity in an unknown tenant",
+			auth:                msiacrpullv1beta2.AuthenticationMethod{WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{ServiceAccountName: "sa"}},
+			tenantID:            "elsewhere",
+			clientID:            "federated",
+			serviceAccountToken: serviceAccountToken("system:serviceaccount:ns:sa"),
+			scope:               "repository:alice:pull",
+			wantErr:             authorizer.ErrIdentityNotFound,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			spec := msiacrpullv1beta2.AcrConfiguration{
+				Server:               registry,
+				Scope:                testCase.scope,
+				Environment:          msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+				VerificationManifest: "alice:latest",
+			}
+
+			environment, err := authorizer.CloudForEnvironment(spec.Environment, spec.CloudConfig)
+			if err != nil {
+				t.Fatalf("failed to determine cloud: %v", err)
+			}
+			request := &authorizer.CredentialRequest{
+				Cloud:    environment,
+				Registry: spec.Server,
+				Scope:    spec.Scope,
+			}
+			if testCase.auth.ManagedIdentity != nil {
+				request.Method = authorizer.AuthMethodManagedIdentity
+				request.ClientID = testCase.auth.ManagedIdentity.ClientID
+				request.ResourceID = testCase.auth.ManagedIdentity.ResourceID
+			} else {
+				request.Method = authorizer.AuthMethodWorkloadIdentity
+				request.TenantID, request.ClientID = testCase.tenantID, testCase.clientID
+				request.SubjectToken = func(context.Context) (string, error) {
+					return testCase.serviceAccountToken, nil
+				}
+			}
+
+			credential, err := authorizer.NewProvider().Credential(ctx, request)
+			if testCase.wantErr != nil {
+				if !errors.Is(err, testCase.wantErr) {
+					t.Fatalf("expected error %v, got %v", testCase.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to acquire token: %v", err)
+			}
+			if credential.Token.ExpiresOn.Before(time.Now()) {
+				t.Errorf("expected an unexpired token, got one expiring at %s", credential.Token.ExpiresOn)
+			}
+			if credential.GrantedScope == nil || *credential.GrantedScope != testCase.wantGranted {
+				t.Errorf("expected granted scope %q, got %v", testCase.wantGranted, credential.GrantedScope)
+			}
+
+			err = authorizer.DefaultRegistryVerifier.VerifyForSpec(ctx, credential.Token, spec)
+			if testCase.wantVerifyErr == nil && err != nil {
+				t.Errorf("failed to verify token: %v", err)
+			}
+			if testCase.wantVerifyErr != nil && !errors.Is(err, testCase.wantVerifyErr) {
+				t.Errorf("expected verification error %v, got %v", testCase.wantVerifyErr, err)
+			}
+		})
+	}
+}
+
+func TestConnectedRegistry(t *testing.T) {
+	const connected = "connected.contoso.com"
+	cloud := fakes.NewCloud(connected)
+	defer cloud.Close()
+	authorizer.SetTransport(cloud.Transport)
+	defer authorizer.SetTransport(nil)
+
+	cloud.ACR.AddClientToken("puller", "secret")
+	cloud.ACR.Grant("puller", "alice", "pull")
+	cloud.ACR.Push("alice", "latest")
+
+	for _, testCase := range []struct {
+		name          string
+		password      string
+		port          int32
+		authEndpoint  string
+		scope         string
+		wantErr       error
+		wantGranted   string
+		wantVerifyErr error
+	}{
+		{
+			name:        "client token",
+			password:    "secret",
+			scope:       "repository:alice:pull",
+			wantGranted: "repository:alice:pull",
+		},
+		{
+			name:        "client token for a registry on another port",
+			password:    "secret",
+			port:        8443,
+			scope:       "repository:alice:pull",
+			wantGranted: "repository:alice:pull",
+		},
+		{
+			name:         "client token exchanged at a separate auth endpoint",
+			password:     "secret",
+			authEndpoint: "https://" + connected + ":9443",
+			scope:        "repository:alice:pull",
+			wantGranted:  "repository:alice:pull",
+		},
+		{
+			name:          "registry refuses tokens without access to the verified manifest",
+			password:      "secret",
+			scope:         "repository:bob:pull",
+			wantGranted:   "repository:bob:",
+			wantVerifyErr: authorizer.ErrVerificationFailed,
+		},
+		{
+			name:     "wrong client token password",
+			password: "guess",
+			scope:    "repository:alice:pull",
+			wantErr:  authorizer.ErrRegistryUnauthorized,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			spec := msiacrpullv1beta2.AcrConfiguration{
+				Server:               connected,
+				Scope:                testCase.scope,
+				Environment:          msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+				VerificationManifest: "alice:latest",
+				AuthEndpoint:         testCase.authEndpoint,
+				ConnectedRegistry:    &msiacrpullv1beta2.ConnectedRegistryConfiguration{Port: testCase.port},
+			}
+
+			host, endpoint := authorizer.RegistryForSpec(spec)
+			credential, err := authorizer.NewProvider().Credential(ctx, &authorizer.CredentialRequest{
+				Method:    authorizer.AuthMethodClientToken,
+				TokenName: "puller",
+				SubjectToken: func(context.Context) (string, error) {
+					return testCase.password, nil
+				},
+				RegistryType: authorizer.RegistryTypeConnectedRegistry,
+				Registry:     host,
+				Endpoint:     endpoint,
+				AuthEndpoint: spec.AuthEndpoint,
+				Scope:        spec.Scope,
+			})
+			if testCase.wantErr != nil {
+				if !errors.Is(err, testCase.wantErr) {
+					t.Fatalf("expected error %v, got %v", testCase.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to acquire token: %v", err)
+			}
+			if credential.GrantedScope == nil || *credential.GrantedScope != testCase.wantGranted {
+				t.Errorf("expected granted scope %q, got %v", testCase.wantGranted, credential.GrantedScope)
+			}
+
+			err = authorizer.DefaultRegistryVerifier.VerifyForSpec(ctx, credential.Token, spec)
+			if testCase.wantVerifyErr == nil && err != nil {
+				t.Errorf("failed to verify token: %v", err)
+			}
+			if testCase.wantVerifyErr != nil && !errors.Is(err, testCase.wantVerifyErr) {
+				t.Errorf("expected verification error %v, got %v", testCase.wantVerifyErr, err)
+			}
+		})
+	}
+}
+
+func TestHTTPConfig(t *testing.T) {
+	defer authorizer.SetTransport(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	t.Run("CA bundles are trusted", func(t *testing.T) {
+		issuer := fakes.NewIssuer()
+		acr := fakes.NewACR(issuer)
+		defer acr.Close()
+		server, err := url.Parse(acr.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, expiresOn, err := issuer.Issue(jwt.MapClaims{"aud": server.Hostname()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessToken := azcore.AccessToken{Token: token, ExpiresOn: expiresOn}
+		caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: acr.Certificate().Raw})
+
+		if err := authorizer.ConfigureHTTP(authorizer.HTTPConfig{}); err != nil {
+			t.Fatalf("failed to configure HTTP: %v", err)
+		}
+		if err := authorizer.DefaultRegistryVerifier.Verify(ctx, acr.URL, accessToken, ""); err == nil {
+			t.Errorf("expected the registry's certificate to be untrusted without a CA bundle")
+		}
+		if err := authorizer.DefaultRegistryVerifier.Verify(authorizer.WithCABundle(ctx, caBundle), acr.URL, accessToken, ""); err != nil {
+			t.Errorf("failed to verify token trusting the CA bundle in the context: %v", err)
+		}
+
+		if err := authorizer.ConfigureHTTP(authorizer.HTTPConfig{CABundle: caBundle}); err != nil {
+			t.Fatalf("failed to configure HTTP: %v", err)
+		}
+		if err := authorizer.DefaultRegistryVerifier.Verify(ctx, acr.URL, accessToken, ""); err != nil {
+			t.Errorf("failed to verify token trusting the configured CA bundle: %v", err)
+		}
+	})
+
+	t.Run("requests are sent through the proxy", func(t *testing.T) {
+		var lock sync.Mutex
+		var proxied []string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			proxied = append(proxied, r.URL.String())
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer proxy.Close()
+
+		if err := authorizer.ConfigureHTTP(authorizer.HTTPConfig{ProxyURL: proxy.URL, NoProxy: "internal.contoso.com"}); err != nil {
+			t.Fatalf("failed to configure HTTP: %v", err)
+		}
+		if err := authorizer.DefaultRegistryVerifier.Verify(ctx, "http://registry.contoso.com", azcore.AccessToken{Token: "token"}, ""); err != nil {
+			t.Errorf("failed to verify token through the proxy: %v", err)
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		if len(proxied) != 1 || proxied[0] != "http://registry.contoso.com/v2/" {
+			t.Errorf("expected the proxy to receive the verification request, got %v", proxied)
+		}
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		if err := authorizer.ConfigureHTTP(authorizer.HTTPConfig{ProxyURL: "ftp://proxy.contoso.com"}); err == nil {
+			t.Errorf("expected an error for a proxy URL that is not http, https or socks5")
+		}
+		if err := authorizer.ConfigureHTTP(authorizer.HTTPConfig{CABundle: []byte("not a certificate")}); err == nil {
+			t.Errorf("expected an error for a CA bundle without certificates")
+		}
+	})
+}
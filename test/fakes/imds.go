@@ -0,0 +1,124 @@
+package fakes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IMDSHost is the address of the Instance Metadata Service
+const IMDSHost = "169.254.169.254"
+
+// ManagedIdentity is a managed identity assigned to the node IMDS serves, which it will issue tokens for
+type ManagedIdentity struct {
+	ClientID    string
+	ResourceID  string
+	PrincipalID string
+	TenantID    string
+}
+
+// IMDS stands in for the Instance Metadata Service, issuing tokens for the managed identities assigned to the node.
+type IMDS struct {
+	*httptest.Server
+
+	issuer *Issuer
+
+	lock       sync.Mutex
+	identities []ManagedIdentity
+}
+
+// NewIMDS starts a fake IMDS serving tokens for the identities, signed by the issuer
+func NewIMDS(issuer *Issuer, identities ...ManagedIdentity) *IMDS {
+	imds := &IMDS{issuer: issuer, identities: identities}
+	imds.Server = httptest.NewServer(http.HandlerFunc(imds.serveToken))
+	return imds
+}
+
+// Assign assigns another managed identity to the node
+func (i *IMDS) Assign(identity ManagedIdentity) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.identities = append(i.identities, identity)
+}
+
+// identity finds the assigned identity a token request is for; requests naming no identity are only served if
+// exactly one is assigned, like IMDS does
+func (i *IMDS) identity(r *http.Request) (ManagedIdentity, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	query := r.URL.Query()
+	clientID, resourceID, principalID := query.Get("client_id"), query.Get("msi_res_id"), query.Get("object_id")
+	if resourceID == "" {
+		resourceID = query.Get("mi_res_id")
+	}
+	if clientID == "" && resourceID == "" && principalID == "" {
+		if len(i.identities) == 1 {
+			return i.identities[0], true
+		}
+		return ManagedIdentity{}, false
+	}
+	for _, identity := range i.identities {
+		if (clientID != "" && identity.ClientID == clientID) ||
+			(resourceID != "" && identity.ResourceID == resourceID) ||
+			(principalID != "" && identity.PrincipalID == principalID) {
+			return identity, true
+		}
+	}
+	return ManagedIdentity{}, false
+}
+
+func (i *IMDS) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metadata/identity/oauth2/token" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet || r.Header.Get("Metadata") != "true" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Required metadata header not specified")
+		return
+	}
+	resource := r.URL.Query().Get("resource")
+	if resource == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Required audience parameter not specified")
+		return
+	}
+	identity, found := i.identity(r)
+	if !found {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Identity not found")
+		return
+	}
+	token, expiry, err := i.issuer.Issue(jwt.MapClaims{
+		"aud":   resource,
+		"iss":   "https://sts.windows.net/" + identity.TenantID + "/",
+		"tid":   identity.TenantID,
+		"oid":   identity.PrincipalID,
+		"appid": identity.ClientID,
+		"sub":   identity.PrincipalID,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": token,
+		"client_id":    identity.ClientID,
+		"expires_in":   strconv.Itoa(int(i.issuer.Lifetime.Seconds())),
+		"expires_on":   strconv.FormatInt(expiry.Unix(), 10),
+		"resource":     resource,
+		"token_type":   "Bearer",
+	})
+}
+
+// writeOAuthError responds with an OAuth2 error
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,54 @@
+// Package fakes provides hermetic stand-ins for the Azure services the controller requests tokens from: the Instance
+// Metadata Service, Entra and the token endpoints of Azure Container Registry. Route the requests of the authorizer to
+// them with a Transport.
+package fakes
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultTokenLifetime is how long the tokens issued by the fakes are valid for, unless configured otherwise
+const defaultTokenLifetime = 3 * time.Hour
+
+// Issuer signs the tokens the fake servers issue, and validates the tokens presented to them, so that the servers
+// only accept tokens issued by one another.
+type Issuer struct {
+	key []byte
+	// Lifetime is how long issued tokens are valid for
+	Lifetime time.Duration
+}
+
+// NewIssuer creates an issuer with a random signing key
+func NewIssuer() *Issuer {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Errorf("failed to generate signing key: %w", err))
+	}
+	return &Issuer{key: key, Lifetime: defaultTokenLifetime}
+}
+
+// Issue signs a token with the claims, valid from now for the lifetime of the issuer
+func (i *Issuer) Issue(claims jwt.MapClaims) (string, time.Time, error) {
+	now := time.Now()
+	expiry := now.Add(i.Lifetime)
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = expiry.Unix()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.key)
+	return signed, expiry, err
+}
+
+// Validate checks that the token was issued by this issuer and has not expired, returning its claims
+func (i *Issuer) Validate(token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return i.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()})); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,46 @@
+package fakes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+)
+
+// Transport routes requests to the fake server standing in for the host they are addressed to, so that clients built
+// for Azure reach the fakes without configuring their endpoints. The original host is kept in the Host header.
+type Transport struct {
+	lock   sync.RWMutex
+	routes map[string]*httptest.Server
+}
+
+// NewTransport creates a transport without routes; requests for hosts without a route fail
+func NewTransport() *Transport {
+	return &Transport{routes: map[string]*httptest.Server{}}
+}
+
+// Route sends requests for the host to the server
+func (t *Transport) Route(host string, server *httptest.Server) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.routes[host] = server
+}
+
+// Do sends the request to the server routed for its host
+func (t *Transport) Do(req *http.Request) (*http.Response, error) {
+	t.lock.RLock()
+	server, routed := t.routes[req.URL.Hostname()]
+	t.lock.RUnlock()
+	if !routed {
+		return nil, fmt.Errorf("no fake server for host %s", req.URL.Host)
+	}
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		return nil, err
+	}
+	routedReq := req.Clone(req.Context())
+	routedReq.Host = req.URL.Host
+	routedReq.URL.Scheme, routedReq.URL.Host = target.Scheme, target.Host
+	return server.Client().Transport.RoundTrip(routedReq)
+}
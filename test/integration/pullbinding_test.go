@@ -0,0 +1,217 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	msiacrpullv1beta1 "github.com/Azure/msi-acrpull/api/v1beta1"
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+	"github.com/Azure/msi-acrpull/test/fakes"
+)
+
+func TestV1beta1ManagedIdentity(t *testing.T) {
+	serviceAccount := setup(t, "v1beta1-managed-identity")
+	cloud.IMDS.Assign(fakes.ManagedIdentity{ClientID: "v1beta1-puller", PrincipalID: "v1beta1-puller", TenantID: "tenant"})
+	cloud.ACR.Grant("v1beta1-puller", "alice", "pull")
+
+	binding := &msiacrpullv1beta1.AcrPullBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: serviceAccount.Namespace, Name: "binding"},
+		Spec: msiacrpullv1beta1.AcrPullBindingSpec{
+			AcrServer:               registry,
+			Scope:                   "repository:alice:pull",
+			ManagedIdentityClientID: "v1beta1-puller",
+			ServiceAccountName:      serviceAccount.Name,
+		},
+	}
+	if err := client.Create(context.Background(), binding); err != nil {
+		t.Fatalf("failed to create pull binding: %v", err)
+	}
+
+	secretName := binding.Name + "-msi-acrpull-secret"
+	expectPullSecret(t, serviceAccount, secretName, "repository:alice:pull")
+	eventually(t, "the pull binding to report the credential", func(ctx context.Context) error {
+		if err := client.Get(ctx, crclient.ObjectKeyFromObject(binding), binding); err != nil {
+			return err
+		}
+		if binding.Status.TokenExpirationTime == nil || binding.Status.Error != "" {
+			return fmt.Errorf("unexpected status: %#v", binding.Status)
+		}
+		return nil
+	})
+}
+
+func TestV1beta2ManagedIdentity(t *testing.T) {
+	serviceAccount := setup(t, "v1beta2-managed-identity")
+	cloud.IMDS.Assign(fakes.ManagedIdentity{ClientID: "v1beta2-puller", PrincipalID: "v1beta2-puller", TenantID: "tenant"})
+	cloud.ACR.Grant("v1beta2-puller", "alice", "pull")
+
+	binding := &msiacrpullv1beta2.AcrPullBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: serviceAccount.Namespace, Name: "binding"},
+		Spec: msiacrpullv1beta2.AcrPullBindingSpec{
+			ACR: msiacrpullv1beta2.AcrConfiguration{
+				Server:      registry,
+				Scope:       "repository:alice:pull repository:bob:pull",
+				Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+			},
+			Auth: msiacrpullv1beta2.AuthenticationMethod{
+				ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "v1beta2-puller"},
+			},
+			ServiceAccountName: serviceAccount.Name,
+		},
+	}
+	if err := client.Create(context.Background(), binding); err != nil {
+		t.Fatalf("failed to create pull binding: %v", err)
+	}
+
+	expectPullSecret(t, serviceAccount, "acr-pull-"+binding.Name, "repository:alice:pull repository:bob:")
+	expectCondition(t, binding, msiacrpullv1beta2.ConditionTypeCredentialIssued, metav1.ConditionTrue, msiacrpullv1beta2.ConditionReasonCredentialIssued)
+	expectCondition(t, binding, msiacrpullv1beta2.ConditionTypeScopeFullyGranted, metav1.ConditionFalse, msiacrpullv1beta2.ConditionReasonScopePartiallyGranted)
+}
+
+func TestV1beta2WorkloadIdentity(t *testing.T) {
+	serviceAccount := setup(t, "v1beta2-workload-identity")
+	cloud.Entra.Federate(fakes.FederatedIdentity{
+		TenantID:    "tenant",
+		ClientID:    "federated-puller",
+		PrincipalID: "federated-puller",
+		Subject:     "system:serviceaccount:" + serviceAccount.Namespace + ":" + serviceAccount.Name,
+		Audience:    serviceAccountTokenAudience,
+	})
+	cloud.ACR.Grant("federated-puller", "alice", "pull")
+
+	binding := &msiacrpullv1beta2.AcrPullBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: serviceAccount.Namespace, Name: "binding"},
+		Spec: msiacrpullv1beta2.AcrPullBindingSpec{
+			ACR: msiacrpullv1beta2.AcrConfiguration{
+				Server:      registry,
+				Scope:       "repository:alice:pull",
+				Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+			},
+			Auth: msiacrpullv1beta2.AuthenticationMethod{
+				WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{
+					ServiceAccountName: serviceAccount.Name,
+					ClientID:           "federated-puller",
+					TenantID:           "tenant",
+				},
+			},
+			ServiceAccountName: serviceAccount.Name,
+		},
+	}
+	if err := client.Create(context.Background(), binding); err != nil {
+		t.Fatalf("failed to create pull binding: %v", err)
+	}
+
+	expectPullSecret(t, serviceAccount, "acr-pull-"+binding.Name, "repository:alice:pull")
+	expectCondition(t, binding, msiacrpullv1beta2.ConditionTypeCredentialIssued, metav1.ConditionTrue, msiacrpullv1beta2.ConditionReasonCredentialIssued)
+}
+
+func TestV1beta2Failures(t *testing.T) {
+	serviceAccount := setup(t, "v1beta2-failures")
+	cloud.IMDS.Assign(fakes.ManagedIdentity{ClientID: "v1beta2-stranger", PrincipalID: "v1beta2-stranger", TenantID: "tenant"})
+	cloud.Entra.Federate(fakes.FederatedIdentity{TenantID: "tenant", ClientID: "v1beta2-unfederated", PrincipalID: "v1beta2-unfederated", Subject: "system:serviceaccount:elsewhere:puller"})
+
+	for _, testCase := range []struct {
+		name       string
+		auth       msiacrpullv1beta2.AuthenticationMethod
+		wantReason string
+	}{
+		{
+			name:       "unassigned",
+			auth:       msiacrpullv1beta2.AuthenticationMethod{ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "v1beta2-unassigned"}},
+			wantReason: msiacrpullv1beta2.ConditionReasonIdentityNotFound,
+		},
+		{
+			name:       "unauthorized",
+			auth:       msiacrpullv1beta2.AuthenticationMethod{ManagedIdentity: &msiacrpullv1beta2.ManagedIdentityAuth{ClientID: "v1beta2-stranger"}},
+			wantReason: msiacrpullv1beta2.ConditionReasonRegistryUnauthorized,
+		},
+		{
+			name: "unfederated",
+			auth: msiacrpullv1beta2.AuthenticationMethod{WorkloadIdentity: &msiacrpullv1beta2.WorkloadIdentityAuth{
+				ServiceAccountName: serviceAccount.Name,
+				ClientID:           "v1beta2-unfederated",
+				TenantID:           "tenant",
+			}},
+			wantReason: msiacrpullv1beta2.ConditionReasonFederationMismatch,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			binding := &msiacrpullv1beta2.AcrPullBinding{
+				ObjectMeta: metav1.ObjectMeta{Namespace: serviceAccount.Namespace, Name: testCase.name},
+				Spec: msiacrpullv1beta2.AcrPullBindingSpec{
+					ACR: msiacrpullv1beta2.AcrConfiguration{
+						Server:      registry,
+						Scope:       "repository:alice:pull",
+						Environment: msiacrpullv1beta2.AzureEnvironmentPublicCloud,
+					},
+					Auth:               testCase.auth,
+					ServiceAccountName: serviceAccount.Name,
+				},
+			}
+			if err := client.Create(context.Background(), binding); err != nil {
+				t.Fatalf("failed to create pull binding: %v", err)
+			}
+			expectCondition(t, binding, msiacrpullv1beta2.ConditionTypeCredentialIssued, metav1.ConditionFalse, testCase.wantReason)
+		})
+	}
+}
+
+// expectPullSecret waits for the pull secret to hold a token for the registry granting the scope, and for the service
+// account to reference it
+func expectPullSecret(t *testing.T, serviceAccount *corev1.ServiceAccount, name, wantGranted string) {
+	t.Helper()
+	eventually(t, "the pull secret", func(ctx context.Context) error {
+		var secret corev1.Secret
+		if err := client.Get(ctx, crclient.ObjectKey{Namespace: serviceAccount.Namespace, Name: name}, &secret); err != nil {
+			return err
+		}
+		var dockerConfig struct {
+			Auths map[string]struct {
+				Password string `json:"password"`
+			} `json:"auths"`
+		}
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &dockerConfig); err != nil {
+			return err
+		}
+		granted, _ := authorizer.GrantedScope(dockerConfig.Auths[registry].Password)
+		if granted != wantGranted {
+			return fmt.Errorf("expected the token to grant %q, got %q", wantGranted, granted)
+		}
+		return nil
+	})
+	eventually(t, "the service account to reference the pull secret", func(ctx context.Context) error {
+		var updated corev1.ServiceAccount
+		if err := client.Get(ctx, crclient.ObjectKeyFromObject(serviceAccount), &updated); err != nil {
+			return err
+		}
+		if !slices.Contains(updated.ImagePullSecrets, corev1.LocalObjectReference{Name: name}) {
+			return fmt.Errorf("image pull secrets do not include %s: %v", name, updated.ImagePullSecrets)
+		}
+		return nil
+	})
+}
+
+// expectCondition waits for the pull binding to report the condition
+func expectCondition(t *testing.T, binding *msiacrpullv1beta2.AcrPullBinding, conditionType string, status metav1.ConditionStatus, reason string) {
+	t.Helper()
+	eventually(t, fmt.Sprintf("the %s condition", conditionType), func(ctx context.Context) error {
+		var updated msiacrpullv1beta2.AcrPullBinding
+		if err := client.Get(ctx, crclient.ObjectKeyFromObject(binding), &updated); err != nil {
+			return err
+		}
+		condition := apimeta.FindStatusCondition(updated.Status.Conditions, conditionType)
+		if condition == nil || condition.Status != status || condition.Reason != reason {
+			return fmt.Errorf("expected %s=%s with reason %s, got %v", conditionType, status, reason, condition)
+		}
+		return nil
+	})
+}
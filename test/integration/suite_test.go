@@ -0,0 +1,190 @@
+// Package integration runs the pull binding controllers against a local API server from envtest, with the Azure
+// services they call replaced by the fakes in test/fakes. The suite needs the envtest binaries, which `make test`
+// installs; it is skipped if KUBEBUILDER_ASSETS is not set.
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	msiacrpullv1beta1 "github.com/Azure/msi-acrpull/api/v1beta1"
+	msiacrpullv1beta2 "github.com/Azure/msi-acrpull/api/v1beta2"
+	"github.com/Azure/msi-acrpull/internal/controller"
+	"github.com/Azure/msi-acrpull/pkg/authorizer"
+	"github.com/Azure/msi-acrpull/test/fakes"
+)
+
+const (
+	// registry is the host of the fake registry
+	registry = "fake.azurecr.io"
+	// serviceAccountTokenAudience is the audience of the service account tokens exchanged for workload identities
+	serviceAccountTokenAudience = "api://AzureADTokenExchange"
+)
+
+var (
+	// client talks to the API server, and is nil when the suite is skipped
+	client crclient.Client
+	// cloud holds the fake Azure services the controllers call
+	cloud *fakes.Cloud
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		fmt.Println("KUBEBUILDER_ASSETS is not set, skipping the integration suite")
+		os.Exit(m.Run())
+	}
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+	logger := ctrl.Log.WithName("integration")
+
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, msiacrpullv1beta1.AddToScheme, msiacrpullv1beta2.AddToScheme} {
+		if err := add(scheme); err != nil {
+			logger.Error(err, "failed to build scheme")
+			return 1
+		}
+	}
+
+	templates := filepath.Join("..", "..", "config", "helm", "templates")
+	environment := &envtest.Environment{
+		Scheme: scheme,
+		CRDInstallOptions: envtest.CRDInstallOptions{
+			Paths: []string{
+				filepath.Join(templates, "msi-acrpull.microsoft.com_acrpullbindings.yaml"),
+				filepath.Join(templates, "acrpull.microsoft.com_acrpullbindings.yaml"),
+				filepath.Join(templates, "acrpull.microsoft.com_azurecloudprofiles.yaml"),
+				filepath.Join(templates, "acrpull.microsoft.com_acrregistries.yaml"),
+				filepath.Join(templates, "acrpull.microsoft.com_azureidentities.yaml"),
+				filepath.Join(templates, "acrpull.microsoft.com_clusterazureidentities.yaml"),
+				filepath.Join(templates, "acrpull.microsoft.com_acrpullpolicies.yaml"),
+			},
+			ErrorIfPathMissing: true,
+		},
+	}
+	cfg, err := environment.Start()
+	if err != nil {
+		logger.Error(err, "failed to start envtest")
+		return 1
+	}
+	defer func() {
+		if err := environment.Stop(); err != nil {
+			logger.Error(err, "failed to stop envtest")
+		}
+	}()
+
+	cloud = fakes.NewCloud(registry)
+	defer cloud.Close()
+	authorizer.SetTransport(cloud.Transport)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := startControllers(ctx, logger, cfg, scheme); err != nil {
+		logger.Error(err, "failed to start controllers")
+		return 1
+	}
+	return m.Run()
+}
+
+// startControllers runs both pull binding controllers, configured like cmd/main.go does by default
+func startControllers(ctx context.Context, logger logr.Logger, cfg *rest.Config, scheme *runtime.Scheme) error {
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:  scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create manager: %w", err)
+	}
+	client = mgr.GetClient()
+
+	v1beta1Reconciler := controller.NewV1beta1Reconciler(&controller.V1beta1ReconcilerOpts{
+		CoreOpts: controller.CoreOpts{
+			Client: mgr.GetClient(),
+			Logger: logger.WithName("AcrPullBinding"),
+			Scheme: mgr.GetScheme(),
+		},
+	})
+	if err := v1beta1Reconciler.SetupWithManager(ctx, mgr); err != nil {
+		return fmt.Errorf("failed to set up v1beta1 controller: %w", err)
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	v1beta2Reconciler := controller.NewV1beta2Reconciler(&controller.V1beta2ReconcilerOpts{
+		CoreOpts: controller.CoreOpts{
+			Client:   mgr.GetClient(),
+			Logger:   logger.WithName("AcrPullBindingV1beta2"),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("acrpull-controller"),
+		},
+		TTLRotationFraction:         0.5,
+		ServiceAccountTokenAudience: serviceAccountTokenAudience,
+		ServiceAccountClient:        kubeClient.CoreV1(),
+		VerifyPullCredentials:       true,
+	})
+	if err := v1beta2Reconciler.SetupWithManager(ctx, mgr); err != nil {
+		return fmt.Errorf("failed to set up v1beta2 controller: %w", err)
+	}
+
+	go func() {
+		if err := mgr.Start(ctx); err != nil {
+			logger.Error(err, "manager exited")
+		}
+	}()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		return fmt.Errorf("failed to sync caches")
+	}
+	return nil
+}
+
+// setup skips the test if the suite is not running, and otherwise creates a namespace and service account for it
+func setup(t *testing.T, namespace string) *corev1.ServiceAccount {
+	t.Helper()
+	if client == nil {
+		t.Skip("the integration suite needs KUBEBUILDER_ASSETS")
+	}
+	ctx := context.Background()
+	if err := client.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}); err != nil {
+		t.Fatalf("failed to create namespace %s: %v", namespace, err)
+	}
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "puller"}}
+	if err := client.Create(ctx, serviceAccount); err != nil {
+		t.Fatalf("failed to create service account: %v", err)
+	}
+	return serviceAccount
+}
+
+// eventually polls until the condition holds, failing the test if it does not in time; the last error the condition
+// returned is reported
+func eventually(t *testing.T, what string, condition func(ctx context.Context) error) {
+	t.Helper()
+	var last error
+	if err := wait.PollUntilContextTimeout(context.Background(), 100*time.Millisecond, 30*time.Second, true, func(ctx context.Context) (bool, error) {
+		last = condition(ctx)
+		return last == nil, nil
+	}); err != nil {
+		t.Fatalf("timed out waiting for %s: %v", what, last)
+	}
+}